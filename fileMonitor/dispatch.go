@@ -0,0 +1,256 @@
+//
+// Copyright 2026 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package fileMonitor
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Subscription configuration
+type SubscribeOpts struct {
+	EventBufSize int
+	Mask         EventKind        // events kinds to deliver (0 means all)
+	Filter       func(Event) bool // events for which it returns false are not delivered (nil means all)
+	NonBlocking  bool             // drop events when the channel is full, rather than wait for the subscriber
+}
+
+// Subscription is an independent stream of events from a FileMon.
+type Subscription struct {
+	fm      *FileMon
+	opts    SubscribeOpts
+	mu      sync.RWMutex // held for reading while sending on eventCh
+	eventCh chan []Event
+	doneCh  chan struct{} // closed on Unsubscribe()
+	closed  bool
+	once    sync.Once
+	dropped atomic.Uint64
+}
+
+// Subscribe returns a new subscription to the events of the file monitor.
+// Each subscriber receives its own copy of the (filtered) events.
+func (fm *FileMon) Subscribe(opts *SubscribeOpts) *Subscription {
+	s := newSubscription(fm, opts)
+
+	fm.subMu.Lock()
+	defer fm.subMu.Unlock()
+
+	if fm.closed {
+		s.close()
+		return s
+	}
+	fm.subs = append(fm.subs, s)
+	return s
+}
+
+func newSubscription(fm *FileMon, opts *SubscribeOpts) *Subscription {
+	return &Subscription{
+		fm:      fm,
+		opts:    *opts,
+		eventCh: make(chan []Event, opts.EventBufSize),
+		doneCh:  make(chan struct{}),
+	}
+}
+
+// Events returns the channel on which the subscription's events are
+// delivered; it's closed when the subscription (or the file monitor) is
+// closed.
+func (s *Subscription) Events() <-chan []Event {
+	return s.eventCh
+}
+
+// Dropped returns the number of events dropped because the subscriber's
+// channel was full (non-blocking subscriptions only).
+func (s *Subscription) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// Unsubscribe stops the delivery of events to the subscription and closes its
+// channel. It's safe to call it multiple times.
+func (s *Subscription) Unsubscribe() {
+	fm := s.fm
+
+	fm.subMu.Lock()
+	for i, other := range fm.subs {
+		if other == s {
+			fm.subs = append(fm.subs[:i], fm.subs[i+1:]...)
+			break
+		}
+	}
+	fm.subMu.Unlock()
+
+	s.close()
+}
+
+func (s *Subscription) close() {
+	s.once.Do(func() {
+		// unblock a pending send, then wait for it to finish
+		close(s.doneCh)
+		s.mu.Lock()
+		s.closed = true
+		close(s.eventCh)
+		s.mu.Unlock()
+	})
+}
+
+// sendLast delivers the final (empty) batch of the Events() channel, which is
+// not closed so that consumers that don't check for it don't spin on it. The
+// batch is dropped if the channel is full (and no consumer is receiving), as
+// the consumer may never read again.
+func (s *Subscription) sendLast() {
+	select {
+	case s.eventCh <- []Event{}:
+	default:
+	}
+}
+
+// filter returns the events that the subscription is interested in.
+func (s *Subscription) filter(events []Event) []Event {
+	// each subscriber gets its own copy of the events
+	if s.opts.Mask == 0 && s.opts.Filter == nil {
+		return append([]Event{}, events...)
+	}
+
+	filtered := []Event{}
+	for _, e := range events {
+		if s.opts.Mask != 0 && e.Kind&s.opts.Mask == 0 && e.Err == nil {
+			continue
+		}
+		if s.opts.Filter != nil && !s.opts.Filter(e) {
+			continue
+		}
+		filtered = append(filtered, e)
+	}
+	return filtered
+}
+
+// send delivers the given events to the subscription.
+func (s *Subscription) send(events []Event, stopCh chan struct{}) {
+	events = s.filter(events)
+	if len(events) == 0 {
+		return
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.closed {
+		return
+	}
+
+	if s.opts.NonBlocking {
+		select {
+		case s.eventCh <- events:
+		default:
+			s.dropped.Add(uint64(len(events)))
+		}
+		return
+	}
+
+	select {
+	case s.eventCh <- events:
+	case <-s.doneCh:
+	case <-stopCh:
+	}
+}
+
+// dispatch delivers the given events to the subscribers, or queues them for
+// coalescing (see Cfg.CoalesceWindow). Must be called without fm.mu held.
+func (fm *FileMon) dispatch(events []Event) {
+	if len(events) == 0 {
+		return
+	}
+
+	if fm.cfg.CoalesceWindow == 0 {
+		fm.deliver(events)
+		return
+	}
+
+	fm.pendMu.Lock()
+	defer fm.pendMu.Unlock()
+
+	for _, e := range events {
+		i, found := fm.pendIdx[e.Filename]
+		if !found {
+			fm.pendIdx[e.Filename] = len(fm.pending)
+			fm.pending = append(fm.pending, e)
+			continue
+		}
+		p := &fm.pending[i]
+		p.Kind |= e.Kind
+		if e.Err != nil {
+			p.Err = e.Err
+		}
+	}
+
+	// the first event in the window schedules the flush
+	if fm.pendTimer == nil {
+		fm.wg.Add(1)
+		fm.pendTimer = time.AfterFunc(fm.cfg.CoalesceWindow, func() {
+			defer fm.wg.Done()
+			fm.flush()
+		})
+	}
+}
+
+// flush delivers the coalesced events, unless the file monitor was closed
+// meanwhile (in which case they are discarded, as done by stopFlush()).
+func (fm *FileMon) flush() {
+	fm.pendMu.Lock()
+	select {
+	case <-fm.stopCh:
+		fm.pendMu.Unlock()
+		return
+	default:
+	}
+	events := fm.pending
+	fm.pending = nil
+	fm.pendIdx = make(map[string]int)
+	fm.pendTimer = nil
+	fm.pendMu.Unlock()
+
+	fm.deliver(events)
+}
+
+// stopFlush cancels a scheduled flush of coalesced events (pending events are
+// discarded).
+func (fm *FileMon) stopFlush() {
+	fm.pendMu.Lock()
+	defer fm.pendMu.Unlock()
+
+	if fm.pendTimer != nil && fm.pendTimer.Stop() {
+		fm.wg.Done()
+	}
+	fm.pendTimer = nil
+	fm.pending = nil
+}
+
+// deliver sends the given events to all subscribers.
+func (fm *FileMon) deliver(events []Event) {
+	if len(events) == 0 {
+		return
+	}
+
+	fm.subMu.Lock()
+	subs := append([]*Subscription{}, fm.subs...)
+	fm.subMu.Unlock()
+
+	for _, s := range subs {
+		s.send(events, fm.stopCh)
+	}
+}
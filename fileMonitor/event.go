@@ -0,0 +1,219 @@
+//
+// Copyright 2026 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package fileMonitor
+
+import (
+	"crypto/sha256"
+	"errors"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// Event kinds; they can be combined into a mask (e.g., when passed to Add(),
+// or when several changes are detected at once).
+type EventKind uint32
+
+const (
+	EventRemove EventKind = 1 << iota // file removed (or moved away)
+	EventCreate                       // file created (in a monitored dir or glob, or re-created with Cfg.KeepWatching)
+	EventModify                       // file contents modified
+	EventRename                       // file replaced by another one (e.g., via rename(2))
+	EventAttrib                       // file permissions or ownership changed
+
+	EventAll = EventRemove | EventCreate | EventModify | EventRename | EventAttrib
+)
+
+var eventKindNames = []struct {
+	kind EventKind
+	name string
+}{
+	{EventRemove, "remove"},
+	{EventCreate, "create"},
+	{EventModify, "modify"},
+	{EventRename, "rename"},
+	{EventAttrib, "attrib"},
+}
+
+func (k EventKind) String() string {
+	names := []string{}
+	for _, kn := range eventKindNames {
+		if k&kn.kind != 0 {
+			names = append(names, kn.name)
+		}
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, "|")
+}
+
+// State of a monitored file, as last seen by the monitor
+type fileState struct {
+	known  bool // state has been read
+	exists bool
+	dev    uint64
+	ino    uint64
+	size   int64
+	mtime  unix.Timespec
+	mode   uint32
+	uid    uint32
+	gid    uint32
+	hasSum bool              // sum is valid (see WatchOpts.Checksum)
+	sum    [sha256.Size]byte // checksum of the file's contents (regular files only)
+}
+
+// statFile returns the current state of the given file (following symlinks);
+// if checksum is set, the contents of regular files are hashed too.
+func statFile(path string, checksum bool) (fileState, error) {
+	var st unix.Stat_t
+
+	if err := unix.Stat(path, &st); err != nil {
+		if isNotExist(err) {
+			return fileState{known: true}, nil
+		}
+		return fileState{}, err
+	}
+
+	state := fileState{
+		known:  true,
+		exists: true,
+		dev:    st.Dev,
+		ino:    st.Ino,
+		size:   st.Size,
+		mtime:  st.Mtim,
+		mode:   st.Mode,
+		uid:    st.Uid,
+		gid:    st.Gid,
+	}
+
+	if checksum && st.Mode&unix.S_IFMT == unix.S_IFREG {
+		sum, err := fileSum(path)
+		if err != nil {
+			// file removed since the stat above
+			if isNotExist(err) {
+				return fileState{known: true}, nil
+			}
+			return fileState{}, err
+		}
+		state.hasSum = true
+		state.sum = sum
+	}
+
+	return state, nil
+}
+
+// fileSum returns the checksum of the contents of the given file.
+func fileSum(path string) ([sha256.Size]byte, error) {
+	var sum [sha256.Size]byte
+
+	f, err := os.Open(path)
+	if err != nil {
+		return sum, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return sum, err
+	}
+	copy(sum[:], h.Sum(nil))
+	return sum, nil
+}
+
+func isNotExist(err error) bool {
+	return errors.Is(err, unix.ENOENT) || errors.Is(err, unix.ENOTDIR)
+}
+
+// diffState returns the events implied by a file's change of state.
+func diffState(prev, curr fileState) EventKind {
+	switch {
+	case !prev.known:
+		// file did not exist when added
+		if !curr.exists {
+			return EventRemove
+		}
+		return 0
+	case prev.exists && !curr.exists:
+		return EventRemove
+	case !prev.exists && curr.exists:
+		return EventCreate
+	case !prev.exists && !curr.exists:
+		return 0
+	case prev.dev != curr.dev || prev.ino != curr.ino:
+		return EventRename
+	}
+
+	kind := EventKind(0)
+	if prev.size != curr.size || prev.mtime != curr.mtime {
+		kind |= EventModify
+	}
+	// catches writes that leave the size and mtime unchanged (e.g., on
+	// filesystems with coarse timestamps)
+	if prev.hasSum && curr.hasSum && prev.sum != curr.sum {
+		kind |= EventModify
+	}
+	if prev.mode != curr.mode || prev.uid != curr.uid || prev.gid != curr.gid {
+		kind |= EventAttrib
+	}
+	return kind
+}
+
+// checkFile reads the current state of the given file and returns the event
+// for the changes since it was last checked (nil if there are none, or if
+// they are not in the file's event mask). The hint holds changes known to have
+// occurred but that may not be visible in the file's state (e.g., a write that
+// did not change the size or mtime). Must be called with fm.mu held.
+func (fm *FileMon) checkFile(filename string, hint EventKind) *Event {
+	fi, found := fm.fileTable[filename]
+	if !found {
+		return nil
+	}
+
+	curr, err := statFile(filename, fi.checksum)
+	if err != nil {
+		// file can't be monitored any more; remove it.
+		fm.removeFile(filename)
+		return &Event{Filename: filename, Kind: EventRemove, Err: err}
+	}
+
+	kind := diffState(fi.state, curr)
+	if curr.exists && kind&(EventCreate|EventRename) == 0 {
+		kind |= hint
+	}
+	fi.state = curr
+
+	// Files added by a dir or glob group are re-added by the group if they
+	// show up again.
+	if !curr.exists && (!fm.cfg.KeepWatching || fi.group != nil) {
+		// file removal implies event won't hit again; remove it.
+		fm.removeFile(filename)
+	}
+
+	// a replaced file is a content change for those not watching renames
+	if kind&EventRename != 0 && fi.mask&EventRename == 0 {
+		kind |= EventModify
+	}
+
+	kind &= fi.mask
+	if kind == 0 {
+		return nil
+	}
+	return &Event{Filename: filename, Kind: kind}
+}
@@ -14,8 +14,9 @@
 // limitations under the License.
 //
 
-// The fileMonitor notifies the caller about file removal events.
-// It uses a simple polling algorithm.
+// The fileMonitor notifies the caller about file events (removal, creation,
+// modification, replacement, attribute changes). It uses either a simple
+// polling algorithm or inotify (see Cfg.Backend).
 
 package fileMonitor
 
@@ -23,11 +24,30 @@ import (
 	"fmt"
 	"sync"
 	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// Monitoring backends
+type Backend int
+
+const (
+	BackendPoll    Backend = iota // polls the files with stat() every PollInterval
+	BackendInotify                // uses inotify; files that can't be watched are polled
 )
 
 type Cfg struct {
 	EventBufSize int
 	PollInterval time.Duration // in milliseconds
+	Backend      Backend
+	KeepWatching bool // keep watching files after they are removed (to report their re-creation)
+
+	// Events for the same file that occur within this window are merged
+	// into a single event (with the event kinds combined); zero disables
+	// coalescing.
+	CoalesceWindow time.Duration
+
+	NonBlocking bool // drop events when the Events() channel is full, rather than wait for the consumer
 }
 
 // polling config limits
@@ -38,16 +58,62 @@ const (
 
 type Event struct {
 	Filename string
+	Kind     EventKind
 	Err      error
 }
 
+// Per-file monitoring options (see AddWithOpts())
+type WatchOpts struct {
+	Mask EventKind // events to report (EventRemove if zero)
+
+	// Poll the file even with the inotify backend (for filesystems on which
+	// inotify does not report changes, e.g., FUSE, NFS, or overlays).
+	Poll bool
+
+	// Detect content changes by hashing the file's contents (besides
+	// comparing its size, mtime and inode). This reads the whole file on
+	// every check, so it's meant for small files.
+	Checksum bool
+}
+
+// Info about a monitored file
+type fileInfo struct {
+	mask       EventKind // events to report for the file
+	state      fileState // last known state of the file
+	forcePoll  bool      // file is always polled (WatchOpts.Poll)
+	checksum   bool      // file contents are hashed (WatchOpts.Checksum)
+	polled     bool      // file is polled (rather than watched with inotify)
+	retryWatch bool      // file is polled until an inotify watch can be set up
+	wds        []int32   // inotify watch descriptors for the file
+	dirWatch   bool      // the watch is on the parent dir (waiting for the file to be created)
+	watchDev   uint64    // device and inode on which the watch was set up
+	watchIno   uint64
+	group      *watchGroup // group that added the file (nil if added with Add())
+}
+
 type FileMon struct {
-	mu        sync.Mutex
-	cfg       Cfg
-	fileTable map[string]bool // map of files to monitor
-	stopCh    chan struct{}   // signals the monitor thread to stop
-	eventCh   chan []Event    // receives events from monitor thread
-	running   bool            // indicates if the monitor thread is running
+	mu         sync.Mutex
+	cfg        Cfg
+	fileTable  map[string]*fileInfo    // map of files to monitor
+	groupTable map[string]*watchGroup  // map of dirs and glob patterns to monitor
+	wdTable    map[int32][]string      // map of inotify watch descriptors to files
+	groupWds   map[int32][]*watchGroup // map of inotify watch descriptors to groups
+	inotifyFd  int                     // inotify instance (inotify backend only)
+	wakeFd     int                     // eventfd used to wake up the monitor thread (inotify backend only)
+	stopCh     chan struct{}           // signals the monitor thread to stop
+	running    bool                    // indicates if the monitor thread is running
+	closed     bool                    // Close() was called (written with mu and subMu held)
+	closeOnce  sync.Once
+	wg         sync.WaitGroup // tracks the monitor thread and scheduled flushes
+
+	subMu      sync.Mutex
+	subs       []*Subscription // subscribers (including defaultSub)
+	defaultSub *Subscription   // subscription behind Events()
+
+	pendMu    sync.Mutex
+	pending   []Event        // events waiting to be coalesced
+	pendIdx   map[string]int // index of each file's event in pending
+	pendTimer *time.Timer    // flushes the pending events
 }
 
 func New(cfg *Cfg) (*FileMon, error) {
@@ -56,42 +122,224 @@ func New(cfg *Cfg) (*FileMon, error) {
 	}
 
 	fm := &FileMon{
-		cfg:       *cfg,
-		fileTable: make(map[string]bool),
-		stopCh:    make(chan struct{}),
-		eventCh:   make(chan []Event, cfg.EventBufSize),
+		cfg:        *cfg,
+		fileTable:  make(map[string]*fileInfo),
+		groupTable: make(map[string]*watchGroup),
+		wdTable:    make(map[int32][]string),
+		groupWds:   make(map[int32][]*watchGroup),
+		inotifyFd:  -1,
+		wakeFd:     -1,
+		stopCh:     make(chan struct{}),
+		pendIdx:    make(map[string]int),
+	}
+
+	fm.defaultSub = newSubscription(fm, &SubscribeOpts{
+		EventBufSize: cfg.EventBufSize,
+		NonBlocking:  cfg.NonBlocking,
+	})
+	fm.subs = []*Subscription{fm.defaultSub}
+
+	// If inotify is not available, fall back to polling.
+	if cfg.Backend == BackendInotify {
+		if err := fm.inotifyInit(); err != nil {
+			fm.cfg.Backend = BackendPoll
+		}
 	}
 
 	return fm, nil
 }
 
-func (fm *FileMon) Add(file string) {
+// Add starts monitoring the given file for the given events (EventRemove if
+// none are given). If the file is already monitored, the events are added to
+// the ones already monitored. A file that does not exist when added is
+// reported as removed.
+func (fm *FileMon) Add(file string, mask ...EventKind) {
+	fm.AddWithOpts(file, &WatchOpts{Mask: eventMask(mask, EventRemove)})
+}
+
+// AddWithOpts is like Add(), but takes per-file monitoring options. If the
+// file is already monitored, the options are combined with the existing ones.
+func (fm *FileMon) AddWithOpts(file string, opts *WatchOpts) {
 	fm.mu.Lock()
-	fm.fileTable[file] = true
+	defer fm.mu.Unlock()
+
+	o := *opts
+	o.Mask = eventMask([]EventKind{o.Mask}, EventRemove)
+
+	fm.addFile(file, o, nil)
+	fm.start()
+}
+
+// eventMask combines the given event masks; returns def if there are none.
+func eventMask(mask []EventKind, def EventKind) EventKind {
+	evMask := EventKind(0)
+	for _, m := range mask {
+		evMask |= m
+	}
+	if evMask == 0 {
+		evMask = def
+	}
+	return evMask
+}
+
+// addFile adds the given file to the file table; must be called with fm.mu
+// held.
+func (fm *FileMon) addFile(file string, opts WatchOpts, group *watchGroup) {
+
+	if fi, found := fm.fileTable[file]; found {
+		fm.updateFile(file, fi, opts)
+		return
+	}
+
+	fi := &fileInfo{
+		mask:      opts.Mask,
+		forcePoll: opts.Poll,
+		checksum:  opts.Checksum,
+		polled:    true,
+		group:     group,
+	}
+
+	state, err := statFile(file, fi.checksum)
+	if err == nil && state.exists {
+		fi.state = state
+	}
+	fm.fileTable[file] = fi
+
+	if fm.cfg.Backend == BackendInotify && !fi.forcePoll {
+		// Files that don't exist are polled so that their removal is reported;
+		// on failure (e.g., too many watches) the file is polled instead.
+		if !fi.state.exists {
+			fi.retryWatch = true
+		} else if err := fm.addWatch(file, fi); err == nil {
+			fi.polled = false
+		}
+	}
+}
+
+// updateFile combines the given options with those of the given (already
+// monitored) file; must be called with fm.mu held.
+func (fm *FileMon) updateFile(file string, fi *fileInfo, opts WatchOpts) {
+
+	if opts.Checksum && !fi.checksum {
+		fi.checksum = true
+		if sum, err := fileSum(file); err == nil && fi.state.exists && fi.state.mode&unix.S_IFMT == unix.S_IFREG {
+			fi.state.hasSum = true
+			fi.state.sum = sum
+		}
+	}
+
+	if opts.Poll && !fi.forcePoll {
+		fi.forcePoll = true
+		fm.rmWatch(file, fi)
+		fi.polled = true
+		fi.retryWatch = false
+	}
+
+	if fi.mask|opts.Mask != fi.mask {
+		fi.mask |= opts.Mask
+		if !fi.polled {
+			fm.rmWatch(file, fi)
+			fm.rearm(file, fi)
+		}
+	}
+}
+
+// start starts the monitor thread if it's not running, or wakes it up so it
+// picks up new files; must be called with fm.mu held.
+func (fm *FileMon) start() {
+	if fm.closed {
+		return
+	}
 	if !fm.running {
 		fm.running = true
-		go fileMon(fm)
+		fm.wg.Add(1)
+		if fm.cfg.Backend == BackendInotify {
+			go inotifyMon(fm)
+		} else {
+			go fileMon(fm)
+		}
+	} else if fm.cfg.Backend == BackendInotify {
+		fm.wake()
 	}
-	fm.mu.Unlock()
 }
 
+// Remove stops monitoring the given file, or the given dir or glob pattern
+// (if added with AddDir() or AddGlob()).
 func (fm *FileMon) Remove(file string) {
 	fm.mu.Lock()
-	delete(fm.fileTable, file)
+	if g, found := fm.groupTable[file]; found {
+		fm.removeGroup(g)
+	} else {
+		fm.removeFile(file)
+	}
 	fm.mu.Unlock()
 }
 
+// Events returns the channel on which events are delivered (in batches). When
+// the file monitor is closed, a final empty batch is delivered on it if a
+// consumer is receiving or the channel has room; otherwise it's dropped (the
+// channel is not closed).
 func (fm *FileMon) Events() <-chan []Event {
-	return fm.eventCh
+	return fm.defaultSub.Events()
 }
 
+// Dropped returns the number of events dropped because the Events() channel
+// was full (with Cfg.NonBlocking only).
+func (fm *FileMon) Dropped() uint64 {
+	return fm.defaultSub.Dropped()
+}
+
+// Close stops the file monitor, waits for its thread to exit, closes the event
+// channels of all subscriptions and delivers a final empty batch on the
+// Events() channel (if it's not full). Coalesced events not yet delivered are discarded. It's
+// safe to call it multiple times.
 func (fm *FileMon) Close() {
-	close(fm.stopCh)
+	fm.closeOnce.Do(func() {
+		fm.mu.Lock()
+		fm.subMu.Lock()
+		fm.closed = true
+		subs := fm.subs
+		fm.subs = nil
+		fm.subMu.Unlock()
+		close(fm.stopCh)
+		fm.wake()
+		fm.mu.Unlock()
+
+		fm.stopFlush()
+		fm.wg.Wait()
+
+		fm.mu.Lock()
+		fm.inotifyClose()
+		fm.mu.Unlock()
+
+		for _, s := range subs {
+			if s != fm.defaultSub {
+				s.close()
+			}
+		}
+		fm.defaultSub.sendLast()
+	})
+}
+
+// removeFile stops monitoring the given file; must be called with fm.mu held.
+func (fm *FileMon) removeFile(file string) {
+	fi, found := fm.fileTable[file]
+	if !found {
+		return
+	}
+	fm.rmWatch(file, fi)
+	delete(fm.fileTable, file)
 }
 
 func validateCfg(cfg *Cfg) error {
 	if cfg.PollInterval < PollMin || cfg.PollInterval > PollMax {
 		return fmt.Errorf("invalid config: poll interval must be in range [%d, %d]; found %d", PollMin, PollMax, cfg.PollInterval)
 	}
+	if cfg.Backend != BackendPoll && cfg.Backend != BackendInotify {
+		return fmt.Errorf("invalid config: unknown backend %d", cfg.Backend)
+	}
+	if cfg.EventBufSize < 0 || cfg.CoalesceWindow < 0 {
+		return fmt.Errorf("invalid config: negative event buffer size or coalesce window")
+	}
 	return nil
 }
@@ -339,3 +339,759 @@ func TestEventOnNonExistentFile(t *testing.T) {
 
 	fm.Close()
 }
+
+// waits for a single event on the given channel
+func waitEvent(t *testing.T, fileEvents <-chan []Event, timeout time.Duration) Event {
+	select {
+	case events := <-fileEvents:
+		if len(events) != 1 {
+			t.Fatalf("incorrect events list size: want 1, got %d (%+v)", len(events), events)
+		}
+		return events[0]
+	case <-time.After(timeout):
+		t.Fatalf("timed out waiting for event")
+	}
+	return Event{}
+}
+
+// returns the events received on the given channel within the given time
+func drainEvents(fileEvents <-chan []Event, d time.Duration) []Event {
+	events := []Event{}
+	timeout := time.After(d)
+	for {
+		select {
+		case e := <-fileEvents:
+			events = append(events, e...)
+		case <-timeout:
+			return events
+		}
+	}
+}
+
+func TestInotifyBackend(t *testing.T) {
+
+	dir := t.TempDir()
+
+	// use the max poll interval, so that events can only come from inotify
+	cfg := Cfg{
+		EventBufSize: 10,
+		PollInterval: PollMax,
+		Backend:      BackendInotify,
+	}
+	fm, err := New(&cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fm.Close()
+
+	files := []string{dir + "/removed", dir + "/target", dir + "/replaced", dir + "/renamed"}
+	for _, file := range files {
+		if err := os.WriteFile(file, []byte("data"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	link := dir + "/link"
+	if err := os.Symlink(dir+"/target", link); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, file := range []string{dir + "/removed", dir + "/replaced", dir + "/renamed", link} {
+		fm.Add(file)
+	}
+	fileEvents := fm.Events()
+
+	// removal
+	if err := os.Remove(dir + "/removed"); err != nil {
+		t.Fatal(err)
+	}
+	if e := waitEvent(t, fileEvents, time.Second); e.Filename != dir+"/removed" || e.Err != nil {
+		t.Fatalf("incorrect event: %+v", e)
+	}
+
+	// removal of a symlink's target
+	if err := os.Remove(dir + "/target"); err != nil {
+		t.Fatal(err)
+	}
+	if e := waitEvent(t, fileEvents, time.Second); e.Filename != link || e.Err != nil {
+		t.Fatalf("incorrect event: %+v", e)
+	}
+
+	// rename away
+	if err := os.Rename(dir+"/renamed", dir+"/other"); err != nil {
+		t.Fatal(err)
+	}
+	if e := waitEvent(t, fileEvents, time.Second); e.Filename != dir+"/renamed" || e.Err != nil {
+		t.Fatalf("incorrect event: %+v", e)
+	}
+
+	// replacement via rename is not a removal, but the new file is watched
+	if err := os.WriteFile(dir+"/new", []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(dir+"/new", dir+"/replaced"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case events := <-fileEvents:
+		t.Fatalf("unexpected events: %+v", events)
+	case <-time.After(200 * time.Millisecond):
+	}
+	if err := os.Remove(dir + "/replaced"); err != nil {
+		t.Fatal(err)
+	}
+	if e := waitEvent(t, fileEvents, time.Second); e.Filename != dir+"/replaced" || e.Err != nil {
+		t.Fatalf("incorrect event: %+v", e)
+	}
+}
+
+func TestAncestorRename(t *testing.T) {
+	for _, backend := range []Backend{BackendPoll, BackendInotify} {
+		dir := t.TempDir()
+		file := dir + "/a/b/file"
+
+		if err := os.MkdirAll(dir+"/a/b", 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte("data"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		// with inotify, use the max poll interval so that events can only
+		// come from inotify
+		cfg := Cfg{
+			EventBufSize: 10,
+			PollInterval: 50 * time.Millisecond,
+			Backend:      backend,
+		}
+		if backend == BackendInotify {
+			cfg.PollInterval = PollMax
+		}
+		fm, err := New(&cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		fm.Add(file)
+
+		// no event on the file itself
+		if err := os.Rename(dir+"/a", dir+"/c"); err != nil {
+			t.Fatal(err)
+		}
+		waitEvents(t, fm.Events(), map[string]EventKind{file: EventRemove})
+
+		fm.Close()
+	}
+}
+
+func TestInotifyBackendPollFallback(t *testing.T) {
+
+	// files that can't be watched with inotify (e.g., non-existent ones) are
+	// polled
+	cfg := Cfg{
+		EventBufSize: 10,
+		PollInterval: 100 * time.Millisecond,
+		Backend:      BackendInotify,
+	}
+	fm, err := New(&cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fm.Close()
+
+	file := "/some/nonexistent/file"
+	fm.Add(file)
+
+	if e := waitEvent(t, fm.Events(), time.Second); e.Filename != file || e.Err != nil {
+		t.Fatalf("incorrect event: %+v", e)
+	}
+}
+
+func TestInvalidCfg(t *testing.T) {
+	cfgs := []Cfg{
+		{PollInterval: 0},
+		{PollInterval: PollMax + 1},
+		{PollInterval: PollMin, Backend: Backend(10)},
+	}
+	for _, cfg := range cfgs {
+		if _, err := New(&cfg); err == nil {
+			t.Fatalf("New(%+v) passed; expected failure", cfg)
+		}
+	}
+}
+
+func TestEventKinds(t *testing.T) {
+	for _, backend := range []Backend{BackendPoll, BackendInotify} {
+		dir := t.TempDir()
+		file := dir + "/file"
+		modOnly := dir + "/modOnly"
+
+		for _, f := range []string{file, modOnly} {
+			if err := os.WriteFile(f, []byte("data"), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		cfg := Cfg{
+			EventBufSize: 10,
+			PollInterval: 50 * time.Millisecond,
+			Backend:      backend,
+			KeepWatching: true,
+		}
+		fm, err := New(&cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		fm.Add(file, EventAll)
+		fm.Add(modOnly, EventModify)
+		fileEvents := fm.Events()
+
+		// the poller needs a chance to take a snapshot of the file
+		time.Sleep(2 * cfg.PollInterval)
+
+		steps := []struct {
+			op   func() error
+			kind EventKind
+		}{
+			{func() error { return os.WriteFile(file, []byte("more data"), 0644) }, EventModify},
+			{func() error { return os.Chmod(file, 0600) }, EventAttrib},
+			{func() error {
+				if err := os.WriteFile(dir+"/new", []byte("new"), 0600); err != nil {
+					return err
+				}
+				return os.Rename(dir+"/new", file)
+			}, EventRename},
+			{func() error { return os.Remove(file) }, EventRemove},
+			{func() error { return os.WriteFile(file, []byte("again"), 0644) }, EventCreate},
+			{func() error { return os.WriteFile(modOnly, []byte("modified"), 0644) }, EventModify},
+		}
+
+		for i, step := range steps {
+			if err := step.op(); err != nil {
+				t.Fatal(err)
+			}
+			e := waitEvent(t, fileEvents, time.Second)
+			if e.Err != nil || e.Kind != step.kind {
+				t.Fatalf("backend %d, step %d: want %s event, got %+v", backend, i, step.kind, e)
+			}
+
+			// a write may be reported as several modifications (also
+			// when it follows the creation of the file)
+			for _, e := range drainEvents(fileEvents, 2*cfg.PollInterval) {
+				if e.Kind != EventModify || step.kind&(EventModify|EventCreate) == 0 {
+					t.Fatalf("backend %d, step %d: unexpected event %+v", backend, i, e)
+				}
+			}
+		}
+
+		// removal is not in the mask for modOnly
+		if err := os.Remove(modOnly); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case events := <-fileEvents:
+			t.Fatalf("backend %d: unexpected events: %+v", backend, events)
+		case <-time.After(4 * cfg.PollInterval):
+		}
+
+		fm.Close()
+	}
+}
+
+func TestEventKindString(t *testing.T) {
+	tests := map[EventKind]string{
+		0:                         "none",
+		EventRemove:               "remove",
+		EventModify | EventAttrib: "modify|attrib",
+		EventAll:                  "remove|create|modify|rename|attrib",
+	}
+	for kind, want := range tests {
+		if got := kind.String(); got != want {
+			t.Fatalf("EventKind(%d).String() failed: want %s, got %s", kind, want, got)
+		}
+	}
+}
+
+// waits for events until the given (filename, kind) pairs have been received
+func waitEvents(t *testing.T, fileEvents <-chan []Event, want map[string]EventKind) {
+	timeout := time.After(2 * time.Second)
+	for len(want) > 0 {
+		select {
+		case events := <-fileEvents:
+			for _, e := range events {
+				if e.Err != nil {
+					t.Fatalf("event has error: %+v", e)
+				}
+				kind, found := want[e.Filename]
+				if !found || e.Kind != kind {
+					t.Fatalf("unexpected event: %+v (want %v)", e, want)
+				}
+				delete(want, e.Filename)
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for events %v", want)
+		}
+	}
+}
+
+func TestAddDir(t *testing.T) {
+	for _, backend := range []Backend{BackendPoll, BackendInotify} {
+		for _, recursive := range []bool{false, true} {
+			dir := t.TempDir()
+
+			if err := os.WriteFile(dir+"/existing", []byte("data"), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			cfg := Cfg{
+				EventBufSize: 10,
+				PollInterval: 50 * time.Millisecond,
+				Backend:      backend,
+			}
+			fm, err := New(&cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := fm.AddDir(dir, recursive); err != nil {
+				t.Fatalf("AddDir() failed: %v", err)
+			}
+			fileEvents := fm.Events()
+
+			if err := os.Mkdir(dir+"/sub", 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(dir+"/new", []byte("data"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			waitEvents(t, fileEvents, map[string]EventKind{
+				dir + "/sub": EventCreate,
+				dir + "/new": EventCreate,
+			})
+
+			if err := os.WriteFile(dir+"/sub/file", []byte("data"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Remove(dir + "/existing"); err != nil {
+				t.Fatal(err)
+			}
+
+			want := map[string]EventKind{dir + "/existing": EventRemove}
+			if recursive {
+				want[dir+"/sub/file"] = EventCreate
+			}
+			waitEvents(t, fileEvents, want)
+
+			if recursive {
+				if err := os.Remove(dir + "/sub/file"); err != nil {
+					t.Fatal(err)
+				}
+				waitEvents(t, fileEvents, map[string]EventKind{dir + "/sub/file": EventRemove})
+			}
+
+			// no more events after the dir is removed from the monitor
+			fm.Remove(dir)
+			if err := os.WriteFile(dir+"/another", []byte("data"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if events := drainEvents(fileEvents, 4*cfg.PollInterval); len(events) != 0 {
+				t.Fatalf("unexpected events: %+v", events)
+			}
+
+			fm.Close()
+		}
+	}
+}
+
+func TestAddGlob(t *testing.T) {
+	for _, backend := range []Backend{BackendPoll, BackendInotify} {
+		dir := t.TempDir()
+
+		if err := os.MkdirAll(dir+"/c1/state", 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		cfg := Cfg{
+			EventBufSize: 10,
+			PollInterval: 50 * time.Millisecond,
+			Backend:      backend,
+		}
+		fm, err := New(&cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := fm.AddGlob(dir + "/*/state/*.json"); err != nil {
+			t.Fatalf("AddGlob() failed: %v", err)
+		}
+		fileEvents := fm.Events()
+
+		// matching files, including in a dir created after the glob was added
+		if err := os.WriteFile(dir+"/c1/state/a.json", []byte("{}"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(dir+"/c1/state/a.txt", []byte("{}"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		waitEvents(t, fileEvents, map[string]EventKind{dir + "/c1/state/a.json": EventCreate})
+
+		if err := os.MkdirAll(dir+"/c2/state", 0755); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(2 * cfg.PollInterval)
+		if err := os.WriteFile(dir+"/c2/state/b.json", []byte("{}"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		waitEvents(t, fileEvents, map[string]EventKind{dir + "/c2/state/b.json": EventCreate})
+
+		if err := os.RemoveAll(dir + "/c1"); err != nil {
+			t.Fatal(err)
+		}
+		waitEvents(t, fileEvents, map[string]EventKind{dir + "/c1/state/a.json": EventRemove})
+
+		fm.Close()
+	}
+
+	// negative testing
+	fm, err := New(&Cfg{PollInterval: PollMin})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fm.AddGlob("/tmp/[bad"); err == nil {
+		t.Fatalf("AddGlob() with bad pattern passed; expected failure")
+	}
+	if err := fm.AddDir("/nonexistent/dir", false); err == nil {
+		t.Fatalf("AddDir() on nonexistent dir passed; expected failure")
+	}
+	fm.Close()
+}
+
+func TestGlobDirs(t *testing.T) {
+	dir := t.TempDir()
+
+	for _, d := range []string{"/a/x/c", "/b/y", "/c"} {
+		if err := os.MkdirAll(dir+d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		pattern string
+		dirs    []string
+	}{
+		{dir + "/a/x/c/file", []string{dir + "/a/x/c"}},
+		{dir + "/*.json", []string{dir}},
+		{dir + "/*/*/c/*.json", []string{dir, dir + "/a", dir + "/b", dir + "/c", dir + "/a/x", dir + "/b/y", dir + "/a/x/c"}},
+	}
+
+	for _, test := range tests {
+		got := globDirs(test.pattern)
+		slices.Sort(got)
+		slices.Sort(test.dirs)
+		if !slices.Equal(got, test.dirs) {
+			t.Fatalf("globDirs(%s) failed: want %v, got %v", test.pattern, test.dirs, got)
+		}
+	}
+}
+
+func TestCloseIdempotent(t *testing.T) {
+	for _, backend := range []Backend{BackendPoll, BackendInotify} {
+		file, err := os.CreateTemp(t.TempDir(), "fileMonTest")
+		if err != nil {
+			t.Fatal(err)
+		}
+		file.Close()
+
+		fm, err := New(&Cfg{PollInterval: 50 * time.Millisecond, Backend: backend, EventBufSize: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		sub := fm.Subscribe(&SubscribeOpts{EventBufSize: 1})
+
+		fm.Add(file.Name())
+
+		fm.Close()
+		fm.Close()
+
+		if events, ok := <-fm.Events(); !ok || len(events) != 0 {
+			t.Fatalf("Events() channel did not get a final empty batch on Close() (ok = %v, events = %v)", ok, events)
+		}
+		if _, ok := <-sub.Events(); ok {
+			t.Fatalf("subscription channel not closed on Close()")
+		}
+
+		// subscribing or adding files after close must not block or panic
+		if _, ok := <-fm.Subscribe(&SubscribeOpts{}).Events(); ok {
+			t.Fatalf("subscription channel not closed after Close()")
+		}
+		fm.Add(file.Name())
+	}
+}
+
+func TestCloseFullChannel(t *testing.T) {
+	fm, err := New(&Cfg{PollInterval: 50 * time.Millisecond, EventBufSize: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// fill the Events() channel; the final empty batch is dropped rather than
+	// left pending on a consumer that's not reading
+	fm.defaultSub.eventCh <- []Event{{Filename: "x"}}
+	fm.Close()
+
+	if events := <-fm.Events(); len(events) != 1 {
+		t.Fatalf("Events() failed: want the pending batch, got %v", events)
+	}
+	select {
+	case events := <-fm.Events():
+		t.Fatalf("Events() failed: want no final batch with a full channel, got %v", events)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestCoalesce(t *testing.T) {
+	for _, backend := range []Backend{BackendPoll, BackendInotify} {
+		file, err := os.CreateTemp(t.TempDir(), "fileMonTest")
+		if err != nil {
+			t.Fatal(err)
+		}
+		file.Close()
+
+		cfg := Cfg{
+			EventBufSize:   10,
+			PollInterval:   20 * time.Millisecond,
+			Backend:        backend,
+			CoalesceWindow: 500 * time.Millisecond,
+		}
+		fm, err := New(&cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		fm.Add(file.Name(), EventAll)
+
+		for i := 0; i < 3; i++ {
+			if err := os.WriteFile(file.Name(), []byte(fmt.Sprintf("data %d", i)), 0644); err != nil {
+				t.Fatal(err)
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+		if err := os.Chmod(file.Name(), 0640); err != nil {
+			t.Fatal(err)
+		}
+
+		events := drainEvents(fm.Events(), time.Second)
+		if len(events) != 1 {
+			t.Fatalf("coalescing failed (backend %d): want 1 event, got %+v", backend, events)
+		}
+		if events[0].Kind != EventModify|EventAttrib {
+			t.Fatalf("coalescing failed (backend %d): want kind %v, got %v", backend, EventModify|EventAttrib, events[0].Kind)
+		}
+
+		fm.Close()
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	dir := t.TempDir()
+	fileA := dir + "/a"
+	fileB := dir + "/b"
+	for _, f := range []string{fileA, fileB} {
+		if err := os.WriteFile(f, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fm, err := New(&Cfg{EventBufSize: 10, PollInterval: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fm.Close()
+
+	modSub := fm.Subscribe(&SubscribeOpts{EventBufSize: 10, Mask: EventModify})
+	bSub := fm.Subscribe(&SubscribeOpts{
+		EventBufSize: 10,
+		Filter:       func(e Event) bool { return e.Filename == fileB },
+	})
+	gone := fm.Subscribe(&SubscribeOpts{EventBufSize: 10})
+
+	gone.Unsubscribe()
+	gone.Unsubscribe()
+	if _, ok := <-gone.Events(); ok {
+		t.Fatalf("channel not closed on Unsubscribe()")
+	}
+
+	fm.Add(fileA, EventAll)
+	fm.Add(fileB, EventAll)
+
+	if err := os.WriteFile(fileA, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	waitEvents(t, modSub.Events(), map[string]EventKind{fileA: EventModify})
+	waitEvents(t, fm.Events(), map[string]EventKind{fileA: EventModify})
+
+	if err := os.Remove(fileB); err != nil {
+		t.Fatal(err)
+	}
+	waitEvents(t, bSub.Events(), map[string]EventKind{fileB: EventRemove})
+	waitEvents(t, fm.Events(), map[string]EventKind{fileB: EventRemove})
+
+	if events := drainEvents(modSub.Events(), 200*time.Millisecond); len(events) != 0 {
+		t.Fatalf("masked subscription got unexpected events: %+v", events)
+	}
+	if events := drainEvents(bSub.Events(), 200*time.Millisecond); len(events) != 0 {
+		t.Fatalf("filtered subscription got unexpected events: %+v", events)
+	}
+}
+
+func TestNonBlocking(t *testing.T) {
+	dir := t.TempDir()
+
+	cfg := Cfg{
+		EventBufSize: 1,
+		PollInterval: 20 * time.Millisecond,
+		NonBlocking:  true,
+	}
+	fm, err := New(&cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fm.Close()
+
+	// nobody reads the events; the monitor must not block
+	for i := 0; i < 5; i++ {
+		file := fmt.Sprintf("%s/file%d", dir, i)
+		if err := os.WriteFile(file, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		fm.Add(file)
+		if err := os.Remove(file); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	fm.mu.Lock()
+	numFiles := len(fm.fileTable)
+	fm.mu.Unlock()
+	if numFiles != 0 {
+		t.Fatalf("monitor blocked: want 0 files, got %d", numFiles)
+	}
+	if fm.Dropped() == 0 {
+		t.Fatalf("Dropped() failed: want > 0, got 0")
+	}
+	if len(fm.Events()) != 1 {
+		t.Fatalf("want 1 buffered event batch, got %d", len(fm.Events()))
+	}
+}
+
+// overwrites the given file with the given data (same size), keeping its mtime;
+// the monitor can't check the file in the meantime.
+func writeSameMtime(t *testing.T, fm *FileMon, file string, data string) {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+
+	fi, err := os.Stat(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(file, fi.ModTime(), fi.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	for _, backend := range []Backend{BackendPoll, BackendInotify} {
+		dir := t.TempDir()
+		plain := dir + "/plain"
+		summed := dir + "/summed"
+		for _, f := range []string{plain, summed} {
+			if err := os.WriteFile(f, []byte("aaaa"), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		cfg := Cfg{
+			EventBufSize: 10,
+			PollInterval: 20 * time.Millisecond,
+			Backend:      backend,
+		}
+		fm, err := New(&cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// both files are polled, so the write to the one without a checksum
+		// (same size and mtime) goes unnoticed
+		fm.AddWithOpts(plain, &WatchOpts{Mask: EventModify, Poll: true})
+		fm.AddWithOpts(summed, &WatchOpts{Mask: EventModify, Poll: true, Checksum: true})
+
+		writeSameMtime(t, fm, plain, "bbbb")
+		writeSameMtime(t, fm, summed, "bbbb")
+
+		waitEvents(t, fm.Events(), map[string]EventKind{summed: EventModify})
+		if events := drainEvents(fm.Events(), 200*time.Millisecond); len(events) != 0 {
+			t.Fatalf("unexpected events (backend %d): %+v", backend, events)
+		}
+
+		// replacing the file is a modification when renames are not watched
+		if err := os.WriteFile(dir+"/new", []byte("cccc"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Rename(dir+"/new", plain); err != nil {
+			t.Fatal(err)
+		}
+		waitEvents(t, fm.Events(), map[string]EventKind{plain: EventModify})
+
+		fm.Close()
+	}
+}
+
+func TestForcedPoll(t *testing.T) {
+	file, err := os.CreateTemp(t.TempDir(), "fileMonTest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	cfg := Cfg{
+		EventBufSize: 10,
+		PollInterval: 20 * time.Millisecond,
+		Backend:      BackendInotify,
+	}
+	fm, err := New(&cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fm.Close()
+
+	fm.Add(file.Name(), EventModify)
+	fm.AddWithOpts(file.Name(), &WatchOpts{Poll: true})
+
+	fm.mu.Lock()
+	fi := fm.fileTable[file.Name()]
+	polled, wds, mask := fi.polled, len(fi.wds), fi.mask
+	fm.mu.Unlock()
+
+	if !polled || wds != 0 {
+		t.Fatalf("AddWithOpts() failed: want polled file without watches, got polled=%v, %d watches", polled, wds)
+	}
+	if mask != EventModify|EventRemove {
+		t.Fatalf("AddWithOpts() failed: want mask %v, got %v", EventModify|EventRemove, mask)
+	}
+
+	if err := os.WriteFile(file.Name(), []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	waitEvents(t, fm.Events(), map[string]EventKind{file.Name(): EventModify})
+
+	if err := os.Remove(file.Name()); err != nil {
+		t.Fatal(err)
+	}
+	waitEvents(t, fm.Events(), map[string]EventKind{file.Name(): EventRemove})
+}
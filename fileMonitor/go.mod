@@ -6,4 +6,4 @@ toolchain go1.21.0
 
 require github.com/sirupsen/logrus v1.9.4
 
-require golang.org/x/sys v0.19.0 // indirect
+require golang.org/x/sys v0.19.0
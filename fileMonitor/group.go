@@ -0,0 +1,333 @@
+//
+// Copyright 2026 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package fileMonitor
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// A group of files monitored together: the entries of a dir (AddDir()) or the
+// files matching a glob pattern (AddGlob()). Entries that appear are added to
+// the file table (and reported as created); entries that disappear are
+// reported as removed.
+type watchGroup struct {
+	key       string           // dir or glob pattern (as passed to AddDir() / AddGlob())
+	dir       string           // dir whose entries are monitored (AddDir() only)
+	pattern   string           // glob pattern (AddGlob() only)
+	recursive bool             // monitor the entries of subdirs too (AddDir() only)
+	mask      EventKind        // events to report for the entries
+	members   map[string]bool  // entries found in the last scan
+	dirs      map[string]int32 // dirs watched with inotify (and their watch descriptors)
+	polled    bool             // the group is scanned every poll interval
+}
+
+// AddDir starts monitoring the entries of the given dir (and of its subdirs if
+// recursive is set) for the given events (EventCreate and EventRemove if none
+// are given). Entries that exist when the dir is added are not reported as
+// created.
+func (fm *FileMon) AddDir(dir string, recursive bool, mask ...EventKind) error {
+
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+
+	g := &watchGroup{
+		key:       dir,
+		dir:       filepath.Clean(dir),
+		recursive: recursive,
+		mask:      eventMask(mask, EventCreate|EventRemove),
+	}
+
+	return fm.addGroup(g)
+}
+
+// AddGlob starts monitoring the files matching the given glob pattern (see
+// filepath.Match() for the syntax) for the given events (EventCreate and
+// EventRemove if none are given). Files that match when the pattern is added
+// are not reported as created.
+func (fm *FileMon) AddGlob(pattern string, mask ...EventKind) error {
+
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return fmt.Errorf("invalid glob pattern %s: %s", pattern, err)
+	}
+
+	g := &watchGroup{
+		key:     pattern,
+		pattern: filepath.Clean(pattern),
+		mask:    eventMask(mask, EventCreate|EventRemove),
+	}
+
+	return fm.addGroup(g)
+}
+
+func (fm *FileMon) addGroup(g *watchGroup) error {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+
+	if _, found := fm.groupTable[g.key]; found {
+		return fmt.Errorf("%s is already monitored", g.key)
+	}
+
+	g.members = make(map[string]bool)
+	g.dirs = make(map[string]int32)
+	g.polled = fm.cfg.Backend != BackendInotify
+
+	fm.groupTable[g.key] = g
+
+	if _, err := fm.scanGroup(g, true); err != nil {
+		fm.removeGroup(g)
+		return err
+	}
+
+	fm.start()
+	return nil
+}
+
+// removeGroup stops monitoring the given group and the files it added; must be
+// called with fm.mu held.
+func (fm *FileMon) removeGroup(g *watchGroup) {
+	for m := range g.members {
+		if fi, found := fm.fileTable[m]; found && fi.group == g {
+			fm.removeFile(m)
+		}
+	}
+	for dir := range g.dirs {
+		fm.rmGroupWatch(g, dir)
+	}
+	delete(fm.groupTable, g.key)
+}
+
+// match returns the current entries of the group, and the dirs in which
+// entries may appear.
+func (g *watchGroup) match() ([]string, []string, error) {
+	if g.pattern != "" {
+		members, err := filepath.Glob(g.pattern)
+		return members, globDirs(g.pattern), err
+	}
+
+	members := []string{}
+	dirs := []string{g.dir}
+
+	err := filepath.WalkDir(g.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// entries may vanish while walking
+			if path != g.dir && errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if path == g.dir {
+			return nil
+		}
+		members = append(members, path)
+		if d.IsDir() {
+			if !g.recursive {
+				return filepath.SkipDir
+			}
+			dirs = append(dirs, path)
+		}
+		return nil
+	})
+
+	// the dir itself may be gone
+	if errors.Is(err, fs.ErrNotExist) {
+		return []string{}, []string{}, nil
+	}
+
+	return members, dirs, err
+}
+
+// globDirs returns the existing dirs in which files matching the given glob
+// pattern may appear (either directly or as a result of a new subdir being
+// created), starting at the deepest dir in the pattern without wildcards.
+func globDirs(pattern string) []string {
+	comps := strings.Split(pattern, string(filepath.Separator))
+
+	// comps[:i] is the longest prefix without wildcards
+	i := 0
+	for i < len(comps)-1 && !hasMeta(comps[i]) {
+		i++
+	}
+
+	dirs := []string{}
+	for ; i < len(comps); i++ {
+		level := strings.Join(comps[:i], string(filepath.Separator))
+		if i == 0 {
+			level = "."
+		} else if level == "" {
+			level = string(filepath.Separator)
+		}
+		matches, _ := filepath.Glob(level)
+		for _, m := range matches {
+			if fi, err := os.Stat(m); err == nil && fi.IsDir() {
+				dirs = append(dirs, m)
+			}
+		}
+	}
+	return dirs
+}
+
+func hasMeta(s string) bool {
+	return strings.ContainsAny(s, `*?[\`)
+}
+
+// scanGroup looks for entries that appeared or disappeared in the given group
+// and returns the corresponding events (none on the initial scan). Must be
+// called with fm.mu held.
+func (fm *FileMon) scanGroup(g *watchGroup, initial bool) ([]Event, error) {
+
+	members, dirs, err := g.match()
+	if err != nil {
+		return nil, err
+	}
+
+	// Watch new dirs before looking at their entries, so that no entries
+	// are missed; rescan if there were new dirs.
+	if fm.refreshGroupWatches(g, dirs) {
+		if members, _, err = g.match(); err != nil {
+			return nil, err
+		}
+	}
+
+	eventList := []Event{}
+	curr := make(map[string]bool, len(members))
+
+	for _, m := range members {
+		curr[m] = true
+		if _, found := fm.fileTable[m]; found {
+			continue
+		}
+		fm.addFile(m, WatchOpts{Mask: g.mask}, g)
+		if !initial && g.mask&EventCreate != 0 {
+			eventList = append(eventList, Event{Filename: m, Kind: EventCreate})
+		}
+	}
+
+	for m := range g.members {
+		if curr[m] {
+			continue
+		}
+		if fi, found := fm.fileTable[m]; found && fi.group == g {
+			if e := fm.checkFile(m, 0); e != nil {
+				eventList = append(eventList, *e)
+			}
+		}
+	}
+
+	g.members = curr
+	return eventList, nil
+}
+
+// scanGroups scans the monitored groups (all of them, or only those that are
+// polled) and returns the resulting events.
+func scanGroups(fm *FileMon, all bool) []Event {
+	eventList := []Event{}
+
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+
+	for _, g := range fm.groupTable {
+		if !all && !g.polled {
+			continue
+		}
+		eventList = append(eventList, fm.rescanGroup(g)...)
+	}
+
+	return eventList
+}
+
+// rescanGroup scans the given group; if the scan fails, the group is no
+// longer monitored and the error is reported. Must be called with fm.mu held.
+func (fm *FileMon) rescanGroup(g *watchGroup) []Event {
+	events, err := fm.scanGroup(g, false)
+	if err != nil {
+		fm.removeGroup(g)
+		return []Event{{Filename: g.key, Kind: EventRemove, Err: err}}
+	}
+	return events
+}
+
+// refreshGroupWatches makes sure the given dirs (and only those) are watched
+// with inotify for the given group; returns true if new watches were added.
+// If a watch can't be added, the group is polled. Must be called with fm.mu
+// held.
+func (fm *FileMon) refreshGroupWatches(g *watchGroup, dirs []string) bool {
+	if fm.cfg.Backend != BackendInotify {
+		return false
+	}
+
+	want := make(map[string]bool, len(dirs))
+	for _, dir := range dirs {
+		want[dir] = true
+	}
+
+	for dir := range g.dirs {
+		if !want[dir] {
+			fm.rmGroupWatch(g, dir)
+		}
+	}
+
+	added := false
+	for dir := range want {
+		if _, found := g.dirs[dir]; found {
+			continue
+		}
+		wd, err := unix.InotifyAddWatch(fm.inotifyFd, dir, inotifyGroupMask)
+		if err != nil {
+			g.polled = true
+			continue
+		}
+		g.dirs[dir] = int32(wd)
+		fm.groupWds[int32(wd)] = append(fm.groupWds[int32(wd)], g)
+		added = true
+	}
+
+	return added
+}
+
+// rmGroupWatch removes the inotify watch of the given group on the given dir;
+// must be called with fm.mu held.
+func (fm *FileMon) rmGroupWatch(g *watchGroup, dir string) {
+	wd := g.dirs[dir]
+	delete(g.dirs, dir)
+
+	groups := fm.groupWds[wd]
+	for i, other := range groups {
+		if other == g {
+			groups = append(groups[:i], groups[i+1:]...)
+			break
+		}
+	}
+	if len(groups) > 0 {
+		fm.groupWds[wd] = groups
+	} else {
+		delete(fm.groupWds, wd)
+	}
+
+	fm.releaseWd(wd)
+}
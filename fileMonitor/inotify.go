@@ -0,0 +1,447 @@
+//
+// Copyright 2026 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package fileMonitor
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// Inotify events watched on a file: the file's inode is deleted or moved, or
+// its attributes (including the link count) change. IN_MODIFY is added when
+// modifications are monitored.
+const inotifyFileMask = unix.IN_DELETE_SELF | unix.IN_MOVE_SELF | unix.IN_ATTRIB | unix.IN_MASK_ADD
+
+// Inotify events watched on the ancestor dirs of a file: renaming or removing
+// any of them takes the file off its path without an event on the file itself.
+const inotifyParentMask = unix.IN_DELETE_SELF | unix.IN_MOVE_SELF | unix.IN_ONLYDIR | unix.IN_MASK_ADD
+
+// Inotify events watched on the parent dir of a file that does not exist
+// (waiting for it to be created).
+const inotifyDirMask = unix.IN_CREATE | unix.IN_MOVED_TO | unix.IN_DELETE_SELF | unix.IN_MOVE_SELF |
+	unix.IN_ONLYDIR | unix.IN_MASK_ADD
+
+// Inotify events watched on the dirs of a dir or glob group
+const inotifyGroupMask = unix.IN_CREATE | unix.IN_DELETE | unix.IN_MOVED_FROM | unix.IN_MOVED_TO |
+	unix.IN_DELETE_SELF | unix.IN_MOVE_SELF | unix.IN_ONLYDIR | unix.IN_MASK_ADD
+
+const inotifyBufSize = 64 * 1024
+
+func (fm *FileMon) inotifyInit() error {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return fmt.Errorf("inotify_init failed: %s", err)
+	}
+
+	wakeFd, err := unix.Eventfd(0, unix.EFD_CLOEXEC|unix.EFD_NONBLOCK)
+	if err != nil {
+		unix.Close(fd)
+		return fmt.Errorf("failed to create eventfd: %s", err)
+	}
+
+	fm.inotifyFd = fd
+	fm.wakeFd = wakeFd
+	return nil
+}
+
+// inotifyClose releases the inotify resources; must be called with fm.mu held.
+func (fm *FileMon) inotifyClose() {
+	if fm.inotifyFd >= 0 {
+		unix.Close(fm.inotifyFd)
+		fm.inotifyFd = -1
+	}
+	if fm.wakeFd >= 0 {
+		unix.Close(fm.wakeFd)
+		fm.wakeFd = -1
+	}
+}
+
+// wake wakes up the monitor thread; must be called with fm.mu held.
+func (fm *FileMon) wake() {
+	if fm.wakeFd >= 0 {
+		one := []byte{1, 0, 0, 0, 0, 0, 0, 0}
+		unix.Write(fm.wakeFd, one)
+	}
+}
+
+// addWatch adds an inotify watch for the given file; if the file is a
+// symlink, the symlink itself is watched too (so that its removal is
+// detected). The ancestor dirs of the file (and of its symlink target) are
+// watched too, since their rename or removal takes the file away without an
+// event on it. If the file does not exist and Cfg.KeepWatching is set, its
+// parent dir is watched instead. Must be called with fm.mu held.
+func (fm *FileMon) addWatch(file string, fi *fileInfo) error {
+	var st unix.Stat_t
+
+	if err := unix.Stat(file, &st); err != nil {
+		if !errors.Is(err, unix.ENOENT) || !fm.cfg.KeepWatching {
+			return err
+		}
+		wd, err := unix.InotifyAddWatch(fm.inotifyFd, filepath.Dir(file), inotifyDirMask)
+		if err != nil {
+			return err
+		}
+		fm.attachWatch(file, fi, int32(wd))
+		fi.dirWatch = true
+		return nil
+	}
+
+	mask := uint32(inotifyFileMask)
+	if fi.mask&EventModify != 0 {
+		mask |= unix.IN_MODIFY
+	}
+
+	wd, err := unix.InotifyAddWatch(fm.inotifyFd, file, mask)
+	if err != nil {
+		return err
+	}
+	fm.attachWatch(file, fi, int32(wd))
+
+	var lst unix.Stat_t
+	if err := unix.Lstat(file, &lst); err == nil && lst.Mode&unix.S_IFMT == unix.S_IFLNK {
+		wd, err := unix.InotifyAddWatch(fm.inotifyFd, file, mask|unix.IN_DONT_FOLLOW)
+		if err != nil {
+			fm.rmWatch(file, fi)
+			return err
+		}
+		fm.attachWatch(file, fi, int32(wd))
+	}
+
+	// best effort; changes of ancestors that can't be watched are only
+	// noticed when the file itself changes (or on an inotify queue overflow)
+	paths := []string{file}
+	if target, err := filepath.EvalSymlinks(file); err == nil && target != file {
+		paths = append(paths, target)
+	}
+	for _, path := range paths {
+		for dir := filepath.Dir(path); dir != filepath.Dir(dir); dir = filepath.Dir(dir) {
+			if wd, err := unix.InotifyAddWatch(fm.inotifyFd, dir, inotifyParentMask); err == nil {
+				fm.attachWatch(file, fi, int32(wd))
+			}
+		}
+	}
+
+	fi.dirWatch = false
+	fi.watchDev = st.Dev
+	fi.watchIno = st.Ino
+	return nil
+}
+
+// rearm makes sure the inotify watch of the given file is on the right inode
+// (the file itself, or its parent dir while the file does not exist). If the
+// watch can't be set up, the file is polled. Must be called with fm.mu held.
+func (fm *FileMon) rearm(file string, fi *fileInfo) {
+	if len(fi.wds) > 0 {
+		if fi.state.exists && !fi.dirWatch && fi.watchDev == fi.state.dev && fi.watchIno == fi.state.ino {
+			return
+		}
+		if !fi.state.exists && fi.dirWatch {
+			return
+		}
+	}
+
+	fm.rmWatch(file, fi)
+	if err := fm.addWatch(file, fi); err != nil {
+		fi.polled = true
+		return
+	}
+	fi.polled = false
+	fi.retryWatch = false
+}
+
+// attachWatch associates the given watch descriptor with the given file (the
+// kernel returns the same descriptor for paths that refer to the same inode).
+func (fm *FileMon) attachWatch(file string, fi *fileInfo, wd int32) {
+	fi.wds = append(fi.wds, wd)
+	fm.wdTable[wd] = append(fm.wdTable[wd], file)
+}
+
+// rmWatch removes the inotify watches of the given file (unless they are
+// shared with other monitored files). Must be called with fm.mu held.
+func (fm *FileMon) rmWatch(file string, fi *fileInfo) {
+	for _, wd := range fi.wds {
+		files := fm.wdTable[wd]
+		for i, f := range files {
+			if f == file {
+				files = append(files[:i], files[i+1:]...)
+				break
+			}
+		}
+		if len(files) > 0 {
+			fm.wdTable[wd] = files
+			continue
+		}
+		delete(fm.wdTable, wd)
+		fm.releaseWd(wd)
+	}
+	fi.wds = nil
+}
+
+// releaseWd removes the given inotify watch if no file or group uses it; must
+// be called with fm.mu held.
+func (fm *FileMon) releaseWd(wd int32) {
+	if len(fm.wdTable[wd]) == 0 && len(fm.groupWds[wd]) == 0 {
+		unix.InotifyRmWatch(fm.inotifyFd, uint32(wd))
+	}
+}
+
+// Monitors files associated with the given FileMon instance (inotify backend).
+// Files that could not be watched with inotify are polled.
+func inotifyMon(fm *FileMon) {
+	defer fm.wg.Done()
+
+	fm.mu.Lock()
+	fds := []unix.PollFd{
+		{Fd: int32(fm.inotifyFd), Events: unix.POLLIN},
+		{Fd: int32(fm.wakeFd), Events: unix.POLLIN},
+	}
+	fm.mu.Unlock()
+
+	lastPoll := time.Now()
+
+	for {
+		// checked under the lock (see Close()) so that the stop wake up is
+		// not lost if it's consumed while handling a previous one
+		fm.mu.Lock()
+		if fm.closed {
+			fm.running = false
+			fm.mu.Unlock()
+			return
+		}
+		fm.mu.Unlock()
+
+		timeout := -1
+		if fm.hasPolledFiles() {
+			timeout = int((fm.cfg.PollInterval - time.Since(lastPoll)).Milliseconds())
+			if timeout < 0 {
+				timeout = 0
+			}
+		}
+
+		_, pollErr := unix.Poll(fds, timeout)
+		if errors.Is(pollErr, unix.EINTR) {
+			pollErr = nil
+		}
+
+		select {
+		case <-fm.stopCh:
+			fm.mu.Lock()
+			fm.running = false
+			fm.mu.Unlock()
+			return
+		default:
+		}
+
+		eventList := []Event{}
+
+		if pollErr != nil {
+			eventList = fm.failAll(fmt.Errorf("poll on inotify fd failed: %s", pollErr))
+		} else {
+			if fds[1].Revents&unix.POLLIN != 0 {
+				buf := make([]byte, 8)
+				unix.Read(fm.wakeFd, buf)
+			}
+			if fds[0].Revents&unix.POLLIN != 0 {
+				eventList = append(eventList, fm.readInotifyEvents()...)
+			}
+			if time.Since(lastPoll) >= fm.cfg.PollInterval {
+				eventList = append(eventList, checkFiles(fm)...)
+				eventList = append(eventList, scanGroups(fm, false)...)
+				lastPoll = time.Now()
+			}
+		}
+
+		fm.dispatch(eventList)
+
+		if fm.stopIfIdle() {
+			return
+		}
+	}
+}
+
+// hasPolledFiles returns true if any of the monitored files (or groups) is
+// polled.
+func (fm *FileMon) hasPolledFiles() bool {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+
+	for _, fi := range fm.fileTable {
+		if fi.polled {
+			return true
+		}
+	}
+	for _, g := range fm.groupTable {
+		if g.polled {
+			return true
+		}
+	}
+	return false
+}
+
+// failAll reports the given error for all monitored files and stops
+// monitoring them.
+func (fm *FileMon) failAll(err error) []Event {
+	eventList := []Event{}
+
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+
+	for filename := range fm.fileTable {
+		eventList = append(eventList, Event{Filename: filename, Kind: EventRemove, Err: err})
+		fm.removeFile(filename)
+	}
+	for _, g := range fm.groupTable {
+		fm.removeGroup(g)
+	}
+	return eventList
+}
+
+// readInotifyEvents reads the pending inotify events and checks the affected
+// files; returns the resulting events.
+func (fm *FileMon) readInotifyEvents() []Event {
+	buf := make([]byte, inotifyBufSize)
+	wds := map[int32]uint32{}
+	ignored := map[int32]bool{}
+	overflow := false
+
+	for {
+		n, err := unix.Read(fm.inotifyFd, buf)
+		if err != nil || n <= 0 {
+			break
+		}
+		for off := 0; off+unix.SizeofInotifyEvent <= n; {
+			ev := (*unix.InotifyEvent)(unsafe.Pointer(&buf[off]))
+			switch {
+			case ev.Mask&unix.IN_Q_OVERFLOW != 0:
+				overflow = true
+			case ev.Mask&unix.IN_IGNORED != 0:
+				ignored[ev.Wd] = true
+			default:
+				wds[ev.Wd] |= ev.Mask
+			}
+			off += unix.SizeofInotifyEvent + int(ev.Len)
+		}
+	}
+
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+
+	// files to check, along with the changes known from the events
+	files := map[string]EventKind{}
+	mark := func(filename string, hint EventKind) {
+		files[filename] |= hint
+	}
+
+	if overflow {
+		// events were lost; check all watched files
+		for filename, fi := range fm.fileTable {
+			if !fi.polled {
+				mark(filename, 0)
+			}
+		}
+	}
+
+	for wd, mask := range wds {
+		for _, filename := range fm.wdTable[wd] {
+			hint := EventKind(0)
+			if fi := fm.fileTable[filename]; fi != nil && mask&unix.IN_MODIFY != 0 && !fi.dirWatch {
+				hint = EventModify
+			}
+			mark(filename, hint)
+		}
+	}
+
+	// groups to rescan
+	groups := map[*watchGroup]bool{}
+	for wd := range wds {
+		for _, g := range fm.groupWds[wd] {
+			groups[g] = true
+		}
+	}
+
+	// the kernel removed these watches (e.g., the inode was deleted)
+	for wd := range ignored {
+		for _, filename := range fm.wdTable[wd] {
+			mark(filename, 0)
+			if fi, found := fm.fileTable[filename]; found {
+				fi.wds = removeWd(fi.wds, wd)
+			}
+		}
+		delete(fm.wdTable, wd)
+
+		for _, g := range fm.groupWds[wd] {
+			groups[g] = true
+			for dir, dirWd := range g.dirs {
+				if dirWd == wd {
+					delete(g.dirs, dir)
+				}
+			}
+		}
+		delete(fm.groupWds, wd)
+	}
+
+	if overflow {
+		for _, g := range fm.groupTable {
+			groups[g] = true
+		}
+	}
+
+	eventList := []Event{}
+	for filename, hint := range files {
+		if e := fm.checkWatchedFile(filename, hint); e != nil {
+			eventList = append(eventList, *e)
+		}
+	}
+	for g := range groups {
+		if fm.groupTable[g.key] == g {
+			eventList = append(eventList, fm.rescanGroup(g)...)
+		}
+	}
+	return eventList
+}
+
+// checkWatchedFile checks the given (inotify watched) file for changes and
+// returns the corresponding event; the file's watch is re-armed if needed
+// (e.g., the file was replaced). Must be called with fm.mu held.
+func (fm *FileMon) checkWatchedFile(filename string, hint EventKind) *Event {
+	fi, found := fm.fileTable[filename]
+	if !found || fi.polled {
+		return nil
+	}
+
+	e := fm.checkFile(filename, hint)
+
+	if fm.fileTable[filename] == fi {
+		fm.rearm(filename, fi)
+	}
+
+	return e
+}
+
+func removeWd(wds []int32, wd int32) []int32 {
+	for i, w := range wds {
+		if w == wd {
+			return append(wds[:i], wds[i+1:]...)
+		}
+	}
+	return wds
+}
@@ -17,82 +17,72 @@
 package fileMonitor
 
 import (
-	"os"
 	"time"
 )
 
-// Monitors files associated with the given FileMon instance
+// Monitors files associated with the given FileMon instance (polling backend)
 func fileMon(fm *FileMon) {
 	ticker := time.NewTicker(fm.cfg.PollInterval)
-	eventList := []Event{}
-
-	defer func() {
-		fm.mu.Lock()
-		fm.running = false
-		fm.mu.Unlock()
-		ticker.Stop()
-	}()
+	defer ticker.Stop()
+	defer fm.wg.Done()
 
 	for {
 		select {
 		case <-fm.stopCh:
-			fm.eventCh <- eventList
-			return
-		case <-ticker.C:
-			checkFiles(fm, eventList)
 			fm.mu.Lock()
-			fileTableEmpty := len(fm.fileTable) == 0
+			fm.running = false
 			fm.mu.Unlock()
-			if fileTableEmpty {
-				// no files to monitor
+			return
+		case <-ticker.C:
+			eventList := checkFiles(fm)
+			eventList = append(eventList, scanGroups(fm, true)...)
+
+			// send event list without holding the lock (in case the event
+			// channel is blocked); this way new files can continue to be
+			// added.
+			fm.dispatch(eventList)
+
+			if fm.stopIfIdle() {
 				return
 			}
 		}
 	}
 }
 
-func checkFiles(fm *FileMon, eventList []Event) {
-	rmList := []Event{}
-
+// stopIfIdle marks the monitor thread as stopped if there are no files (or
+// dirs or glob patterns) to monitor; returns true in that case.
+func (fm *FileMon) stopIfIdle() bool {
 	fm.mu.Lock()
-	for filename := range fm.fileTable {
-		exists, err := checkFileExists(filename)
-		if err != nil || !exists {
-			eventList = append(eventList, Event{
-				Filename: filename,
-				Err:      err,
-			})
+	defer fm.mu.Unlock()
 
-			// file removal implies event won't hit again; remove it.
-			rmList = append(rmList, Event{filename, nil})
-		}
+	if len(fm.fileTable) == 0 && len(fm.groupTable) == 0 {
+		fm.running = false
+		return true
 	}
+	return false
+}
 
-	// release the lock so that we don't hold it while sending the event list
-	// (in case the event channel is blocked); this way new events can
-	// continue to be added.
-	fm.mu.Unlock()
-
-	// send event list
-	if len(eventList) > 0 {
-		fm.eventCh <- eventList
-	}
+// checkFiles polls the files that are not watched with inotify, and returns
+// the resulting events.
+func checkFiles(fm *FileMon) []Event {
+	eventList := []Event{}
 
-	// remove events that won't hit any more
 	fm.mu.Lock()
-	for _, e := range rmList {
-		delete(fm.fileTable, e.Filename)
-	}
-	fm.mu.Unlock()
-}
+	defer fm.mu.Unlock()
 
-// Checks if the given file exists
-func checkFileExists(path string) (bool, error) {
-	_, err := os.Stat(path)
-	if os.IsNotExist(err) {
-		return false, nil
-	} else if err != nil {
-		return false, err
+	for filename, fi := range fm.fileTable {
+		if !fi.polled {
+			continue
+		}
+		if e := fm.checkFile(filename, 0); e != nil {
+			eventList = append(eventList, *e)
+		}
+
+		// switch to inotify if possible (e.g., the file was created)
+		if fi.retryWatch && fm.fileTable[filename] == fi {
+			fm.rearm(filename, fi)
+		}
 	}
-	return true, nil
+
+	return eventList
 }
@@ -3,6 +3,7 @@ module github.com/nestybox/sysbox-libs/linuxUtils
 go 1.21
 
 require (
+	github.com/nestybox/sysbox-libs/pidfd v0.0.0-00010101000000-000000000000
 	github.com/opencontainers/runtime-spec v1.0.2
 	github.com/sirupsen/logrus v1.9.4
 	github.com/spf13/afero v1.4.1
@@ -11,3 +12,5 @@ require (
 )
 
 require golang.org/x/text v0.3.8 // indirect
+
+replace github.com/nestybox/sysbox-libs/pidfd => ../pidfd
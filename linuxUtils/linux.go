@@ -30,6 +30,7 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/nestybox/sysbox-libs/pidfd"
 	specs "github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/afero"
@@ -377,6 +378,52 @@ func CreateUsernsProcess(idMap *specs.LinuxIDMapping, execFunc func(), cwd strin
 	return int(pid), childKillFunc, nil
 }
 
+// CloneOpts holds the options for CreateProcess().
+type CloneOpts struct {
+	Flags      uint64         // namespace flags (CLONE_NEW*)
+	Cgroup     string         // cgroup v2 dir the child is placed in ("" means the caller's cgroup)
+	ExitSignal syscall.Signal // signal sent to the caller when the child exits (SIGCHLD if 0)
+}
+
+// CreateProcess creates a process with clone3(), with the given namespace
+// flags and directly into the given cgroup (if any), that executes the given
+// program (see execve(2); argv includes the program name). Returns the pid of
+// the new process along with a pidfd for it (which the caller must close), so
+// that the caller can signal and wait for the child without pid reuse races.
+//
+// Unlike CreateUsernsProcess(), no Go code runs in the child: it only sets
+// its parent death signal (SIGKILL) before executing the program. Any setup
+// the child needs must be done by the program itself.
+func CreateProcess(opts *CloneOpts, path string, argv, envv []string) (int, pidfd.PidFd, error) {
+
+	args := &pidfd.CloneArgs{
+		Flags:      opts.Flags,
+		ExitSignal: opts.ExitSignal,
+		Pdeathsig:  unix.SIGKILL,
+	}
+	if args.ExitSignal == 0 {
+		args.ExitSignal = unix.SIGCHLD
+	}
+
+	if opts.Cgroup != "" {
+		cgFd, err := unix.Open(opts.Cgroup, unix.O_PATH|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+		if err != nil {
+			return -1, -1, fmt.Errorf("failed to open cgroup %s: %s", opts.Cgroup, err)
+		}
+		defer unix.Close(cgFd)
+
+		args.Flags |= unix.CLONE_INTO_CGROUP
+		args.CgroupFd = cgFd
+	}
+
+	pid, pidFd, err := pidfd.Clone3(args, path, argv, envv)
+	if err != nil {
+		return -1, -1, fmt.Errorf("failed to create process %s: %w", path, err)
+	}
+
+	return pid, pidFd, nil
+}
+
 func BinfmtMiscNamespacingSupported() (bool, error) {
 
 	// Kernel support for binfmt_misc namespacing appeared in kernel 6.7
@@ -17,9 +17,13 @@
 package linuxUtils
 
 import (
+	"errors"
+	"os/exec"
+	"syscall"
 	"testing"
 
 	"github.com/spf13/afero"
+	"golang.org/x/sys/unix"
 )
 
 func TestMain(m *testing.M) {
@@ -146,3 +150,33 @@ blah
 		})
 	}
 }
+
+func TestCreateProcess(t *testing.T) {
+
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skipf("sh not found: %s", err)
+	}
+
+	// the child changes its hostname, which requires a new uts ns (and
+	// CAP_SYS_ADMIN)
+	argv := []string{"sh", "-c", "echo create-process-test > /proc/sys/kernel/hostname && exit 5"}
+
+	pid, pidFd, err := CreateProcess(&CloneOpts{Flags: unix.CLONE_NEWUTS}, sh, argv, nil)
+	if errors.Is(err, unix.ENOSYS) || errors.Is(err, unix.EPERM) {
+		t.Skipf("CreateProcess() not supported: %s", err)
+	}
+	if err != nil {
+		t.Fatalf("CreateProcess() failed: %s", err)
+	}
+	defer pidFd.Close()
+
+	var ws syscall.WaitStatus
+	wpid, err := pidFd.Waitid(&ws, unix.WEXITED, nil)
+	if err != nil || wpid != pid {
+		t.Fatalf("Waitid() failed: want pid %d, got %d (%v)", pid, wpid, err)
+	}
+	if !ws.Exited() || ws.ExitStatus() != 5 {
+		t.Fatalf("CreateProcess() failed: want exit status 5, got %#x", ws)
+	}
+}
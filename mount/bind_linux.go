@@ -0,0 +1,231 @@
+//
+// Copyright 2026 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package mount
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// BindOpts configures BindMount().
+type BindOpts struct {
+	Recursive   bool // bind the whole mount tree below the source (MS_REC)
+	Flags       int  // per-mount flags (MS_RDONLY, MS_NOSUID, MS_NODEV, MS_NOEXEC, MS_NOATIME, etc.)
+	Propagation int  // MS_SHARED, MS_SLAVE, MS_PRIVATE or MS_UNBINDABLE (zero keeps the default)
+}
+
+const atimeFlags = unix.MS_NOATIME | unix.MS_RELATIME | unix.MS_STRICTATIME
+
+// BindMount bind mounts source on target with the given options, and returns
+// the resulting mount (as read back from the mount table).
+//
+// On kernels that support it, the bind mount is created detached (open_tree(2)),
+// configured (mount_setattr(2)) and only then attached (move_mount(2)), so the
+// mount never shows up with the wrong flags or propagation. On older kernels,
+// it falls back to mount(2) followed by a bind remount, preserving the flags
+// that are locked on the source mount (e.g., "nodev" inside a user namespace).
+func BindMount(source, target string, opts *BindOpts) (*Info, error) {
+
+	if opts == nil {
+		opts = &BindOpts{}
+	}
+
+	attrs, sbParams, err := mountFlagsToAttrs(opts.Flags)
+	if err != nil || len(sbParams) > 0 {
+		return nil, fmt.Errorf("invalid bind mount flags %#x", opts.Flags)
+	}
+	if opts.Propagation&^propagationFlags != 0 || opts.Propagation&(opts.Propagation-1) != 0 {
+		return nil, fmt.Errorf("invalid propagation flags %#x", opts.Propagation)
+	}
+
+	target, err = filepath.Abs(target)
+	if err != nil {
+		return nil, err
+	}
+
+	// MS_SLAVE only yields a slave mount if the source is in a peer group
+	srcShared := false
+	if opts.Propagation == unix.MS_SLAVE {
+		src, err := GetMountOf(source)
+		if err != nil {
+			return nil, err
+		}
+		srcShared = src.Shared != 0
+	}
+
+	err = bindMountNew(source, target, attrs, opts)
+	if errors.Is(err, unix.ENOSYS) {
+		err = bindMountLegacy(source, target, opts)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return verifyBindMount(target, opts, srcShared)
+}
+
+// bindMountNew creates the bind mount with open_tree(2), mount_setattr(2) and
+// move_mount(2).
+func bindMountNew(source, target string, attrs int, opts *BindOpts) error {
+
+	mnt, err := OpenTree(source, opts.Recursive)
+	if err != nil {
+		return err
+	}
+	defer mnt.Close()
+
+	attr := &unix.MountAttr{
+		Attr_set:    uint64(attrs),
+		Propagation: uint64(opts.Propagation),
+	}
+	if opts.Flags&atimeFlags != 0 {
+		attr.Attr_clr = unix.MOUNT_ATTR__ATIME
+	}
+
+	if *attr != (unix.MountAttr{}) {
+		if err := mnt.SetAttr(attr, opts.Recursive); err != nil {
+			return err
+		}
+	}
+
+	return mnt.MoveTo(target)
+}
+
+// bindMountLegacy creates the bind mount with mount(2).
+func bindMountLegacy(source, target string, opts *BindOpts) error {
+
+	recFlag := 0
+	if opts.Recursive {
+		recFlag = unix.MS_REC
+	}
+
+	if err := unix.Mount(source, target, "", uintptr(unix.MS_BIND|recFlag), ""); err != nil {
+		return fmt.Errorf("failed to bind mount %s to %s: %w", source, target, err)
+	}
+
+	if opts.Flags != 0 {
+		if err := remountBind(target, opts); err != nil {
+			unix.Unmount(target, unix.MNT_DETACH)
+			return err
+		}
+	}
+
+	if opts.Propagation != 0 {
+		if err := unix.Mount("", target, "", uintptr(opts.Propagation|recFlag), ""); err != nil {
+			unix.Unmount(target, unix.MNT_DETACH)
+			return fmt.Errorf("failed to set propagation on %s: %w", target, err)
+		}
+	}
+
+	return nil
+}
+
+// remountBind applies the given per-mount flags to the bind mount at target
+// (and its submounts if recursive), keeping the flags already set on each
+// mount (some of which may be locked and can't be cleared).
+func remountBind(target string, opts *BindOpts) error {
+
+	mounts, err := GetMounts()
+	if err != nil {
+		return err
+	}
+
+	tree := NewMountTree(mounts)
+
+	node := tree.LookupPath(target)
+	if node == nil {
+		return fmt.Errorf("bind mount on %s not found", target)
+	}
+
+	nodes := []*MountNode{node}
+	if opts.Recursive {
+		for _, sub := range tree.Submounts(target) {
+			if !tree.IsOvermounted(sub) {
+				nodes = append(nodes, sub)
+			}
+		}
+	}
+
+	for _, n := range nodes {
+		flags := optToFlag(strings.Split(n.Info.Opts, ","))
+		if opts.Flags&atimeFlags != 0 {
+			flags &^= atimeFlags
+		}
+		flags |= opts.Flags | unix.MS_REMOUNT | unix.MS_BIND
+
+		if err := unix.Mount("", n.Info.Mountpoint, "", uintptr(flags), ""); err != nil {
+			return fmt.Errorf("failed to remount %s: %w", n.Info.Mountpoint, err)
+		}
+	}
+
+	return nil
+}
+
+// verifyBindMount checks that the mount at target has the requested flags and
+// propagation, and returns its info. If it doesn't, the mount is removed.
+// srcShared indicates if the source mount was in a peer group (otherwise
+// MS_SLAVE leaves the mount private).
+func verifyBindMount(target string, opts *BindOpts, srcShared bool) (*Info, error) {
+
+	mounts, err := GetMounts()
+	if err != nil {
+		return nil, err
+	}
+
+	node := NewMountTree(mounts).LookupPath(target)
+	if node == nil {
+		return nil, fmt.Errorf("bind mount on %s not found in the mount table", target)
+	}
+	m := node.Info
+
+	// MS_RELATIME is the kernel default and may not be listed in the options;
+	// MS_STRICTATIME is never listed (it shows as neither noatime nor relatime).
+	want := opts.Flags &^ (unix.MS_RELATIME | unix.MS_STRICTATIME)
+	got := optToFlag(strings.Split(m.Opts, ","))
+	if opts.Flags&unix.MS_STRICTATIME != 0 && got&(unix.MS_NOATIME|unix.MS_RELATIME) != 0 {
+		unix.Unmount(target, unix.MNT_DETACH)
+		return nil, fmt.Errorf("bind mount on %s has options %q; want strictatime", target, m.Opts)
+	}
+	if got&want != want {
+		unix.Unmount(target, unix.MNT_DETACH)
+		return nil, fmt.Errorf("bind mount on %s has options %q; missing flags %#x", target, m.Opts, want&^got)
+	}
+
+	var propOk bool
+	switch opts.Propagation {
+	case 0:
+		propOk = true
+	case unix.MS_SHARED:
+		propOk = m.Shared != 0
+	case unix.MS_SLAVE:
+		propOk = m.Shared == 0 && (m.Master != 0 || !srcShared)
+	case unix.MS_PRIVATE:
+		propOk = m.Shared == 0 && m.Master == 0 && !m.Unbindable
+	case unix.MS_UNBINDABLE:
+		propOk = m.Unbindable
+	}
+	if !propOk {
+		unix.Unmount(target, unix.MNT_DETACH)
+		return nil, fmt.Errorf("bind mount on %s has propagation %q; want %#x", target, m.Optional, opts.Propagation)
+	}
+
+	return m, nil
+}
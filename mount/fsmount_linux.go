@@ -0,0 +1,409 @@
+//
+// Copyright 2026 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Wrappers for the Linux "new mount API" (fsopen(2), fsconfig(2), fsmount(2),
+// open_tree(2), move_mount(2), mount_setattr(2)), available in kernel 5.2+
+// (mount_setattr in 5.12+).
+
+package mount
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// FsContext is a filesystem configuration context, as returned by fsopen(2).
+type FsContext struct {
+	fd     int
+	fstype string
+}
+
+// FsOpen creates a configuration context for a new filesystem instance of the
+// given type.
+func FsOpen(fstype string) (*FsContext, error) {
+	fd, err := unix.Fsopen(fstype, unix.FSOPEN_CLOEXEC)
+	if err != nil {
+		return nil, fmt.Errorf("fsopen %s failed: %w", fstype, err)
+	}
+	return &FsContext{fd: fd, fstype: fstype}, nil
+}
+
+// SetFlag sets a flag parameter (e.g., "ro") on the filesystem context.
+func (c *FsContext) SetFlag(key string) error {
+	if err := unix.FsconfigSetFlag(c.fd, key); err != nil {
+		return c.errorf(err, "failed to set %s flag %q", c.fstype, key)
+	}
+	return nil
+}
+
+// SetString sets a string parameter (e.g., "source") on the filesystem context.
+func (c *FsContext) SetString(key, val string) error {
+	if err := unix.FsconfigSetString(c.fd, key, val); err != nil {
+		return c.errorf(err, "failed to set %s option %s=%s", c.fstype, key, val)
+	}
+	return nil
+}
+
+// SetPath sets a path parameter on the filesystem context.
+func (c *FsContext) SetPath(key, path string) error {
+	if err := unix.FsconfigSetPath(c.fd, key, path, unix.AT_FDCWD); err != nil {
+		return c.errorf(err, "failed to set %s path option %s=%s", c.fstype, key, path)
+	}
+	return nil
+}
+
+// SetFd sets a file descriptor parameter on the filesystem context.
+func (c *FsContext) SetFd(key string, fd int) error {
+	if err := unix.FsconfigSetFd(c.fd, key, fd); err != nil {
+		return c.errorf(err, "failed to set %s fd option %s=%d", c.fstype, key, fd)
+	}
+	return nil
+}
+
+// Create creates the filesystem superblock from the configured parameters.
+func (c *FsContext) Create() error {
+	if err := unix.FsconfigCreate(c.fd); err != nil {
+		return c.errorf(err, "failed to create %s superblock", c.fstype)
+	}
+	return nil
+}
+
+// Mount creates a detached mount for the filesystem superblock (Create() must
+// have been called). The attributes are MOUNT_ATTR_* flags.
+func (c *FsContext) Mount(attrs int) (*DetachedMount, error) {
+	fd, err := unix.Fsmount(c.fd, unix.FSMOUNT_CLOEXEC, attrs)
+	if err != nil {
+		return nil, c.errorf(err, "fsmount %s failed", c.fstype)
+	}
+	return &DetachedMount{fd: fd}, nil
+}
+
+// Close releases the filesystem context.
+func (c *FsContext) Close() error {
+	return unix.Close(c.fd)
+}
+
+// Log returns the messages logged by the kernel on the filesystem context
+// (e.g., "e tmpfs: Unknown parameter 'foo'").
+func (c *FsContext) Log() []string {
+	msgs := []string{}
+	buf := make([]byte, 4096)
+
+	for {
+		n, err := unix.Read(c.fd, buf)
+		if err != nil || n <= 0 {
+			break
+		}
+		msgs = append(msgs, strings.TrimSpace(string(buf[:n])))
+	}
+	return msgs
+}
+
+// errorf returns an error that wraps err and includes the kernel's fs context
+// log messages (if any).
+func (c *FsContext) errorf(err error, format string, args ...interface{}) error {
+	msg := fmt.Sprintf(format, args...)
+	if log := c.Log(); len(log) > 0 {
+		return fmt.Errorf("%s: %w (%s)", msg, err, strings.Join(log, "; "))
+	}
+	return fmt.Errorf("%s: %w", msg, err)
+}
+
+// DetachedMount is a mount that is not attached to the filesystem tree, as
+// returned by fsmount(2) or open_tree(2).
+type DetachedMount struct {
+	fd int
+}
+
+// OpenTree returns a detached clone of the mount at the given path (or of the
+// whole mount tree below it, if recursive is set).
+func OpenTree(path string, recursive bool) (*DetachedMount, error) {
+	flags := uint(unix.OPEN_TREE_CLONE | unix.OPEN_TREE_CLOEXEC)
+	if recursive {
+		flags |= unix.AT_RECURSIVE
+	}
+
+	fd, err := unix.OpenTree(unix.AT_FDCWD, path, flags)
+	if err != nil {
+		return nil, fmt.Errorf("open_tree on %s failed: %w", path, err)
+	}
+	return &DetachedMount{fd: fd}, nil
+}
+
+// Fd returns the file descriptor of the detached mount.
+func (m *DetachedMount) Fd() int {
+	return m.fd
+}
+
+// SetAttr sets the given attributes on the detached mount (and on all mounts
+// below it if recursive is set).
+func (m *DetachedMount) SetAttr(attr *unix.MountAttr, recursive bool) error {
+	flags := uint(unix.AT_EMPTY_PATH)
+	if recursive {
+		flags |= unix.AT_RECURSIVE
+	}
+	if err := unix.MountSetattr(m.fd, "", flags, attr); err != nil {
+		return fmt.Errorf("mount_setattr failed: %w", err)
+	}
+	return nil
+}
+
+// MoveTo attaches the detached mount at the given target path.
+func (m *DetachedMount) MoveTo(target string) error {
+	if err := unix.MoveMount(m.fd, "", unix.AT_FDCWD, target, unix.MOVE_MOUNT_F_EMPTY_PATH); err != nil {
+		return fmt.Errorf("move_mount to %s failed: %w", target, err)
+	}
+	return nil
+}
+
+// Close releases the detached mount; if it was not attached with MoveTo(),
+// it's unmounted.
+func (m *DetachedMount) Close() error {
+	return unix.Close(m.fd)
+}
+
+// SetAttr sets the given attributes on the mount at the given path (and on all
+// mounts below it if recursive is set).
+func SetAttr(path string, attr *unix.MountAttr, recursive bool) error {
+	flags := uint(0)
+	if recursive {
+		flags |= unix.AT_RECURSIVE
+	}
+	if err := unix.MountSetattr(unix.AT_FDCWD, path, flags, attr); err != nil {
+		return fmt.Errorf("mount_setattr on %s failed: %w", path, err)
+	}
+	return nil
+}
+
+// MoveMount moves the mount at the given source path to the target path.
+func MoveMount(source, target string) error {
+	if err := unix.MoveMount(unix.AT_FDCWD, source, unix.AT_FDCWD, target, 0); err != nil {
+		return fmt.Errorf("move_mount from %s to %s failed: %w", source, target, err)
+	}
+	return nil
+}
+
+// Per-mount flags (MS_*) and their mount attribute (MOUNT_ATTR_*) equivalent
+var mountFlagToAttr = map[int]int{
+	unix.MS_RDONLY:      unix.MOUNT_ATTR_RDONLY,
+	unix.MS_NOSUID:      unix.MOUNT_ATTR_NOSUID,
+	unix.MS_NODEV:       unix.MOUNT_ATTR_NODEV,
+	unix.MS_NOEXEC:      unix.MOUNT_ATTR_NOEXEC,
+	unix.MS_NOATIME:     unix.MOUNT_ATTR_NOATIME,
+	unix.MS_NODIRATIME:  unix.MOUNT_ATTR_NODIRATIME,
+	unix.MS_RELATIME:    unix.MOUNT_ATTR_RELATIME,
+	unix.MS_STRICTATIME: unix.MOUNT_ATTR_STRICTATIME,
+	unix.MS_NOSYMFOLLOW: unix.MOUNT_ATTR_NOSYMFOLLOW,
+}
+
+// Per-superblock flags (MS_*) and their fsconfig(2) flag equivalent
+var sbFlagToParam = map[int]string{
+	unix.MS_SYNCHRONOUS: "sync",
+	unix.MS_DIRSYNC:     "dirsync",
+	unix.MS_LAZYTIME:    "lazytime",
+	unix.MS_MANDLOCK:    "mand",
+}
+
+const propagationFlags = unix.MS_SHARED | unix.MS_SLAVE | unix.MS_PRIVATE | unix.MS_UNBINDABLE
+
+// mountFlagsToAttrs converts MS_* per-mount flags to MOUNT_ATTR_* attributes;
+// returns the per-superblock flags separately. At most one atime flag may be
+// given (the atime attributes are an enum, not a bit-vector).
+func mountFlagsToAttrs(flags int) (int, []string, error) {
+	attrs := 0
+	sbParams := []string{}
+
+	if atime := flags & atimeFlags; atime&(atime-1) != 0 {
+		return 0, nil, fmt.Errorf("conflicting atime mount flags %#x", atime)
+	}
+
+	for flag, attr := range mountFlagToAttr {
+		if flags&flag != 0 {
+			attrs |= attr
+			flags &^= flag
+		}
+	}
+	for flag, param := range sbFlagToParam {
+		if flags&flag != 0 {
+			sbParams = append(sbParams, param)
+			flags &^= flag
+		}
+	}
+	if flags != 0 {
+		return 0, nil, fmt.Errorf("unsupported mount flags %#x", flags)
+	}
+
+	return attrs, sbParams, nil
+}
+
+type builderOpt struct {
+	key  string
+	val  string
+	flag bool
+}
+
+// Builder mounts a filesystem using the new mount API, falling back to
+// mount(2) on kernels that don't support it. E.g.,
+//
+//	err := mount.NewBuilder("tmpfs", "tmpfs").
+//		SetOption("size", "64m").
+//		SetMountFlags(unix.MS_NOSUID | unix.MS_NODEV).
+//		SetPropagation(unix.MS_PRIVATE).
+//		MountAt("/mnt")
+type Builder struct {
+	fstype      string
+	source      string
+	opts        []builderOpt
+	flags       int
+	propagation int
+}
+
+// NewBuilder returns a builder for a mount of the given filesystem type and
+// source.
+func NewBuilder(fstype, source string) *Builder {
+	return &Builder{
+		fstype: fstype,
+		source: source,
+	}
+}
+
+// SetOption sets a filesystem specific option (e.g., "lowerdir" for overlayfs).
+func (b *Builder) SetOption(key, val string) *Builder {
+	b.opts = append(b.opts, builderOpt{key: key, val: val})
+	return b
+}
+
+// SetFlag sets a filesystem specific flag option (e.g., "volatile" for
+// overlayfs).
+func (b *Builder) SetFlag(key string) *Builder {
+	b.opts = append(b.opts, builderOpt{key: key, flag: true})
+	return b
+}
+
+// SetMountFlags sets the MS_* mount flags (e.g., MS_RDONLY, MS_NOSUID,
+// MS_NOATIME, MS_SYNCHRONOUS). Flags that modify the mount operation itself
+// (e.g., MS_BIND, MS_REMOUNT) and propagation flags are not accepted.
+func (b *Builder) SetMountFlags(flags int) *Builder {
+	b.flags = flags
+	return b
+}
+
+// SetPropagation sets the propagation type of the mount (MS_SHARED, MS_SLAVE,
+// MS_PRIVATE or MS_UNBINDABLE).
+func (b *Builder) SetPropagation(propagation int) *Builder {
+	b.propagation = propagation
+	return b
+}
+
+// MountAt mounts the filesystem at the given target path.
+func (b *Builder) MountAt(target string) error {
+
+	attrs, sbParams, err := mountFlagsToAttrs(b.flags)
+	if err != nil {
+		return err
+	}
+	if b.propagation&^propagationFlags != 0 {
+		return fmt.Errorf("invalid propagation flags %#x", b.propagation)
+	}
+
+	err = b.mountNew(target, attrs, sbParams)
+	if errors.Is(err, unix.ENOSYS) {
+		return b.mountLegacy(target)
+	}
+	return err
+}
+
+// mountNew performs the mount with fsopen(2), fsconfig(2), fsmount(2) and
+// move_mount(2).
+func (b *Builder) mountNew(target string, attrs int, sbParams []string) error {
+
+	fsCtx, err := FsOpen(b.fstype)
+	if err != nil {
+		return err
+	}
+	defer fsCtx.Close()
+
+	if b.source != "" {
+		if err := fsCtx.SetString("source", b.source); err != nil {
+			return err
+		}
+	}
+
+	for _, param := range sbParams {
+		if err := fsCtx.SetFlag(param); err != nil {
+			return err
+		}
+	}
+
+	for _, opt := range b.opts {
+		if opt.flag {
+			err = fsCtx.SetFlag(opt.key)
+		} else {
+			err = fsCtx.SetString(opt.key, opt.val)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := fsCtx.Create(); err != nil {
+		return err
+	}
+
+	mnt, err := fsCtx.Mount(attrs)
+	if err != nil {
+		return err
+	}
+	defer mnt.Close()
+
+	if b.propagation != 0 {
+		attr := &unix.MountAttr{Propagation: uint64(b.propagation)}
+		if err := mnt.SetAttr(attr, false); err != nil {
+			return err
+		}
+	}
+
+	return mnt.MoveTo(target)
+}
+
+// mountLegacy performs the mount with mount(2).
+func (b *Builder) mountLegacy(target string) error {
+
+	data := []string{}
+	for _, opt := range b.opts {
+		if opt.flag {
+			data = append(data, opt.key)
+		} else {
+			data = append(data, opt.key+"="+opt.val)
+		}
+	}
+
+	if err := unix.Mount(b.source, target, b.fstype, uintptr(b.flags), strings.Join(data, ",")); err != nil {
+		return fmt.Errorf("failed to mount %s (%s) at %s: %w", b.source, b.fstype, target, err)
+	}
+
+	if b.propagation != 0 {
+		if err := unix.Mount("", target, "", uintptr(b.propagation), ""); err != nil {
+			unix.Unmount(target, unix.MNT_DETACH)
+			return fmt.Errorf("failed to set propagation on %s: %w", target, err)
+		}
+	}
+
+	return nil
+}
@@ -4,7 +4,9 @@ import (
 	"fmt"
 )
 
-// GetMounts retrieves a list of mounts for the current running process.
+// GetMounts retrieves a list of mounts for the current running process. It uses
+// the listmount(2) / statmount(2) syscalls when available, and falls back to
+// parsing /proc/self/mountinfo otherwise.
 func GetMounts() ([]*Info, error) {
 	return parseMountTable()
 }
@@ -14,6 +16,20 @@ func GetMountsPid(pid uint32) ([]*Info, error) {
 	return parseMountTableForPid(pid)
 }
 
+// GetMountByID returns information about the mount with the given unique
+// mount ID (see Info.UniqueID) in the current mount namespace, without
+// scanning the mount table. Requires kernel support for statmount(2).
+func GetMountByID(uniqueID uint64) (*Info, error) {
+	return getMountByID(uniqueID)
+}
+
+// GetMountOf returns information about the mount on which the given path
+// resides. On kernels without statmount(2) support, this falls back to
+// scanning /proc/self/mountinfo.
+func GetMountOf(path string) (*Info, error) {
+	return getMountOf(path)
+}
+
 func FindMount(mountpoint string, mounts []*Info) bool {
 	for _, m := range mounts {
 		if m.Mountpoint == mountpoint {
@@ -49,7 +65,34 @@ func GetMountAt(mountpoint string, mounts []*Info) (*Info, error) {
 }
 
 // Converts the set of mount options (e.g., "rw", "nodev", etc.) to it's
-// corresponding mount flags representation
+// corresponding mount flags representation. Options are applied in order, so
+// later options override earlier ones (e.g., "ro,rw" yields no MS_RDONLY);
+// propagation options (e.g., "rshared") are included, and unknown options are
+// ignored.
 func OptionsToFlags(opt []string) int {
 	return optToFlag(opt)
 }
+
+// FlagsToOptions converts the given mount flags (including MS_REC and the
+// propagation flags) to their mount options, in the order the kernel lists
+// them in mountinfo. A "rw" option is included when MS_RDONLY is not set.
+func FlagsToOptions(flags int) []string {
+	return flagToOpt(flags)
+}
+
+// ParseOptions parses a comma separated mount option string (e.g.,
+// Info.Opts or Info.VfsOpts) into a map of option name to value; options
+// without a value (e.g., "ro") map to an empty string. Commas escaped with a
+// backslash are not treated as separators, and escapes are removed from the
+// returned names and values.
+func ParseOptions(opts string) map[string]string {
+	return parseOptions(opts)
+}
+
+// SplitOptions splits a comma separated mount option string into the mount
+// flags, the propagation flags, and the filesystem specific data string (as
+// passed to mount(2)). The data string keeps the original option order and
+// escapes.
+func SplitOptions(opts string) (flags int, propagation int, data string) {
+	return splitOptions(opts)
+}
@@ -1,3 +1,4 @@
+//go:build linux
 // +build linux
 
 package mount
@@ -7,9 +8,8 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strconv"
 	"strings"
-
-	"golang.org/x/sys/unix"
 )
 
 const (
@@ -27,24 +27,19 @@ const (
 	   (9) filesystem type:  name of filesystem of the form "type[.subtype]"
 	   (10) mount source:  filesystem specific information or "none"
 	   (11) super options:  per super block options*/
-	mountinfoFormat = "%d %d %d:%d %s %s %s %s"
+	mountinfoFormat = "%d %d %d:%d"
 )
 
-var mountFlagsMap = map[string]int{
-	"ro":          unix.MS_RDONLY,
-	"nodev":       unix.MS_NODEV,
-	"noexec":      unix.MS_NOEXEC,
-	"nosuid":      unix.MS_NOSUID,
-	"noatime":     unix.MS_NOATIME,
-	"nodiratime":  unix.MS_NODIRATIME,
-	"relatime":    unix.MS_RELATIME,
-	"strictatime": unix.MS_STRICTATIME,
-	"sync":        unix.MS_SYNCHRONOUS,
-}
-
-// Parse /proc/self/mountinfo because comparing Dev and ino does not work from
-// bind mounts
+// Get the mount table via listmount(2) / statmount(2) when supported by the
+// kernel; otherwise parse /proc/self/mountinfo because comparing Dev and ino
+// does not work from bind mounts
 func parseMountTable() ([]*Info, error) {
+	if statmountSupported() {
+		if mounts, err := listMountTable(uint32(os.Getpid())); err == nil {
+			return mounts, nil
+		}
+	}
+
 	f, err := os.Open("/proc/self/mountinfo")
 	if err != nil {
 		return nil, err
@@ -56,6 +51,12 @@ func parseMountTable() ([]*Info, error) {
 
 // Same as above function but for a specific pid this time.
 func parseMountTableForPid(pid uint32) ([]*Info, error) {
+	if statmountSupported() {
+		if mounts, err := listMountTable(pid); err == nil {
+			return mounts, nil
+		}
+	}
+
 	f, err := os.Open(fmt.Sprintf("/proc/%d/mountinfo", pid))
 	if err != nil {
 		return nil, err
@@ -76,44 +77,115 @@ func parseInfoFile(r io.Reader) ([]*Info, error) {
 			return nil, err
 		}
 
-		var (
-			p              = &Info{}
-			text           = s.Text()
-			optionalFields string
-		)
-
-		if _, err := fmt.Sscanf(text, mountinfoFormat,
-			&p.ID, &p.Parent, &p.Major, &p.Minor,
-			&p.Root, &p.Mountpoint, &p.Opts, &optionalFields); err != nil {
-			return nil, fmt.Errorf("Scanning '%s' failed: %s", text, err)
+		p, err := parseInfoLine(s.Text())
+		if err != nil {
+			return nil, err
 		}
-		// Safe as mountinfo encodes mountpoints with spaces as \040.
-		index := strings.Index(text, " - ")
-		postSeparatorFields := strings.Fields(text[index+3:])
-		if len(postSeparatorFields) < 3 {
-			return nil, fmt.Errorf("Error found less than 3 fields post '-' in %q", text)
+		out = append(out, p)
+	}
+	return out, nil
+}
+
+func parseInfoLine(text string) (*Info, error) {
+	p := &Info{}
+
+	// Fields are separated by a single space; mountinfo encodes spaces in
+	// paths as \040, so splitting is safe.
+	fields := strings.Split(text, " ")
+
+	sep := -1
+	for i := 6; i < len(fields); i++ {
+		if fields[i] == "-" {
+			sep = i
+			break
 		}
+	}
+	if sep < 0 {
+		return nil, fmt.Errorf("Scanning '%s' failed: missing separator", text)
+	}
+
+	if _, err := fmt.Sscanf(strings.Join(fields[:3], " "), mountinfoFormat,
+		&p.ID, &p.Parent, &p.Major, &p.Minor); err != nil {
+		return nil, fmt.Errorf("Scanning '%s' failed: %s", text, err)
+	}
+
+	p.Root = unescape(fields[3])
+	p.Mountpoint = unescape(fields[4])
+	p.Opts = fields[5]
+
+	if err := parseOptionalFields(p, fields[6:sep]); err != nil {
+		return nil, fmt.Errorf("Scanning '%s' failed: %s", text, err)
+	}
+
+	postSeparatorFields := fields[sep+1:]
+	if len(postSeparatorFields) < 3 {
+		return nil, fmt.Errorf("Error found less than 3 fields post '-' in %q", text)
+	}
 
-		if optionalFields != "-" {
-			p.Optional = optionalFields
+	p.Fstype = postSeparatorFields[0]
+	p.Source = unescape(postSeparatorFields[1])
+	p.VfsOpts = strings.Join(postSeparatorFields[2:], " ")
+
+	return p, nil
+}
+
+// parseOptionalFields parses the mountinfo optional fields (e.g.,
+// "shared:1 master:2") into the given Info.
+func parseOptionalFields(p *Info, optFields []string) error {
+	p.Optional = strings.Join(optFields, " ")
+
+	for _, field := range optFields {
+		tag, val, hasVal := strings.Cut(field, ":")
+
+		var dst *int
+		switch tag {
+		case "shared":
+			dst = &p.Shared
+		case "master":
+			dst = &p.Master
+		case "propagate_from":
+			dst = &p.PropagateFrom
+		case "unbindable":
+			p.Unbindable = true
+			continue
+		default:
+			// unknown tags must be ignored (see proc(5))
+			continue
 		}
 
-		p.Fstype = postSeparatorFields[0]
-		p.Source = postSeparatorFields[1]
-		p.VfsOpts = strings.Join(postSeparatorFields[2:], " ")
-		out = append(out, p)
+		if !hasVal {
+			return fmt.Errorf("optional field %q has no value", field)
+		}
+		id, err := strconv.Atoi(val)
+		if err != nil {
+			return fmt.Errorf("invalid optional field %q: %s", field, err)
+		}
+		*dst = id
 	}
-	return out, nil
+
+	return nil
 }
 
-func optToFlag(opts []string) int {
-	flags := 0
-	for _, opt := range opts {
-		f, ok := mountFlagsMap[opt]
-		if !ok {
+// unescape decodes the octal escapes (e.g., "\040" for space) used by the
+// kernel when reporting paths in mountinfo.
+func unescape(path string) string {
+	if !strings.Contains(path, "\\") {
+		return path
+	}
+
+	buf := make([]byte, 0, len(path))
+	for i := 0; i < len(path); i++ {
+		if path[i] == '\\' && i+3 < len(path) && path[i+1] <= '3' && isOctal(path[i+1]) && isOctal(path[i+2]) && isOctal(path[i+3]) {
+			buf = append(buf, (path[i+1]-'0')<<6|(path[i+2]-'0')<<3|(path[i+3]-'0'))
+			i += 3
 			continue
 		}
-		flags |= f
+		buf = append(buf, path[i])
 	}
-	return flags
+
+	return string(buf)
+}
+
+func isOctal(c byte) bool {
+	return c >= '0' && c <= '7'
 }
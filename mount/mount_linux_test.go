@@ -0,0 +1,848 @@
+//go:build linux
+// +build linux
+
+package mount
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestParseInfoFile(t *testing.T) {
+	mountinfo := strings.Join([]string{
+		`36 35 98:0 /mnt1 /mnt2 rw,noatime master:1 - ext3 /dev/root rw,errors=continue`,
+		`37 36 0:40 / /my\040dir\011tab rw,relatime shared:5 master:3 propagate_from:2 - tmpfs my\040src rw`,
+		`38 36 0:41 /a\134b /unb rw unbindable - tmpfs none rw,size=64k`,
+		`39 36 0:42 / /empty rw - tmpfs  rw`,
+	}, "\n")
+
+	mounts, err := parseInfoFile(strings.NewReader(mountinfo))
+	if err != nil {
+		t.Fatalf("parseInfoFile() failed: %v", err)
+	}
+	if len(mounts) != 4 {
+		t.Fatalf("parseInfoFile() failed: want 4 mounts, got %d", len(mounts))
+	}
+
+	want := []Info{
+		{
+			ID: 36, Parent: 35, Major: 98, Minor: 0,
+			Root: "/mnt1", Mountpoint: "/mnt2", Opts: "rw,noatime",
+			Optional: "master:1", Master: 1,
+			Fstype: "ext3", Source: "/dev/root", VfsOpts: "rw,errors=continue",
+		},
+		{
+			ID: 37, Parent: 36, Major: 0, Minor: 40,
+			Root: "/", Mountpoint: "/my dir\ttab", Opts: "rw,relatime",
+			Optional: "shared:5 master:3 propagate_from:2", Shared: 5, Master: 3, PropagateFrom: 2,
+			Fstype: "tmpfs", Source: "my src", VfsOpts: "rw",
+		},
+		{
+			ID: 38, Parent: 36, Major: 0, Minor: 41,
+			Root: `/a\b`, Mountpoint: "/unb", Opts: "rw",
+			Optional: "unbindable", Unbindable: true,
+			Fstype: "tmpfs", Source: "none", VfsOpts: "rw,size=64k",
+		},
+		{
+			ID: 39, Parent: 36, Major: 0, Minor: 42,
+			Root: "/", Mountpoint: "/empty", Opts: "rw",
+			Fstype: "tmpfs", Source: "", VfsOpts: "rw",
+		},
+	}
+
+	for i, m := range mounts {
+		if *m != want[i] {
+			t.Fatalf("parseInfoFile() failed: want %+v, got %+v", want[i], *m)
+		}
+	}
+
+	// negative testing
+	bad := []string{
+		`36 35 98:0 /mnt1 /mnt2 rw,noatime master:1 ext3 /dev/root rw`,
+		`36 35 98:0 /mnt1 /mnt2 rw,noatime shared:x - ext3 /dev/root rw`,
+		`36 35 98:0 /mnt1 /mnt2 rw,noatime - ext3 /dev/root`,
+		`x 35 98:0 /mnt1 /mnt2 rw,noatime - ext3 /dev/root rw`,
+	}
+
+	for _, line := range bad {
+		if _, err := parseInfoFile(strings.NewReader(line)); err == nil {
+			t.Fatalf("parseInfoFile(%q) passed; expected failure", line)
+		}
+	}
+}
+
+func TestUnescape(t *testing.T) {
+	tests := map[string]string{
+		`/plain`:        "/plain",
+		`/a\040b`:       "/a b",
+		`/a\011b\012c`:  "/a\tb\nc",
+		`/a\134b`:       `/a\b`,
+		`/trailing\04`:  `/trailing\04`,
+		`/not\999octal`: `/not\999octal`,
+		`\040\040`:      "  ",
+	}
+
+	for in, want := range tests {
+		if got := unescape(in); got != want {
+			t.Fatalf("unescape(%q) failed: want %q, got %q", in, want, got)
+		}
+	}
+}
+
+func TestListMountTable(t *testing.T) {
+	if !statmountSupported() {
+		t.Skip("listmount / statmount not supported by the kernel")
+	}
+
+	// a rw bind mount of a ro superblock (only the superblock options of
+	// the bind mount are ro)
+	if os.Geteuid() == 0 {
+		dir := t.TempDir()
+		src, dst := dir+"/src", dir+"/dst"
+		os.Mkdir(src, 0755)
+		os.Mkdir(dst, 0755)
+
+		if err := unix.Mount("tmpfs", src, "tmpfs", 0, ""); err != nil {
+			t.Fatalf("failed to mount tmpfs on %s: %v", src, err)
+		}
+		defer unix.Unmount(src, unix.MNT_DETACH)
+		if err := unix.Mount(src, dst, "", unix.MS_BIND, ""); err != nil {
+			t.Fatalf("failed to bind mount %s on %s: %v", src, dst, err)
+		}
+		defer unix.Unmount(dst, unix.MNT_DETACH)
+		if err := unix.Mount("", src, "", unix.MS_REMOUNT|unix.MS_RDONLY, ""); err != nil {
+			t.Fatalf("failed to remount %s ro: %v", src, err)
+		}
+	}
+
+	statMounts, err := listMountTable(uint32(os.Getpid()))
+	if err != nil {
+		t.Fatalf("listMountTable() failed: %v", err)
+	}
+
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	infoMounts, err := parseInfoFile(f)
+	if err != nil {
+		t.Fatalf("parseInfoFile() failed: %v", err)
+	}
+
+	if len(statMounts) != len(infoMounts) {
+		t.Fatalf("listMountTable() failed: want %d mounts, got %d", len(infoMounts), len(statMounts))
+	}
+
+	for i, m := range statMounts {
+		if m.UniqueID == 0 {
+			t.Fatalf("listMountTable() failed: unique ID not set: %+v", m)
+		}
+		got := *m
+		got.UniqueID = 0
+		if got != *infoMounts[i] {
+			t.Fatalf("listMountTable() failed: want %+v, got %+v", *infoMounts[i], got)
+		}
+	}
+}
+
+func TestMntAttrToOpts(t *testing.T) {
+	tests := []struct {
+		attr uint64
+		want string
+	}{
+		{0, "rw,relatime"},
+		{unix.MOUNT_ATTR_RDONLY | unix.MOUNT_ATTR_NOSUID | unix.MOUNT_ATTR_STRICTATIME, "ro,nosuid"},
+		{unix.MOUNT_ATTR_NODEV | unix.MOUNT_ATTR_NOEXEC, "rw,nodev,noexec,relatime"},
+		{unix.MOUNT_ATTR_NOATIME | unix.MOUNT_ATTR_NODIRATIME | unix.MOUNT_ATTR_NOSYMFOLLOW, "rw,noatime,nodiratime,nosymfollow"},
+	}
+
+	for _, test := range tests {
+		if got := mntAttrToOpts(test.attr); got != test.want {
+			t.Fatalf("mntAttrToOpts(%#x) failed: want %q, got %q", test.attr, test.want, got)
+		}
+	}
+}
+
+func TestGetMountOf(t *testing.T) {
+	m, err := GetMountOf("/proc/self/status")
+	if err != nil {
+		t.Fatalf("GetMountOf() failed: %v", err)
+	}
+	if m.Mountpoint != "/proc" || m.Fstype != "proc" {
+		t.Fatalf("GetMountOf() failed: want /proc (proc), got %s (%s)", m.Mountpoint, m.Fstype)
+	}
+
+	if !statmountSupported() {
+		return
+	}
+
+	m2, err := GetMountByID(m.UniqueID)
+	if err != nil {
+		t.Fatalf("GetMountByID() failed: %v", err)
+	}
+	if *m2 != *m {
+		t.Fatalf("GetMountByID() failed: want %+v, got %+v", *m, *m2)
+	}
+
+	// negative testing
+	if _, err := GetMountByID(0); err == nil {
+		t.Fatalf("GetMountByID(0) passed; expected failure")
+	}
+}
+
+// waits for a mount event of the given type on the given mountpoint
+func waitMountEvent(t *testing.T, w *Watcher, evType MountEventType, mountpoint string) *MountEvent {
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case events := <-w.Events():
+			for _, e := range events {
+				if e.Err != nil {
+					t.Fatalf("watcher reported error: %v", e.Err)
+				}
+				if e.Type == evType && e.Mount.Mountpoint == mountpoint {
+					return &e
+				}
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for %s event on %s", evType, mountpoint)
+		}
+	}
+}
+
+func TestWatcher(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("test requires root")
+	}
+
+	dir := t.TempDir()
+
+	cfg := &WatcherCfg{
+		EventBufSize:   10,
+		RescanInterval: 100 * time.Millisecond,
+	}
+
+	w, err := NewWatcher(uint32(os.Getpid()), cfg)
+	if err != nil {
+		t.Fatalf("NewWatcher() failed: %v", err)
+	}
+	defer w.Close()
+
+	if err := unix.Mount("tmpfs", dir, "tmpfs", 0, ""); err != nil {
+		t.Fatalf("failed to mount tmpfs on %s: %v", dir, err)
+	}
+	defer unix.Unmount(dir, unix.MNT_DETACH)
+	waitMountEvent(t, w, MountAdded, dir)
+
+	// remounts are not notified by the kernel; they are detected on rescan
+
+	if err := unix.Mount("", dir, "", unix.MS_REMOUNT|unix.MS_BIND|unix.MS_RDONLY, ""); err != nil {
+		t.Fatalf("failed to remount %s: %v", dir, err)
+	}
+	e := waitMountEvent(t, w, MountChanged, dir)
+	if !strings.HasPrefix(e.Mount.Opts, "ro") || !strings.HasPrefix(e.Old.Opts, "rw") {
+		t.Fatalf("incorrect mount change event: old opts = %s, new opts = %s", e.Old.Opts, e.Mount.Opts)
+	}
+
+	if err := unix.Unmount(dir, 0); err != nil {
+		t.Fatalf("failed to unmount %s: %v", dir, err)
+	}
+	waitMountEvent(t, w, MountRemoved, dir)
+
+	// Close must be idempotent and close the events channel
+	w.Close()
+	w.Close()
+	for range w.Events() {
+	}
+}
+
+func TestDiffMounts(t *testing.T) {
+	prev := []*Info{
+		{ID: 1, Mountpoint: "/", Opts: "rw"},
+		{ID: 2, Mountpoint: "/a", Opts: "rw"},
+		{ID: 3, Mountpoint: "/b", Opts: "rw"},
+	}
+	curr := []*Info{
+		{ID: 1, Mountpoint: "/", Opts: "ro"},
+		{ID: 3, Mountpoint: "/c", Opts: "rw"}, // ID reused
+		{ID: 4, Mountpoint: "/d", Opts: "rw"},
+	}
+
+	want := []struct {
+		evType     MountEventType
+		mountpoint string
+	}{
+		{MountRemoved, "/a"},
+		{MountRemoved, "/b"},
+		{MountChanged, "/"},
+		{MountAdded, "/c"},
+		{MountAdded, "/d"},
+	}
+
+	events := diffMounts(prev, curr)
+	if len(events) != len(want) {
+		t.Fatalf("diffMounts() failed: want %d events, got %d (%+v)", len(want), len(events), events)
+	}
+	for i, e := range events {
+		if e.Type != want[i].evType || e.Mount.Mountpoint != want[i].mountpoint {
+			t.Fatalf("diffMounts() failed: want %s %s, got %s %s", want[i].evType, want[i].mountpoint, e.Type, e.Mount.Mountpoint)
+		}
+	}
+
+	// snapshots from different backends (statmount vs mountinfo) match
+	withUnique := []*Info{
+		{ID: 1, UniqueID: 0x100000001, Mountpoint: "/", Opts: "ro"},
+		{ID: 3, UniqueID: 0x100000003, Mountpoint: "/c", Opts: "rw"},
+		{ID: 4, UniqueID: 0x100000004, Mountpoint: "/d", Opts: "rw"},
+	}
+	if events := diffMounts(curr, withUnique); len(events) != 0 {
+		t.Fatalf("diffMounts() failed: want no events across backends, got %+v", events)
+	}
+	if events := diffMounts(withUnique, curr); len(events) != 0 {
+		t.Fatalf("diffMounts() failed: want no events across backends, got %+v", events)
+	}
+}
+
+func TestMountFlagsToAttrs(t *testing.T) {
+	attrs, sbParams, err := mountFlagsToAttrs(unix.MS_RDONLY | unix.MS_NOATIME | unix.MS_SYNCHRONOUS)
+	if err != nil || attrs != unix.MOUNT_ATTR_RDONLY|unix.MOUNT_ATTR_NOATIME || !slices.Equal(sbParams, []string{"sync"}) {
+		t.Fatalf("mountFlagsToAttrs() failed: got %#x, %v (%v)", attrs, sbParams, err)
+	}
+
+	// the atime attributes are an enum
+	for _, flags := range []int{unix.MS_NOATIME | unix.MS_STRICTATIME, unix.MS_RELATIME | unix.MS_NOATIME, unix.MS_RELATIME | unix.MS_STRICTATIME} {
+		if _, _, err := mountFlagsToAttrs(flags); err == nil {
+			t.Fatalf("mountFlagsToAttrs(%#x) passed; expected failure", flags)
+		}
+	}
+}
+
+func TestBuilder(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("test requires root")
+	}
+
+	dir := t.TempDir()
+
+	err := NewBuilder("tmpfs", "testsrc").
+		SetOption("size", "1m").
+		SetMountFlags(unix.MS_RDONLY | unix.MS_NOSUID | unix.MS_NODEV).
+		SetPropagation(unix.MS_PRIVATE).
+		MountAt(dir)
+	if err != nil {
+		t.Fatalf("MountAt() failed: %v", err)
+	}
+	defer unix.Unmount(dir, unix.MNT_DETACH)
+
+	m, err := GetMountOf(dir)
+	if err != nil {
+		t.Fatalf("GetMountAt() failed: %v", err)
+	}
+	if m.Fstype != "tmpfs" || m.Source != "testsrc" {
+		t.Fatalf("MountAt() failed: want tmpfs (testsrc), got %s (%s)", m.Fstype, m.Source)
+	}
+	for _, opt := range []string{"ro", "nosuid", "nodev"} {
+		if !strings.Contains(","+m.Opts+",", ","+opt+",") {
+			t.Fatalf("MountAt() failed: want %s in mount opts, got %s", opt, m.Opts)
+		}
+	}
+	if !strings.Contains(m.VfsOpts, "size=1024k") {
+		t.Fatalf("MountAt() failed: want size=1024k in fs opts, got %s", m.VfsOpts)
+	}
+	if m.Shared != 0 || m.Master != 0 {
+		t.Fatalf("MountAt() failed: want private mount, got %q", m.Optional)
+	}
+
+	if err := unix.Unmount(dir, 0); err != nil {
+		t.Fatalf("failed to unmount %s: %v", dir, err)
+	}
+
+	// legacy mount(2) path
+	b := NewBuilder("tmpfs", "testsrc").SetOption("size", "1m").SetMountFlags(unix.MS_NOEXEC)
+	if err := b.mountLegacy(dir); err != nil {
+		t.Fatalf("mountLegacy() failed: %v", err)
+	}
+	m, err = GetMountOf(dir)
+	if err != nil {
+		t.Fatalf("GetMountAt() failed: %v", err)
+	}
+	if !strings.Contains(m.Opts, "noexec") || !strings.Contains(m.VfsOpts, "size=1024k") {
+		t.Fatalf("mountLegacy() failed: got opts %s, fs opts %s", m.Opts, m.VfsOpts)
+	}
+	if err := unix.Unmount(dir, 0); err != nil {
+		t.Fatalf("failed to unmount %s: %v", dir, err)
+	}
+
+	// negative testing: the error must include the kernel's fs context log
+	err = NewBuilder("tmpfs", "testsrc").SetOption("bogus", "1").MountAt(dir)
+	if err == nil {
+		unix.Unmount(dir, unix.MNT_DETACH)
+		t.Fatalf("MountAt() with bogus option passed; expected failure")
+	}
+	if !errors.Is(err, unix.EINVAL) || !strings.Contains(err.Error(), "tmpfs: Unknown parameter 'bogus'") {
+		t.Fatalf("MountAt() failed: error lacks fs context log: %v", err)
+	}
+
+	if err := NewBuilder("tmpfs", "").SetMountFlags(unix.MS_BIND).MountAt(dir); err == nil {
+		t.Fatalf("MountAt() with MS_BIND passed; expected failure")
+	}
+}
+
+func TestOpenTree(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("test requires root")
+	}
+
+	src := t.TempDir()
+	dst := t.TempDir()
+
+	if err := os.WriteFile(src+"/file", []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	mnt, err := OpenTree(src, false)
+	if err != nil {
+		t.Fatalf("OpenTree() failed: %v", err)
+	}
+	defer mnt.Close()
+
+	attr := &unix.MountAttr{Attr_set: unix.MOUNT_ATTR_RDONLY}
+	if err := mnt.SetAttr(attr, false); err != nil {
+		t.Fatalf("SetAttr() failed: %v", err)
+	}
+	if err := mnt.MoveTo(dst); err != nil {
+		t.Fatalf("MoveTo() failed: %v", err)
+	}
+	defer unix.Unmount(dst, unix.MNT_DETACH)
+
+	if data, err := os.ReadFile(dst + "/file"); err != nil || string(data) != "data" {
+		t.Fatalf("bind mount failed: got %q, %v", data, err)
+	}
+	if err := os.WriteFile(dst+"/file", []byte("x"), 0644); err == nil {
+		t.Fatalf("bind mount failed: write to read-only mount passed")
+	}
+
+	// clear the read-only attribute on the attached mount
+	attr = &unix.MountAttr{Attr_clr: unix.MOUNT_ATTR_RDONLY}
+	if err := SetAttr(dst, attr, false); err != nil {
+		t.Fatalf("SetAttr() failed: %v", err)
+	}
+	if err := os.WriteFile(dst+"/file", []byte("x"), 0644); err != nil {
+		t.Fatalf("write after clearing read-only attribute failed: %v", err)
+	}
+}
+
+func TestUnmountTree(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("test requires root")
+	}
+
+	dir := t.TempDir()
+	defer unix.Unmount(dir, unix.MNT_DETACH)
+
+	// dir, dir/a, dir/a/b, dir/a (stacked), dir/c
+	mountpoints := []string{dir, dir + "/a", dir + "/a/b", dir + "/a", dir + "/c"}
+	for _, mp := range mountpoints {
+		if err := os.MkdirAll(mp, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := unix.Mount("tmpfs", mp, "tmpfs", 0, ""); err != nil {
+			t.Fatalf("failed to mount tmpfs on %s: %v", mp, err)
+		}
+		if mp == dir+"/a" {
+			os.Mkdir(mp+"/b", 0755)
+		}
+	}
+
+	// keep dir/c busy
+	f, err := os.Create(dir + "/c/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts := &UnmountOpts{Retries: 2, RetryDelay: 10 * time.Millisecond}
+
+	failed, err := UnmountTree(dir, opts)
+	if err == nil {
+		t.Fatalf("UnmountTree() passed; expected failure on busy mount")
+	}
+	if len(failed) != 2 || failed[0].Mountpoint != dir+"/c" || failed[1].Mountpoint != dir {
+		t.Fatalf("UnmountTree() failed: want %s/c and %s not removed, got %+v", dir, dir, failed)
+	}
+
+	f.Close()
+
+	failed, err = UnmountTree(dir, opts)
+	if err != nil || len(failed) != 0 {
+		t.Fatalf("UnmountTree() failed: %v (%+v)", err, failed)
+	}
+
+	mounts, err := GetMounts()
+	if err != nil {
+		t.Fatalf("GetMounts() failed: %v", err)
+	}
+	tree := NewMountTree(mounts)
+	if node := tree.CoveringMount(dir); node.Info.Mountpoint == dir || len(tree.Submounts(dir)) != 0 {
+		t.Fatalf("UnmountTree() failed: mounts remain at or below %s", dir)
+	}
+
+	// unmounting a tree with no mounts is a no-op
+	if failed, err := UnmountTree(dir, nil); err != nil || len(failed) != 0 {
+		t.Fatalf("UnmountTree() failed: %v (%+v)", err, failed)
+	}
+}
+
+func TestUnmountTreeFlags(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("test requires root")
+	}
+
+	dir := t.TempDir()
+	if err := unix.Mount("tmpfs", dir, "tmpfs", 0, ""); err != nil {
+		t.Fatalf("failed to mount tmpfs on %s: %v", dir, err)
+	}
+	defer unix.Unmount(dir, unix.MNT_DETACH)
+
+	// rejected by the kernel; must not be reported as unmounted
+	for _, flags := range []int{unix.MNT_EXPIRE | unix.MNT_DETACH, unix.MNT_EXPIRE | unix.MNT_FORCE, 0x100} {
+		if _, err := UnmountTree(dir, &UnmountOpts{Flags: flags}); err == nil {
+			t.Fatalf("UnmountTree() with flags %#x passed; expected failure", flags)
+		}
+	}
+
+	mounts, err := GetMounts()
+	if err != nil {
+		t.Fatalf("GetMounts() failed: %v", err)
+	}
+	if !FindMount(dir, mounts) {
+		t.Fatalf("UnmountTree() with invalid flags removed %s", dir)
+	}
+}
+
+func TestUnmountTreeCovered(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("test requires root")
+	}
+
+	dir := t.TempDir()
+	defer unix.Unmount(dir, unix.MNT_DETACH)
+
+	// dir, dir/a, dir/a/b, dir/a (stacked, busy); dir/a/b is hidden by the
+	// stacked mount, so unmounting by path can't reach it.
+	for _, mp := range []string{dir, dir + "/a", dir + "/a/b", dir + "/a"} {
+		if err := os.MkdirAll(mp, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := unix.Mount("tmpfs", mp, "tmpfs", 0, ""); err != nil {
+			t.Fatalf("failed to mount tmpfs on %s: %v", mp, err)
+		}
+		os.Mkdir(mp+"/b", 0755)
+	}
+
+	mounts, err := GetMounts()
+	if err != nil {
+		t.Fatalf("GetMounts() failed: %v", err)
+	}
+	hidden, err := GetMountAt(dir+"/a/b", mounts)
+	if err != nil {
+		t.Fatalf("GetMountAt() failed: %v", err)
+	}
+	hiddenID := hidden.ID
+
+	f, err := os.Create(dir + "/a/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	failed, err := UnmountTree(dir+"/a", &UnmountOpts{})
+	if err == nil {
+		t.Fatalf("UnmountTree() passed; expected failure on busy mount")
+	}
+
+	reported := false
+	for _, m := range failed {
+		if m.ID == hiddenID {
+			reported = true
+		}
+	}
+	if !reported {
+		t.Fatalf("UnmountTree() failed: hidden mount on %s/a/b not reported (got %+v)", dir, failed)
+	}
+
+	mounts, err = GetMounts()
+	if err != nil {
+		t.Fatalf("GetMounts() failed: %v", err)
+	}
+	found := false
+	for _, m := range mounts {
+		if m.ID == hiddenID {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("UnmountTree() failed: hidden mount on %s/a/b is gone", dir)
+	}
+
+	// once the stacked mount is no longer busy, everything goes
+	f.Close()
+	if failed, err := UnmountTree(dir+"/a", nil); err != nil || len(failed) != 0 {
+		t.Fatalf("UnmountTree() failed: %v (%+v)", err, failed)
+	}
+}
+
+func TestBindMount(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("test requires root")
+	}
+
+	src := t.TempDir()
+	dst := t.TempDir()
+
+	if err := os.Mkdir(src+"/sub", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := unix.Mount("tmpfs", src+"/sub", "tmpfs", 0, ""); err != nil {
+		t.Fatalf("failed to mount tmpfs on %s/sub: %v", src, err)
+	}
+	defer unix.Unmount(src+"/sub", unix.MNT_DETACH)
+
+	opts := &BindOpts{
+		Recursive:   true,
+		Flags:       unix.MS_RDONLY | unix.MS_NOSUID | unix.MS_NOATIME,
+		Propagation: unix.MS_PRIVATE,
+	}
+
+	for _, legacy := range []bool{false, true} {
+		var m *Info
+		var err error
+
+		if legacy {
+			if err = bindMountLegacy(src, dst, opts); err == nil {
+				m, err = verifyBindMount(dst, opts, false)
+			}
+		} else {
+			m, err = BindMount(src, dst, opts)
+		}
+		if err != nil {
+			t.Fatalf("BindMount() (legacy = %v) failed: %v", legacy, err)
+		}
+
+		if m.Mountpoint != dst || m.Shared != 0 || m.Master != 0 {
+			t.Fatalf("BindMount() (legacy = %v) failed: got %+v", legacy, *m)
+		}
+
+		// the read-only flag must apply to the submount too
+		for _, path := range []string{dst + "/file", dst + "/sub/file"} {
+			if err := os.WriteFile(path, []byte("x"), 0644); !errors.Is(err, unix.EROFS) {
+				t.Fatalf("BindMount() (legacy = %v) failed: write to %s: want EROFS, got %v", legacy, path, err)
+			}
+		}
+
+		if failed, err := UnmountTree(dst, nil); err != nil {
+			t.Fatalf("UnmountTree() failed: %v (%+v)", err, failed)
+		}
+	}
+
+	// strictatime is not listed in mountinfo, and MS_SLAVE on a source that's
+	// not in a peer group leaves the mount private
+	if err := unix.Mount("", src+"/sub", "", unix.MS_PRIVATE, ""); err != nil {
+		t.Fatalf("failed to make %s/sub private: %v", src, err)
+	}
+	opts = &BindOpts{Flags: unix.MS_STRICTATIME, Propagation: unix.MS_SLAVE}
+	m, err := BindMount(src+"/sub", dst, opts)
+	if err != nil {
+		t.Fatalf("BindMount() with %+v failed: %v", *opts, err)
+	}
+	if m.Shared != 0 || m.Master != 0 || strings.Contains(m.Opts, "atime") {
+		t.Fatalf("BindMount() with %+v failed: got %+v", *opts, *m)
+	}
+	if failed, err := UnmountTree(dst, nil); err != nil {
+		t.Fatalf("UnmountTree() failed: %v (%+v)", err, failed)
+	}
+
+	// negative testing
+	if _, err := BindMount(src, dst, &BindOpts{Flags: unix.MS_SYNCHRONOUS}); err == nil {
+		t.Fatalf("BindMount() with MS_SYNCHRONOUS passed; expected failure")
+	}
+	if _, err := BindMount(src, dst, &BindOpts{Propagation: unix.MS_SHARED | unix.MS_SLAVE}); err == nil {
+		t.Fatalf("BindMount() with multiple propagation flags passed; expected failure")
+	}
+}
+
+func TestParseOptions(t *testing.T) {
+	opts := `rw,lowerdir=/a\,b:/c\054d,upperdir=/up,xino=off,volatile`
+
+	want := map[string]string{
+		"rw":       "",
+		"lowerdir": "/a,b:/c,d",
+		"upperdir": "/up",
+		"xino":     "off",
+		"volatile": "",
+	}
+
+	got := ParseOptions(opts)
+	if len(got) != len(want) {
+		t.Fatalf("ParseOptions() failed: want %v, got %v", want, got)
+	}
+	for k, v := range want {
+		if gotVal, found := got[k]; !found || gotVal != v {
+			t.Fatalf("ParseOptions() failed: want %v, got %v", want, got)
+		}
+	}
+
+	if got := ParseOptions(""); len(got) != 0 {
+		t.Fatalf("ParseOptions() failed: want empty map, got %v", got)
+	}
+}
+
+func TestOptionsToFlags(t *testing.T) {
+	tests := []struct {
+		opts  []string
+		flags int
+	}{
+		{[]string{"ro", "nodev", "unknown"}, unix.MS_RDONLY | unix.MS_NODEV},
+		{[]string{"ro", "nosuid", "rw", "suid"}, 0},
+		{[]string{"rbind", "rshared", "lazytime", "nosymfollow"}, unix.MS_BIND | unix.MS_REC | unix.MS_SHARED | unix.MS_LAZYTIME | unix.MS_NOSYMFOLLOW},
+		{[]string{"defaults"}, 0},
+	}
+
+	for _, test := range tests {
+		if got := OptionsToFlags(test.opts); got != test.flags {
+			t.Fatalf("OptionsToFlags(%v) failed: want %#x, got %#x", test.opts, test.flags, got)
+		}
+	}
+}
+
+func TestFlagsToOptions(t *testing.T) {
+	tests := []struct {
+		flags int
+		opts  []string
+	}{
+		{0, []string{"rw"}},
+		{unix.MS_RDONLY | unix.MS_NOSUID | unix.MS_RELATIME, []string{"ro", "nosuid", "relatime"}},
+		{unix.MS_BIND | unix.MS_REC | unix.MS_PRIVATE, []string{"rw", "rbind", "rprivate"}},
+		{unix.MS_NOSYMFOLLOW | unix.MS_LAZYTIME | unix.MS_SLAVE, []string{"rw", "nosymfollow", "lazytime", "slave"}},
+		{unix.MS_NOSYMFOLLOW | unix.MS_NOATIME | unix.MS_NODIRATIME | unix.MS_NOEXEC, []string{"rw", "noexec", "noatime", "nodiratime", "nosymfollow"}},
+	}
+
+	for _, test := range tests {
+		got := FlagsToOptions(test.flags)
+		if strings.Join(got, ",") != strings.Join(test.opts, ",") {
+			t.Fatalf("FlagsToOptions(%#x) failed: want %v, got %v", test.flags, test.opts, got)
+		}
+
+		// round trip
+		if flags := OptionsToFlags(got); flags != test.flags {
+			t.Fatalf("OptionsToFlags(%v) failed: want %#x, got %#x", got, test.flags, flags)
+		}
+	}
+}
+
+func TestSplitOptions(t *testing.T) {
+	opts := `ro,nodev,lowerdir=/a\,b:/c,rprivate,index=off,lazytime,xino=off`
+
+	flags, propagation, data := SplitOptions(opts)
+
+	if flags != unix.MS_RDONLY|unix.MS_NODEV|unix.MS_LAZYTIME {
+		t.Fatalf("SplitOptions() failed: want flags %#x, got %#x", unix.MS_RDONLY|unix.MS_NODEV|unix.MS_LAZYTIME, flags)
+	}
+	if propagation != unix.MS_PRIVATE|unix.MS_REC {
+		t.Fatalf("SplitOptions() failed: want propagation %#x, got %#x", unix.MS_PRIVATE|unix.MS_REC, propagation)
+	}
+	if want := `lowerdir=/a\,b:/c,index=off,xino=off`; data != want {
+		t.Fatalf("SplitOptions() failed: want data %q, got %q", want, data)
+	}
+}
+
+func TestResolvePathPid(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("test requires root")
+	}
+
+	dir := t.TempDir()
+	src := dir + "/src"
+	dst := dir + "/dst"
+	priv := dir + "/priv"
+
+	for _, d := range []string{src + "/sub", dst, priv} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(dst+"/sub", dir+"/link"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Create a process in a new mount namespace with a bind mount and a tmpfs
+	// mount that are not visible to the host.
+	script := fmt.Sprintf("mount --make-rprivate / && mount --bind %s %s && mount -t tmpfs tmpfs %s && echo ready && exec sleep 100",
+		src, dst, priv)
+
+	cmd := exec.Command("sh", "-c", script)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Cloneflags: unix.CLONE_NEWNS}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("failed to start process: %v", err)
+	}
+	defer func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}()
+
+	buf := make([]byte, 16)
+	if n, err := stdout.Read(buf); err != nil || string(buf[:n]) != "ready\n" {
+		t.Fatalf("process failed to set up mounts: %v", err)
+	}
+
+	pid := uint32(cmd.Process.Pid)
+
+	// path through a symlink and a bind mount
+	rp, err := ResolvePathPid(pid, dir+"/link/file")
+	if err != nil {
+		t.Fatalf("ResolvePathPid() failed: %v", err)
+	}
+	if rp.Path != dst+"/sub/file" || rp.Mount.Mountpoint != dst {
+		t.Fatalf("ResolvePathPid() failed: got path %s on mount %s", rp.Path, rp.Mount.Mountpoint)
+	}
+	if rp.HostPath != src+"/sub/file" {
+		t.Fatalf("ResolvePathPid() failed: want host path %s/sub/file, got %s", src, rp.HostPath)
+	}
+	if want := fmt.Sprintf("/proc/%d/root%s/sub/file", pid, dst); rp.ProcPath != want {
+		t.Fatalf("ResolvePathPid() failed: want proc path %s, got %s", want, rp.ProcPath)
+	}
+
+	// path on a mount not visible to the host
+	rp, err = ResolvePathPid(pid, priv+"/a/../b")
+	if err != nil {
+		t.Fatalf("ResolvePathPid() failed: %v", err)
+	}
+	if rp.Path != priv+"/b" || rp.Fstype != "tmpfs" || rp.FsPath != "/b" || rp.HostPath != "" {
+		t.Fatalf("ResolvePathPid() failed: got %+v", *rp)
+	}
+
+	// negative testing
+	if err := os.Symlink("loop", dir+"/loop"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ResolvePathPid(pid, dir+"/loop"); !errors.Is(err, unix.ELOOP) {
+		t.Fatalf("ResolvePathPid() on symlink loop: want ELOOP, got %v", err)
+	}
+	if _, err := ResolvePathPid(pid, "relative"); err == nil {
+		t.Fatalf("ResolvePathPid() on relative path passed; expected failure")
+	}
+}
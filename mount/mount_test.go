@@ -1,6 +1,7 @@
 package mount
 
 import (
+	"slices"
 	"testing"
 )
 
@@ -75,3 +76,100 @@ func TestGetMountAt(t *testing.T) {
 		}
 	}
 }
+
+func nodeIDs(nodes []*MountNode) []int {
+	ids := []int{}
+	for _, n := range nodes {
+		ids = append(ids, n.Info.ID)
+	}
+	return ids
+}
+
+func TestMountTree(t *testing.T) {
+
+	// mount 4 overmounts 2 (and thus hides 3); mount 7 is stacked on 6.
+	mounts := []*Info{
+		{ID: 1, Parent: 0, Mountpoint: "/"},
+		{ID: 2, Parent: 1, Mountpoint: "/a"},
+		{ID: 3, Parent: 2, Mountpoint: "/a/b"},
+		{ID: 4, Parent: 2, Mountpoint: "/a"},
+		{ID: 5, Parent: 1, Mountpoint: "/c"},
+		{ID: 6, Parent: 5, Mountpoint: "/c/d"},
+		{ID: 7, Parent: 6, Mountpoint: "/c/d"},
+	}
+
+	tree := NewMountTree(mounts)
+
+	if roots := nodeIDs(tree.Roots()); !slices.Equal(roots, []int{1}) {
+		t.Fatalf("Roots() failed: want [1], got %v", roots)
+	}
+
+	node := tree.Lookup(3)
+	if node == nil || node.Parent.Info.ID != 2 {
+		t.Fatalf("Lookup() failed: got %+v", node)
+	}
+	if ids := nodeIDs(tree.Lookup(2).Children); !slices.Equal(ids, []int{3, 4}) {
+		t.Fatalf("Lookup() failed: want children [3 4], got %v", ids)
+	}
+	if tree.Lookup(100) != nil {
+		t.Fatalf("Lookup() of non-existent mount passed; expected nil")
+	}
+
+	lookupPath := map[string]int{"/a": 4, "/c/d": 7, "/c/d/": 7, "/": 1}
+	for path, id := range lookupPath {
+		node := tree.LookupPath(path)
+		if node == nil || node.Info.ID != id {
+			t.Fatalf("LookupPath(%s) failed: want %d, got %+v", path, id, node)
+		}
+	}
+	for _, path := range []string{"/a/b", "/c/d/e"} {
+		if node := tree.LookupPath(path); node != nil {
+			t.Fatalf("LookupPath(%s) failed: want nil, got %+v", path, node.Info)
+		}
+	}
+
+	covering := map[string]int{"/a/b/file": 4, "/a": 4, "/c/d/e": 7, "/c/x": 5, "/x": 1}
+	for path, id := range covering {
+		node := tree.CoveringMount(path)
+		if node == nil || node.Info.ID != id {
+			t.Fatalf("CoveringMount(%s) failed: want %d, got %+v", path, id, node)
+		}
+	}
+
+	if ids := nodeIDs(tree.Submounts("/a")); !slices.Equal(ids, []int{3}) {
+		t.Fatalf("Submounts() failed: want [3], got %v", ids)
+	}
+	if ids := nodeIDs(tree.Submounts("/")); !slices.Equal(ids, []int{2, 3, 4, 5, 6, 7}) {
+		t.Fatalf("Submounts() failed: want [2 3 4 5 6 7], got %v", ids)
+	}
+
+	if ids := nodeIDs(tree.Overmounted()); !slices.Equal(ids, []int{2, 3, 6}) {
+		t.Fatalf("Overmounted() failed: want [2 3 6], got %v", ids)
+	}
+
+	if ids := nodeIDs(tree.UnmountOrder("/a")); !slices.Equal(ids, []int{4, 3, 2}) {
+		t.Fatalf("UnmountOrder() failed: want [4 3 2], got %v", ids)
+	}
+	if ids := nodeIDs(tree.UnmountOrder("/c")); !slices.Equal(ids, []int{7, 6, 5}) {
+		t.Fatalf("UnmountOrder() failed: want [7 6 5], got %v", ids)
+	}
+}
+
+func TestMountTreeCurrent(t *testing.T) {
+	allMounts, err := GetMounts()
+	if err != nil {
+		t.Fatalf("GetMounts() failed: %v", err)
+	}
+
+	tree := NewMountTree(allMounts)
+
+	node := tree.CoveringMount("/proc/self/status")
+	if node == nil || node.Info.Fstype != "proc" {
+		t.Fatalf("CoveringMount() failed: want proc mount, got %+v", node)
+	}
+
+	node = tree.LookupPath("/sys")
+	if node == nil || node.Info.Fstype != "sysfs" {
+		t.Fatalf("LookupPath() failed: want sysfs mount, got %+v", node)
+	}
+}
@@ -2,6 +2,8 @@ package mount
 
 // Info reveals information about a particular mounted filesystem. This
 // struct is populated from the content in the /proc/<pid>/mountinfo file.
+// The Root, Mountpoint and Source fields have their mountinfo octal escapes
+// (e.g., "\040" for a space) decoded.
 type Info struct {
 	// ID is a unique identifier of the mount (may be reused after umount).
 	ID int
@@ -29,6 +31,23 @@ type Info struct {
 	// Optional represents optional fields.
 	Optional string
 
+	// Shared is the peer group ID of a shared mount ("shared:X" optional
+	// field); zero if the mount is not shared.
+	Shared int
+
+	// Master is the peer group ID of the master of a slave mount ("master:X"
+	// optional field); zero if the mount is not a slave.
+	Master int
+
+	// PropagateFrom is the peer group ID of the closest dominant peer group
+	// under the same root ("propagate_from:X" optional field); only reported
+	// for slave mounts, zero otherwise.
+	PropagateFrom int
+
+	// Unbindable indicates the mount is unbindable ("unbindable" optional
+	// field).
+	Unbindable bool
+
 	// Fstype indicates the type of filesystem, such as EXT3.
 	Fstype string
 
@@ -37,4 +56,9 @@ type Info struct {
 
 	// VfsOpts represents per super block options.
 	VfsOpts string
+
+	// UniqueID is the 64-bit mount ID, which unlike ID is never reused (see
+	// statmount(2)); zero if the mount table was obtained from mountinfo
+	// (i.e., on kernels without listmount(2) / statmount(2) support).
+	UniqueID uint64
 }
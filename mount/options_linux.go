@@ -0,0 +1,219 @@
+//
+// Copyright 2026 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package mount
+
+import (
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// mountFlag describes how a mount option maps to a mount flag: the option
+// either sets the flag (e.g., "ro") or clears it (e.g., "rw").
+type mountFlag struct {
+	clear bool
+	flag  int
+}
+
+// Mount options that map to mount(2) flags
+var mountFlagsMap = map[string]mountFlag{
+	"async":         {true, unix.MS_SYNCHRONOUS},
+	"atime":         {true, unix.MS_NOATIME},
+	"bind":          {false, unix.MS_BIND},
+	"defaults":      {false, 0},
+	"dev":           {true, unix.MS_NODEV},
+	"diratime":      {true, unix.MS_NODIRATIME},
+	"dirsync":       {false, unix.MS_DIRSYNC},
+	"exec":          {true, unix.MS_NOEXEC},
+	"iversion":      {false, unix.MS_I_VERSION},
+	"lazytime":      {false, unix.MS_LAZYTIME},
+	"loud":          {true, unix.MS_SILENT},
+	"mand":          {false, unix.MS_MANDLOCK},
+	"noatime":       {false, unix.MS_NOATIME},
+	"nodev":         {false, unix.MS_NODEV},
+	"nodiratime":    {false, unix.MS_NODIRATIME},
+	"noexec":        {false, unix.MS_NOEXEC},
+	"noiversion":    {true, unix.MS_I_VERSION},
+	"nolazytime":    {true, unix.MS_LAZYTIME},
+	"nomand":        {true, unix.MS_MANDLOCK},
+	"norelatime":    {true, unix.MS_RELATIME},
+	"nostrictatime": {true, unix.MS_STRICTATIME},
+	"nosuid":        {false, unix.MS_NOSUID},
+	"nosymfollow":   {false, unix.MS_NOSYMFOLLOW},
+	"rbind":         {false, unix.MS_BIND | unix.MS_REC},
+	"relatime":      {false, unix.MS_RELATIME},
+	"remount":       {false, unix.MS_REMOUNT},
+	"ro":            {false, unix.MS_RDONLY},
+	"rw":            {true, unix.MS_RDONLY},
+	"silent":        {false, unix.MS_SILENT},
+	"strictatime":   {false, unix.MS_STRICTATIME},
+	"suid":          {true, unix.MS_NOSUID},
+	"sync":          {false, unix.MS_SYNCHRONOUS},
+	"symfollow":     {true, unix.MS_NOSYMFOLLOW},
+}
+
+// Mount options that map to mount propagation flags
+var propagationFlagsMap = map[string]int{
+	"private":     unix.MS_PRIVATE,
+	"rprivate":    unix.MS_PRIVATE | unix.MS_REC,
+	"shared":      unix.MS_SHARED,
+	"rshared":     unix.MS_SHARED | unix.MS_REC,
+	"slave":       unix.MS_SLAVE,
+	"rslave":      unix.MS_SLAVE | unix.MS_REC,
+	"unbindable":  unix.MS_UNBINDABLE,
+	"runbindable": unix.MS_UNBINDABLE | unix.MS_REC,
+}
+
+// Order in which FlagsToOptions() lists the options for the set flags: the
+// per-mount ones first, in the order the kernel lists them in mountinfo, then
+// the others in flag bit order.
+var flagOptsOrder = []struct {
+	flag int
+	opt  string
+}{
+	{unix.MS_RDONLY, "ro"},
+	{unix.MS_NOSUID, "nosuid"},
+	{unix.MS_NODEV, "nodev"},
+	{unix.MS_NOEXEC, "noexec"},
+	{unix.MS_NOATIME, "noatime"},
+	{unix.MS_NODIRATIME, "nodiratime"},
+	{unix.MS_RELATIME, "relatime"},
+	{unix.MS_NOSYMFOLLOW, "nosymfollow"},
+	{unix.MS_SYNCHRONOUS, "sync"},
+	{unix.MS_REMOUNT, "remount"},
+	{unix.MS_MANDLOCK, "mand"},
+	{unix.MS_DIRSYNC, "dirsync"},
+	{unix.MS_BIND, "bind"},
+	{unix.MS_SILENT, "silent"},
+	{unix.MS_I_VERSION, "iversion"},
+	{unix.MS_STRICTATIME, "strictatime"},
+	{unix.MS_LAZYTIME, "lazytime"},
+	{unix.MS_UNBINDABLE, "unbindable"},
+	{unix.MS_PRIVATE, "private"},
+	{unix.MS_SLAVE, "slave"},
+	{unix.MS_SHARED, "shared"},
+}
+
+// splitOptionList splits a comma separated option string, honoring commas
+// escaped with a backslash (e.g., "lowerdir=/a\,b"). The returned options are
+// not unescaped.
+func splitOptionList(opts string) []string {
+	list := []string{}
+	start := 0
+
+	for i := 0; i < len(opts); i++ {
+		switch opts[i] {
+		case '\\':
+			i++
+		case ',':
+			if i > start {
+				list = append(list, opts[start:i])
+			}
+			start = i + 1
+		}
+	}
+	if start < len(opts) {
+		list = append(list, opts[start:])
+	}
+
+	return list
+}
+
+// unescapeOption removes backslash escapes from a mount option (both "\,"
+// and the octal escapes used in mountinfo, e.g., "\054").
+func unescapeOption(opt string) string {
+	opt = unescape(opt)
+	if !strings.Contains(opt, `\,`) {
+		return opt
+	}
+	return strings.ReplaceAll(opt, `\,`, ",")
+}
+
+func parseOptions(opts string) map[string]string {
+	optMap := make(map[string]string)
+
+	for _, opt := range splitOptionList(opts) {
+		key, val, _ := strings.Cut(opt, "=")
+		optMap[unescapeOption(key)] = unescapeOption(val)
+	}
+
+	return optMap
+}
+
+func optToFlag(opts []string) int {
+	flags := 0
+	for _, opt := range opts {
+		f, ok := mountFlagsMap[opt]
+		if !ok {
+			if p, ok := propagationFlagsMap[opt]; ok {
+				flags |= p
+			}
+			continue
+		}
+		if f.clear {
+			flags &^= f.flag
+		} else {
+			flags |= f.flag
+		}
+	}
+	return flags
+}
+
+func flagToOpt(flags int) []string {
+	opts := []string{}
+
+	if flags&unix.MS_RDONLY == 0 {
+		opts = append(opts, "rw")
+	}
+
+	rec := flags&unix.MS_REC != 0
+
+	for _, fo := range flagOptsOrder {
+		if flags&fo.flag == 0 {
+			continue
+		}
+		opt := fo.opt
+		if rec && (fo.flag == unix.MS_BIND || fo.flag&propagationFlags != 0) {
+			opt = "r" + opt
+		}
+		opts = append(opts, opt)
+	}
+
+	return opts
+}
+
+func splitOptions(opts string) (int, int, string) {
+	flags := 0
+	propagation := 0
+	data := []string{}
+
+	for _, opt := range splitOptionList(opts) {
+		if f, ok := mountFlagsMap[opt]; ok {
+			if f.clear {
+				flags &^= f.flag
+			} else {
+				flags |= f.flag
+			}
+		} else if p, ok := propagationFlagsMap[opt]; ok {
+			propagation |= p
+		} else {
+			data = append(data, opt)
+		}
+	}
+
+	return flags, propagation, strings.Join(data, ",")
+}
@@ -0,0 +1,182 @@
+//
+// Copyright 2026 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package mount
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// Max number of symlinks followed when resolving a path (same as the kernel)
+const maxSymlinks = 40
+
+// ResolvedPath describes a path in the mount namespace of a process.
+type ResolvedPath struct {
+	Path     string // path as seen by the process, with symlinks resolved
+	ProcPath string // path through /proc/<pid>/root (valid while the process lives)
+	HostPath string // path in the caller's mount namespace ("" if not visible there)
+	Mount    *Info  // mount (in the process' mount namespace) on which the path resides
+	FsPath   string // path relative to the root of the backing filesystem
+	Fstype   string // type of the backing filesystem
+}
+
+// ResolvePathPid resolves the given path, as seen by the process with the
+// given pid (i.e., relative to its root and in its mount namespace), to the
+// mount it resides on and to the corresponding path in the caller's mount
+// namespace.
+//
+// Symlinks are resolved within the process' root (absolute symlinks are
+// relative to it). Trailing path components that don't exist are kept as is.
+// The host path is found by matching the backing filesystem (device) and the
+// path within it, so it works across bind mounts.
+func ResolvePathPid(pid uint32, path string) (*ResolvedPath, error) {
+
+	if !filepath.IsAbs(path) {
+		return nil, fmt.Errorf("path %s is not absolute", path)
+	}
+
+	procRoot := fmt.Sprintf("/proc/%d/root", pid)
+
+	resolved, err := resolveInRoot(procRoot, path)
+	if err != nil {
+		return nil, err
+	}
+
+	mounts, err := GetMountsPid(pid)
+	if err != nil {
+		return nil, err
+	}
+
+	node := NewMountTree(mounts).CoveringMount(resolved)
+	if node == nil {
+		return nil, fmt.Errorf("no mount found for %s in mount namespace of pid %d", resolved, pid)
+	}
+	m := node.Info
+
+	rel, err := filepath.Rel(m.Mountpoint, resolved)
+	if err != nil {
+		return nil, err
+	}
+
+	rp := &ResolvedPath{
+		Path:     resolved,
+		ProcPath: filepath.Join(procRoot, resolved),
+		Mount:    m,
+		FsPath:   filepath.Join(m.Root, rel),
+		Fstype:   m.Fstype,
+	}
+
+	hostMounts, err := GetMounts()
+	if err != nil {
+		return nil, err
+	}
+	rp.HostPath = hostPathOf(m, rp.FsPath, NewMountTree(hostMounts))
+
+	return rp, nil
+}
+
+// resolveInRoot resolves the symlinks in the given absolute path, treating
+// root as the root directory. Returns the resolved path (relative to root).
+func resolveInRoot(root, path string) (string, error) {
+	resolved := "/"
+	remaining := path
+	links := 0
+
+	for remaining != "" {
+		var comp string
+		comp, remaining, _ = strings.Cut(remaining, "/")
+
+		switch comp {
+		case "", ".":
+			continue
+		case "..":
+			resolved = filepath.Dir(resolved)
+			continue
+		}
+
+		next := filepath.Join(resolved, comp)
+
+		fi, err := os.Lstat(filepath.Join(root, next))
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				// keep the rest of the path as is
+				return filepath.Join(next, remaining), nil
+			}
+			return "", err
+		}
+
+		if fi.Mode()&os.ModeSymlink == 0 {
+			resolved = next
+			continue
+		}
+
+		links++
+		if links > maxSymlinks {
+			return "", fmt.Errorf("failed to resolve %s: %w", path, unix.ELOOP)
+		}
+
+		target, err := os.Readlink(filepath.Join(root, next))
+		if err != nil {
+			return "", err
+		}
+		if filepath.IsAbs(target) {
+			resolved = "/"
+		}
+		remaining = target + "/" + remaining
+	}
+
+	return resolved, nil
+}
+
+// hostPathOf returns the path in the given (host) mount tree for the given
+// path within the filesystem backing mount m, or "" if that path is not
+// visible in the tree.
+func hostPathOf(m *Info, fsPath string, tree *MountTree) string {
+	hostPath := ""
+	bestRoot := -1
+
+	for _, node := range tree.nodes {
+		hm := node.Info
+		if hm.Major != m.Major || hm.Minor != m.Minor || !pathIsUnder(fsPath, hm.Root) {
+			continue
+		}
+
+		rel, err := filepath.Rel(hm.Root, fsPath)
+		if err != nil {
+			continue
+		}
+		path := filepath.Join(hm.Mountpoint, rel)
+
+		// skip mounts that hide the path (or are hidden themselves)
+		if tree.CoveringMount(path) != node {
+			continue
+		}
+
+		// prefer the mount that exposes the deepest part of the filesystem
+		if len(hm.Root) > bestRoot {
+			hostPath = path
+			bestRoot = len(hm.Root)
+		}
+	}
+
+	return hostPath
+}
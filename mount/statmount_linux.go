@@ -0,0 +1,528 @@
+//
+// Copyright 2026 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Mount table retrieval via the listmount(2) and statmount(2) syscalls. These
+// are much faster than parsing /proc/<pid>/mountinfo on hosts with many mounts
+// and report unique (never reused) mount IDs.
+//
+// In order to populate mount.Info exactly as mountinfo does, we need the
+// STATMOUNT_MNT_OPTS, STATMOUNT_FS_SUBTYPE and STATMOUNT_SB_SOURCE fields,
+// which the kernel reports as supported via STATMOUNT_SUPPORTED_MASK (kernel
+// 6.15+). On older kernels we fall back to mountinfo.
+
+package mount
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	lsmtRoot = 0xffffffffffffffff // listmount(2) / statmount(2): root mount of the namespace
+
+	mntIDReqSizeVer1 = 32
+
+	statmountSbBasic       = 0x1
+	statmountMntBasic      = 0x2
+	statmountPropagateFrom = 0x4
+	statmountMntRoot       = 0x8
+	statmountMntPoint      = 0x10
+	statmountFsType        = 0x20
+	statmountMntNsID       = 0x40
+	statmountMntOpts       = 0x80
+	statmountFsSubtype     = 0x100
+	statmountSbSource      = 0x200
+	statmountSupportedMask = 0x1000
+
+	// fields needed to populate mount.Info
+	statmountInfoMask = statmountSbBasic | statmountMntBasic | statmountPropagateFrom |
+		statmountMntRoot | statmountMntPoint | statmountFsType | statmountMntOpts |
+		statmountFsSubtype | statmountSbSource
+
+	statmountBufSize = 4096
+	listmountBatch   = 512
+
+	// superblock flags reported by statmount (SB_*)
+	sbRdonly      = 0x1
+	sbSynchronous = 0x10
+	sbDirsync     = 0x80
+	sbLazytime    = 0x2000000
+
+	// ioctl to obtain the ID of a mount namespace (_IOR(0xb7, 0x5, __u64))
+	nsGetMntnsID = 0x8008b705
+)
+
+// struct mnt_id_req
+type mntIDReq struct {
+	Size    uint32
+	Spare   uint32
+	MntID   uint64
+	Param   uint64
+	MntNsID uint64
+}
+
+// struct statmount (fixed size header; strings follow it)
+type statmountT struct {
+	Size           uint32
+	MntOpts        uint32
+	Mask           uint64
+	SbDevMajor     uint32
+	SbDevMinor     uint32
+	SbMagic        uint64
+	SbFlags        uint32
+	FsType         uint32
+	MntID          uint64
+	MntParentID    uint64
+	MntIDOld       uint32
+	MntParentIDOld uint32
+	MntAttr        uint64
+	MntPropagation uint64
+	MntPeerGroup   uint64
+	MntMaster      uint64
+	PropagateFrom  uint64
+	MntRoot        uint32
+	MntPoint       uint32
+	MntNsID        uint64
+	FsSubtype      uint32
+	SbSource       uint32
+	OptNum         uint32
+	OptArray       uint32
+	OptSecNum      uint32
+	OptSecArray    uint32
+	SupportedMask  uint64
+	MntUidmapNum   uint32
+	MntUidmap      uint32
+	MntGidmapNum   uint32
+	MntGidmap      uint32
+	Spare2         [43]uint64
+}
+
+var (
+	statmountOnce      sync.Once
+	statmountAvailable bool
+)
+
+// statmountSupported checks (once) if the kernel supports listmount(2) and
+// statmount(2) with all the fields we need.
+func statmountSupported() bool {
+	statmountOnce.Do(func() {
+		rootID, _, err := mountIDOf("/")
+		if err != nil {
+			return
+		}
+		sm, _, err := statmount(rootID, 0, statmountSupportedMask)
+		if err != nil || sm.Mask&statmountSupportedMask == 0 {
+			return
+		}
+		if sm.SupportedMask&statmountInfoMask != statmountInfoMask {
+			return
+		}
+		if _, err := listmount(lsmtRoot, 0, 0, 1); err != nil {
+			return
+		}
+		statmountAvailable = true
+	})
+	return statmountAvailable
+}
+
+// statmount calls statmount(2) on the mount with the given unique ID in the
+// given mount namespace (0 for the current one); returns the statmount header
+// and the string area that follows it.
+func statmount(mntID, nsID, mask uint64) (*statmountT, []byte, error) {
+	hdrSize := int(unsafe.Sizeof(statmountT{}))
+	bufSize := statmountBufSize
+
+	req := mntIDReq{
+		Size:    mntIDReqSizeVer1,
+		MntID:   mntID,
+		Param:   mask,
+		MntNsID: nsID,
+	}
+
+	for {
+		buf := make([]byte, hdrSize+bufSize)
+		_, _, errno := unix.Syscall6(unix.SYS_STATMOUNT,
+			uintptr(unsafe.Pointer(&req)),
+			uintptr(unsafe.Pointer(&buf[0])),
+			uintptr(len(buf)), 0, 0, 0)
+
+		if errno == unix.EOVERFLOW {
+			bufSize *= 4
+			continue
+		}
+		if errno != 0 {
+			return nil, nil, errno
+		}
+
+		sm := *(*statmountT)(unsafe.Pointer(&buf[0]))
+		return &sm, buf[hdrSize:], nil
+	}
+}
+
+// listmount returns the unique IDs of the mounts below the mount with the
+// given unique ID (lsmtRoot for the root mount) in the given mount namespace
+// (0 for the current one), starting after the given ID. At most max IDs are
+// returned (0 means no limit).
+func listmount(mntID, nsID, after uint64, max int) ([]uint64, error) {
+	ids := []uint64{}
+
+	for {
+		batch := listmountBatch
+		if max > 0 && max-len(ids) < batch {
+			batch = max - len(ids)
+		}
+
+		req := mntIDReq{
+			Size:    mntIDReqSizeVer1,
+			MntID:   mntID,
+			Param:   after,
+			MntNsID: nsID,
+		}
+		buf := make([]uint64, batch)
+
+		n, _, errno := unix.Syscall6(unix.SYS_LISTMOUNT,
+			uintptr(unsafe.Pointer(&req)),
+			uintptr(unsafe.Pointer(&buf[0])),
+			uintptr(batch), 0, 0, 0)
+		if errno != 0 {
+			return nil, errno
+		}
+
+		ids = append(ids, buf[:n]...)
+
+		if int(n) < batch || (max > 0 && len(ids) >= max) {
+			return ids, nil
+		}
+		after = buf[n-1]
+	}
+}
+
+// mountIDOf returns the unique ID of the mount on which the given path
+// resides, and whether the path is the root of that mount.
+func mountIDOf(path string) (uint64, bool, error) {
+	var stx unix.Statx_t
+
+	if err := unix.Statx(unix.AT_FDCWD, path, 0, unix.STATX_MNT_ID_UNIQUE, &stx); err != nil {
+		return 0, false, err
+	}
+	if stx.Mask&unix.STATX_MNT_ID_UNIQUE == 0 {
+		return 0, false, fmt.Errorf("statx on %s did not return the unique mount ID", path)
+	}
+
+	isRoot := stx.Attributes_mask&unix.STATX_ATTR_MOUNT_ROOT != 0 &&
+		stx.Attributes&unix.STATX_ATTR_MOUNT_ROOT != 0
+
+	return stx.Mnt_id, isRoot, nil
+}
+
+// mountNsID returns the ID of the mount namespace of the given process, or 0
+// if the process is in the same mount namespace as the current process.
+func mountNsID(pid uint32) (uint64, error) {
+	var self, other unix.Stat_t
+
+	nsPath := fmt.Sprintf("/proc/%d/ns/mnt", pid)
+
+	if err := unix.Stat("/proc/self/ns/mnt", &self); err != nil {
+		return 0, err
+	}
+	if err := unix.Stat(nsPath, &other); err != nil {
+		return 0, err
+	}
+	if self.Dev == other.Dev && self.Ino == other.Ino {
+		return 0, nil
+	}
+
+	f, err := os.Open(nsPath)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	var id uint64
+	_, _, errno := unix.Syscall(unix.SYS_IOCTL, f.Fd(), nsGetMntnsID, uintptr(unsafe.Pointer(&id)))
+	if errno != 0 {
+		return 0, errno
+	}
+
+	return id, nil
+}
+
+// listMountTable returns the mount table of the given process using
+// listmount(2) and statmount(2). The mounts are those reachable from the
+// process' root, in mount order.
+func listMountTable(pid uint32) ([]*Info, error) {
+
+	nsID, err := mountNsID(pid)
+	if err != nil {
+		return nil, err
+	}
+
+	// statmount reports mountpoints relative to the namespace root (or the
+	// caller's root, when in the same namespace). This matches the process'
+	// view only if its root is the root of the mount at "/".
+	rootID, isRoot, err := mountIDOf(fmt.Sprintf("/proc/%d/root", pid))
+	if err != nil {
+		return nil, err
+	}
+	if !isRoot {
+		return nil, fmt.Errorf("root of pid %d is not a mount root", pid)
+	}
+
+	rootSm, rootStrs, err := statmount(rootID, nsID, statmountMntPoint)
+	if err != nil {
+		return nil, err
+	}
+	if smString(rootStrs, rootSm.MntPoint) != "/" {
+		return nil, fmt.Errorf("root of pid %d is not at the namespace root", pid)
+	}
+
+	ids, err := listmount(lsmtRoot, nsID, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	mounts := []*Info{}
+	parents := map[uint64]uint64{}
+	foundRoot := false
+
+	for _, id := range ids {
+		sm, strs, err := statmount(id, nsID, statmountInfoMask)
+		if err != nil {
+			if errors.Is(err, unix.ENOENT) {
+				// unmounted after listmount()
+				continue
+			}
+			return nil, err
+		}
+		if id == rootID {
+			foundRoot = true
+		}
+		parents[id] = sm.MntParentID
+		mounts = append(mounts, statmountToInfo(sm, strs))
+	}
+
+	if !foundRoot {
+		sm, strs, err := statmount(rootID, nsID, statmountInfoMask)
+		if err != nil {
+			return nil, err
+		}
+		parents[rootID] = sm.MntParentID
+		mounts = append([]*Info{statmountToInfo(sm, strs)}, mounts...)
+	}
+
+	// Only keep the mounts below the process' root (as mountinfo does).
+	out := make([]*Info, 0, len(mounts))
+	for _, m := range mounts {
+		if mountIsBelow(m.UniqueID, rootID, parents) {
+			out = append(out, m)
+		}
+	}
+
+	return out, nil
+}
+
+// mountIsBelow returns true if the given mount is equal to or a descendant of
+// the given root mount.
+func mountIsBelow(id, rootID uint64, parents map[uint64]uint64) bool {
+	for i := 0; i < len(parents); i++ {
+		if id == rootID {
+			return true
+		}
+		parent, found := parents[id]
+		if !found || parent == id {
+			return false
+		}
+		id = parent
+	}
+	return false
+}
+
+// getMountByID returns info about the mount with the given unique ID in the
+// current mount namespace.
+func getMountByID(id uint64) (*Info, error) {
+	if !statmountSupported() {
+		return nil, fmt.Errorf("statmount is not supported: %w", unix.ENOSYS)
+	}
+	sm, strs, err := statmount(id, 0, statmountInfoMask)
+	if err != nil {
+		return nil, fmt.Errorf("statmount on mount %d failed: %w", id, err)
+	}
+	return statmountToInfo(sm, strs), nil
+}
+
+// getMountOf returns info about the mount on which the given path resides.
+func getMountOf(path string) (*Info, error) {
+
+	if statmountSupported() {
+		id, _, err := mountIDOf(path)
+		if err != nil {
+			return nil, err
+		}
+		return getMountByID(id)
+	}
+
+	// Fallback: find the (reusable) mount ID in the mountinfo table.
+	var stx unix.Statx_t
+	if err := unix.Statx(unix.AT_FDCWD, path, 0, unix.STATX_MNT_ID, &stx); err != nil {
+		return nil, err
+	}
+	if stx.Mask&unix.STATX_MNT_ID == 0 {
+		return nil, fmt.Errorf("statx on %s did not return the mount ID", path)
+	}
+
+	mounts, err := parseMountTable()
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range mounts {
+		if uint64(m.ID) == stx.Mnt_id {
+			return m, nil
+		}
+	}
+
+	return nil, fmt.Errorf("mount for %s not found", path)
+}
+
+// statmountToInfo converts the statmount result to an Info struct, formatted
+// exactly as the kernel does in /proc/<pid>/mountinfo.
+func statmountToInfo(sm *statmountT, strs []byte) *Info {
+
+	mi := &Info{
+		ID:         int(sm.MntIDOld),
+		Parent:     int(sm.MntParentIDOld),
+		Major:      int(sm.SbDevMajor),
+		Minor:      int(sm.SbDevMinor),
+		Root:       smString(strs, sm.MntRoot),
+		Mountpoint: smString(strs, sm.MntPoint),
+		Opts:       mntAttrToOpts(sm.MntAttr),
+		Fstype:     smString(strs, sm.FsType),
+		Source:     "none",
+		UniqueID:   sm.MntID,
+	}
+
+	if sm.Mask&statmountFsSubtype != 0 {
+		if subtype := smString(strs, sm.FsSubtype); subtype != "" {
+			mi.Fstype += "." + subtype
+		}
+	}
+
+	if sm.Mask&statmountSbSource != 0 {
+		mi.Source = smString(strs, sm.SbSource)
+	}
+
+	// per superblock options
+	vfsOpts := []string{"rw"}
+	if sm.SbFlags&sbRdonly != 0 {
+		vfsOpts[0] = "ro"
+	}
+	if sm.SbFlags&sbSynchronous != 0 {
+		vfsOpts = append(vfsOpts, "sync")
+	}
+	if sm.SbFlags&sbDirsync != 0 {
+		vfsOpts = append(vfsOpts, "dirsync")
+	}
+	if sm.SbFlags&sbLazytime != 0 {
+		vfsOpts = append(vfsOpts, "lazytime")
+	}
+	if sm.Mask&statmountMntOpts != 0 {
+		if opts := smString(strs, sm.MntOpts); opts != "" {
+			vfsOpts = append(vfsOpts, opts)
+		}
+	}
+	mi.VfsOpts = strings.Join(vfsOpts, ",")
+
+	// optional fields
+	optFields := []string{}
+	if sm.MntPropagation&unix.MS_SHARED != 0 {
+		mi.Shared = int(sm.MntPeerGroup)
+		optFields = append(optFields, "shared:"+strconv.Itoa(mi.Shared))
+	}
+	if sm.MntPropagation&unix.MS_SLAVE != 0 {
+		mi.Master = int(sm.MntMaster)
+		optFields = append(optFields, "master:"+strconv.Itoa(mi.Master))
+		if sm.PropagateFrom != 0 && sm.PropagateFrom != sm.MntMaster {
+			mi.PropagateFrom = int(sm.PropagateFrom)
+			optFields = append(optFields, "propagate_from:"+strconv.Itoa(mi.PropagateFrom))
+		}
+	}
+	if sm.MntPropagation&unix.MS_UNBINDABLE != 0 {
+		mi.Unbindable = true
+		optFields = append(optFields, "unbindable")
+	}
+	mi.Optional = strings.Join(optFields, " ")
+
+	return mi
+}
+
+// mntAttrToOpts converts the mount attributes (MOUNT_ATTR_*) to the per-mount
+// options string, in the same order as mountinfo. As in mountinfo, a read-only
+// superblock is only reflected in the superblock options.
+func mntAttrToOpts(attr uint64) string {
+	opts := []string{"rw"}
+
+	if attr&unix.MOUNT_ATTR_RDONLY != 0 {
+		opts[0] = "ro"
+	}
+	if attr&unix.MOUNT_ATTR_NOSUID != 0 {
+		opts = append(opts, "nosuid")
+	}
+	if attr&unix.MOUNT_ATTR_NODEV != 0 {
+		opts = append(opts, "nodev")
+	}
+	if attr&unix.MOUNT_ATTR_NOEXEC != 0 {
+		opts = append(opts, "noexec")
+	}
+
+	atime := attr & unix.MOUNT_ATTR__ATIME
+	if atime == unix.MOUNT_ATTR_NOATIME {
+		opts = append(opts, "noatime")
+	}
+	if attr&unix.MOUNT_ATTR_NODIRATIME != 0 {
+		opts = append(opts, "nodiratime")
+	}
+	if atime == unix.MOUNT_ATTR_RELATIME {
+		opts = append(opts, "relatime")
+	}
+	if attr&unix.MOUNT_ATTR_NOSYMFOLLOW != 0 {
+		opts = append(opts, "nosymfollow")
+	}
+	if attr&unix.MOUNT_ATTR_IDMAP != 0 {
+		opts = append(opts, "idmapped")
+	}
+
+	return strings.Join(opts, ",")
+}
+
+// smString returns the nul-terminated string at the given offset of the
+// statmount string area.
+func smString(strs []byte, off uint32) string {
+	if int(off) >= len(strs) {
+		return ""
+	}
+	s := strs[off:]
+	if i := bytes.IndexByte(s, 0); i >= 0 {
+		s = s[:i]
+	}
+	return string(s)
+}
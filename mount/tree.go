@@ -0,0 +1,219 @@
+//
+// Copyright 2026 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package mount
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// MountNode is a mount in a MountTree.
+type MountNode struct {
+	Info     *Info
+	Parent   *MountNode   // nil for the top of the tree
+	Children []*MountNode // in mount order
+}
+
+// MountTree organizes a mount table (as returned by GetMounts()) into a tree,
+// based on the mount ID and parent ID of each mount.
+type MountTree struct {
+	nodes []*MountNode // all nodes, in mount order
+	roots []*MountNode // nodes whose parent is not in the mount table
+	byID  map[int]*MountNode
+}
+
+// NewMountTree builds a mount tree from the given mount table. Mounts whose
+// parent is not in the table (e.g., the root mount of a mount namespace) are
+// placed at the top of the tree.
+func NewMountTree(mounts []*Info) *MountTree {
+	t := &MountTree{
+		byID: make(map[int]*MountNode, len(mounts)),
+	}
+
+	for _, m := range mounts {
+		node := &MountNode{Info: m}
+		t.nodes = append(t.nodes, node)
+		t.byID[m.ID] = node
+	}
+
+	for _, node := range t.nodes {
+		parent, found := t.byID[node.Info.Parent]
+		if !found || parent == node {
+			t.roots = append(t.roots, node)
+			continue
+		}
+		node.Parent = parent
+		parent.Children = append(parent.Children, node)
+	}
+
+	return t
+}
+
+// Roots returns the mounts at the top of the tree.
+func (t *MountTree) Roots() []*MountNode {
+	return t.roots
+}
+
+// Lookup returns the mount with the given ID, or nil if not found.
+func (t *MountTree) Lookup(id int) *MountNode {
+	return t.byID[id]
+}
+
+// LookupPath returns the mount that is visible at the given mountpoint (i.e.,
+// the top-most mount when several are stacked on it), or nil if the path is
+// not a mountpoint.
+func (t *MountTree) LookupPath(mountpoint string) *MountNode {
+	mountpoint = filepath.Clean(mountpoint)
+
+	node := t.CoveringMount(mountpoint)
+	if node == nil || node.Info.Mountpoint != mountpoint {
+		return nil
+	}
+	return node
+}
+
+// CoveringMount returns the mount on which the given (absolute) path resides,
+// taking into account mounts stacked on top of each other and mounts that
+// hide others (overmounts). Returns nil if no mount covers the path.
+func (t *MountTree) CoveringMount(path string) *MountNode {
+	path = filepath.Clean(path)
+
+	// Start at the top-level mount closest to the path
+	var curr *MountNode
+	for _, r := range t.roots {
+		if !pathIsUnder(path, r.Info.Mountpoint) {
+			continue
+		}
+		if curr == nil || len(r.Info.Mountpoint) >= len(curr.Info.Mountpoint) {
+			curr = r
+		}
+	}
+	if curr == nil {
+		return nil
+	}
+
+	// Walk the path one component at a time, the same way the kernel does
+	// during path resolution: at each component, cross into any mount
+	// stacked on it (the last mount wins).
+	for _, prefix := range pathPrefixes(path) {
+		if !pathIsUnder(prefix, curr.Info.Mountpoint) {
+			continue
+		}
+		for {
+			next := lastChildAt(curr, prefix)
+			if next == nil {
+				break
+			}
+			curr = next
+		}
+	}
+
+	return curr
+}
+
+// Submounts returns the mounts below the given path (excluding mounts on the
+// path itself), in mount order. Overmounted mounts are included.
+func (t *MountTree) Submounts(path string) []*MountNode {
+	path = filepath.Clean(path)
+
+	subs := []*MountNode{}
+	for _, node := range t.nodes {
+		mp := node.Info.Mountpoint
+		if mp != path && pathIsUnder(mp, path) {
+			subs = append(subs, node)
+		}
+	}
+	return subs
+}
+
+// IsOvermounted returns true if the given mount is hidden by another mount
+// (i.e., a mount stacked on top of it, or a mount on top of one of its
+// ancestor directories).
+func (t *MountTree) IsOvermounted(node *MountNode) bool {
+	return t.CoveringMount(node.Info.Mountpoint) != node
+}
+
+// Overmounted returns all hidden mounts in the tree, in mount order.
+func (t *MountTree) Overmounted() []*MountNode {
+	hidden := []*MountNode{}
+	for _, node := range t.nodes {
+		if t.IsOvermounted(node) {
+			hidden = append(hidden, node)
+		}
+	}
+	return hidden
+}
+
+// UnmountOrder returns the mounts at or below the given path in an order in
+// which they can be safely unmounted (i.e., children before their parents,
+// and the most recent mounts first).
+func (t *MountTree) UnmountOrder(path string) []*MountNode {
+	path = filepath.Clean(path)
+
+	order := []*MountNode{}
+
+	var walk func(node *MountNode)
+	walk = func(node *MountNode) {
+		for i := len(node.Children) - 1; i >= 0; i-- {
+			walk(node.Children[i])
+		}
+		if pathIsUnder(node.Info.Mountpoint, path) {
+			order = append(order, node)
+		}
+	}
+
+	for i := len(t.roots) - 1; i >= 0; i-- {
+		walk(t.roots[i])
+	}
+
+	return order
+}
+
+// lastChildAt returns the last child of the given mount that is mounted on
+// the given path, or nil if there is none.
+func lastChildAt(node *MountNode, path string) *MountNode {
+	for i := len(node.Children) - 1; i >= 0; i-- {
+		if node.Children[i].Info.Mountpoint == path {
+			return node.Children[i]
+		}
+	}
+	return nil
+}
+
+// pathIsUnder returns true if path is equal to or below dir; both paths must
+// be clean and absolute.
+func pathIsUnder(path, dir string) bool {
+	if dir == "/" || path == dir {
+		return true
+	}
+	return strings.HasPrefix(path, dir+"/")
+}
+
+// pathPrefixes returns all prefixes of the given clean absolute path, from
+// shortest to longest (e.g., "/a/b" -> ["/", "/a", "/a/b"]).
+func pathPrefixes(path string) []string {
+	prefixes := []string{"/"}
+	for i := 1; i < len(path); i++ {
+		if path[i] == '/' {
+			prefixes = append(prefixes, path[:i])
+		}
+	}
+	if path != "/" {
+		prefixes = append(prefixes, path)
+	}
+	return prefixes
+}
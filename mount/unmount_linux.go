@@ -0,0 +1,167 @@
+//
+// Copyright 2026 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package mount
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// UnmountOpts configures UnmountTree().
+type UnmountOpts struct {
+	Flags      int           // umount2(2) flags (MNT_DETACH, MNT_FORCE, MNT_EXPIRE)
+	Retries    int           // number of retries when a mount is busy (EBUSY)
+	RetryDelay time.Duration // delay before the first retry; doubles on each retry
+}
+
+// UnmountTree unmounts all mounts at or below the given path, children before
+// their parents and the most recent mounts first. Busy mounts are retried per
+// the given options. Mounts that are already gone (e.g., removed along with
+// their parent) are skipped; mounts covered by another mount that can't be
+// removed are left in place.
+//
+// Returns the mounts that could not be removed, along with the errors that
+// prevented their removal.
+func UnmountTree(path string, opts *UnmountOpts) ([]*Info, error) {
+
+	if opts == nil {
+		opts = &UnmountOpts{}
+	}
+	if opts.Retries < 0 || opts.RetryDelay < 0 || !validUnmountFlags(opts.Flags) {
+		return nil, fmt.Errorf("invalid unmount options: %+v", *opts)
+	}
+
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	mounts, err := GetMounts()
+	if err != nil {
+		return nil, err
+	}
+
+	tree := NewMountTree(mounts)
+
+	failed := []*Info{}
+	errs := []error{}
+
+	for _, node := range tree.UnmountOrder(path) {
+		if err := unmountRetry(node.Info, opts); err != nil {
+			failed = append(failed, node.Info)
+			errs = append(errs, err)
+		}
+	}
+
+	return failed, errors.Join(errs...)
+}
+
+// validUnmountFlags returns true if the given umount2(2) flags are valid (the
+// kernel rejects MNT_EXPIRE along with MNT_DETACH or MNT_FORCE).
+func validUnmountFlags(flags int) bool {
+	if flags&^(unix.MNT_DETACH|unix.MNT_FORCE|unix.MNT_EXPIRE|unix.UMOUNT_NOFOLLOW) != 0 {
+		return false
+	}
+	return flags&unix.MNT_EXPIRE == 0 || flags&(unix.MNT_DETACH|unix.MNT_FORCE) == 0
+}
+
+// unmountRetry unmounts the given mount, retrying while it's busy. Unmounting
+// goes by path, so it's only attempted while the mount is the top-most one at
+// its mountpoint.
+func unmountRetry(m *Info, opts *UnmountOpts) error {
+	flags := opts.Flags | unix.UMOUNT_NOFOLLOW
+	delay := opts.RetryDelay
+
+	for i := 0; ; i++ {
+		top, err := isTopMount(m)
+		if err != nil || !top {
+			gone, goneErr := mountGone(m)
+			switch {
+			case goneErr != nil:
+				return fmt.Errorf("failed to unmount %s: %w", m.Mountpoint, goneErr)
+			case gone:
+				return nil
+			case err != nil:
+				return fmt.Errorf("failed to unmount %s: %w", m.Mountpoint, err)
+			default:
+				return fmt.Errorf("failed to unmount %s: covered by another mount", m.Mountpoint)
+			}
+		}
+
+		err = unix.Unmount(m.Mountpoint, flags)
+
+		// With MNT_EXPIRE, the first call only marks the mount as expired
+		// (EAGAIN); the second one unmounts it if it's still unused.
+		if errors.Is(err, unix.EAGAIN) && flags&unix.MNT_EXPIRE != 0 {
+			err = unix.Unmount(m.Mountpoint, flags)
+		}
+
+		switch {
+		case err == nil:
+			return nil
+		case errors.Is(err, unix.EBUSY) && i < opts.Retries:
+			time.Sleep(delay)
+			delay *= 2
+		case errors.Is(err, unix.EBUSY):
+			return fmt.Errorf("failed to unmount %s: %w", m.Mountpoint, err)
+		default:
+			// the mount may have gone meanwhile (e.g., along with its parent)
+			if gone, goneErr := mountGone(m); goneErr == nil && gone {
+				return nil
+			}
+			return fmt.Errorf("failed to unmount %s: %w", m.Mountpoint, err)
+		}
+	}
+}
+
+// isTopMount returns true if the given mount is the top-most mount at its
+// mountpoint (i.e., the one the mountpoint path resolves to).
+func isTopMount(m *Info) (bool, error) {
+	var stx unix.Statx_t
+
+	mask, id := uint32(unix.STATX_MNT_ID), uint64(m.ID)
+	if m.UniqueID != 0 {
+		mask, id = unix.STATX_MNT_ID_UNIQUE, m.UniqueID
+	}
+
+	if err := unix.Statx(unix.AT_FDCWD, m.Mountpoint, unix.AT_SYMLINK_NOFOLLOW, int(mask), &stx); err != nil {
+		return false, err
+	}
+	if stx.Mask&mask == 0 {
+		return false, fmt.Errorf("statx on %s did not return the mount ID", m.Mountpoint)
+	}
+
+	return stx.Mnt_id == id, nil
+}
+
+// mountGone returns true if the given mount is no longer in the mount table.
+func mountGone(m *Info) (bool, error) {
+	mounts, err := GetMounts()
+	if err != nil {
+		return false, err
+	}
+	for _, mi := range mounts {
+		if mi.ID == m.ID && mi.UniqueID == m.UniqueID && mi.Mountpoint == m.Mountpoint {
+			return false, nil
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,270 @@
+//
+// Copyright 2026 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package mount
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// Mount event types
+type MountEventType int
+
+const (
+	MountAdded   MountEventType = iota // a mount appeared
+	MountRemoved                       // a mount disappeared
+	MountChanged                       // a mount's options or propagation changed
+)
+
+func (t MountEventType) String() string {
+	switch t {
+	case MountAdded:
+		return "added"
+	case MountRemoved:
+		return "removed"
+	case MountChanged:
+		return "changed"
+	}
+	return fmt.Sprintf("unknown (%d)", int(t))
+}
+
+// MountEvent represents a change in the mount table.
+type MountEvent struct {
+	Type  MountEventType
+	Mount *Info // the added, removed or changed mount (new info for changes)
+	Old   *Info // the mount info prior to the change (MountChanged only)
+	Err   error // set if the watcher failed to read the mount table
+}
+
+// Watcher configuration
+type WatcherCfg struct {
+	EventBufSize int // size of the events channel buffer
+
+	// Interval at which the mount table is rescanned in the absence of
+	// kernel notifications (zero disables rescans). The kernel does not
+	// notify about all changes (e.g., remounts that only modify the mount
+	// flags), so those are only detected on a rescan or along with other
+	// changes.
+	RescanInterval time.Duration
+}
+
+// Watcher notifies the caller about mounts appearing, disappearing or changing
+// in the mount namespace of a given process.
+type Watcher struct {
+	pid       uint32
+	cfg       WatcherCfg
+	mountinfo *os.File // the process' mountinfo (polled for changes)
+	wakeFd    int      // eventfd used to wake up the watcher thread
+	mounts    []*Info  // last mount table snapshot
+	eventCh   chan []MountEvent
+	stopCh    chan struct{}
+	doneCh    chan struct{}
+	closeOnce sync.Once
+}
+
+// NewWatcher creates a watcher for the mount namespace of the process with the
+// given pid. Events are delivered in batches (one per mount table change) on
+// the channel returned by Events().
+func NewWatcher(pid uint32, cfg *WatcherCfg) (*Watcher, error) {
+
+	if cfg.EventBufSize < 0 || cfg.RescanInterval < 0 {
+		return nil, fmt.Errorf("invalid config: %+v", *cfg)
+	}
+
+	f, err := os.Open(fmt.Sprintf("/proc/%d/mountinfo", pid))
+	if err != nil {
+		return nil, err
+	}
+
+	wakeFd, err := unix.Eventfd(0, unix.EFD_CLOEXEC|unix.EFD_NONBLOCK)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to create eventfd: %s", err)
+	}
+
+	// Take the initial snapshot after opening mountinfo, so that changes
+	// in between are not lost.
+	mounts, err := GetMountsPid(pid)
+	if err != nil {
+		f.Close()
+		unix.Close(wakeFd)
+		return nil, err
+	}
+
+	w := &Watcher{
+		pid:       pid,
+		cfg:       *cfg,
+		mountinfo: f,
+		wakeFd:    wakeFd,
+		mounts:    mounts,
+		eventCh:   make(chan []MountEvent, cfg.EventBufSize),
+		stopCh:    make(chan struct{}),
+		doneCh:    make(chan struct{}),
+	}
+
+	go w.watch()
+
+	return w, nil
+}
+
+// Events returns the channel on which mount events are delivered. The channel
+// is closed when the watcher is closed.
+func (w *Watcher) Events() <-chan []MountEvent {
+	return w.eventCh
+}
+
+// Close stops the watcher and waits for its thread to exit. It's safe to call
+// it multiple times.
+func (w *Watcher) Close() {
+	w.closeOnce.Do(func() {
+		close(w.stopCh)
+		one := []byte{1, 0, 0, 0, 0, 0, 0, 0}
+		unix.Write(w.wakeFd, one)
+		<-w.doneCh
+		w.mountinfo.Close()
+		unix.Close(w.wakeFd)
+	})
+}
+
+func (w *Watcher) watch() {
+	defer func() {
+		close(w.eventCh)
+		close(w.doneCh)
+	}()
+
+	fds := []unix.PollFd{
+		{Fd: int32(w.mountinfo.Fd()), Events: unix.POLLPRI},
+		{Fd: int32(w.wakeFd), Events: unix.POLLIN},
+	}
+
+	timeout := -1
+	if w.cfg.RescanInterval > 0 {
+		timeout = int(w.cfg.RescanInterval.Milliseconds())
+	}
+
+	for {
+		n, err := unix.Poll(fds, timeout)
+		if err != nil {
+			if errors.Is(err, unix.EINTR) {
+				continue
+			}
+			w.send([]MountEvent{{Err: fmt.Errorf("poll on mountinfo failed: %s", err)}})
+			return
+		}
+
+		select {
+		case <-w.stopCh:
+			return
+		default:
+		}
+
+		// n == 0 means the rescan interval expired
+		if n > 0 && fds[0].Revents&(unix.POLLPRI|unix.POLLERR) == 0 {
+			continue
+		}
+
+		mounts, err := GetMountsPid(w.pid)
+		if err != nil {
+			w.send([]MountEvent{{Err: err}})
+			return
+		}
+
+		events := diffMounts(w.mounts, mounts)
+		w.mounts = mounts
+
+		if len(events) > 0 && !w.send(events) {
+			return
+		}
+	}
+}
+
+// send delivers the given events; returns false if the watcher was stopped
+// while waiting for the consumer.
+func (w *Watcher) send(events []MountEvent) bool {
+	select {
+	case w.eventCh <- events:
+		return true
+	case <-w.stopCh:
+		return false
+	}
+}
+
+// mountKey returns the key used to match mounts across snapshots. It's the
+// (reusable) mount ID, which both statmount(2) and mountinfo snapshots have,
+// so that snapshots from different backends can be compared; reuse is caught
+// by sameMount().
+func mountKey(m *Info) uint64 {
+	return uint64(m.ID)
+}
+
+// mountChanged returns true if the attributes of the given infos (which refer
+// to the same mount) differ. The unique mount ID is only compared if both
+// have it (i.e., both come from statmount(2)).
+func mountChanged(a, b *Info) bool {
+	if a.UniqueID == 0 || b.UniqueID == 0 {
+		ac, bc := *a, *b
+		ac.UniqueID, bc.UniqueID = 0, 0
+		return ac != bc
+	}
+	return *a != *b
+}
+
+// sameMount returns true if the given infos refer to the same mount (mount
+// IDs may be reused after unmount; unique mount IDs are not).
+func sameMount(a, b *Info) bool {
+	if a.UniqueID != 0 && b.UniqueID != 0 {
+		return a.UniqueID == b.UniqueID
+	}
+	return a.Mountpoint == b.Mountpoint && a.Root == b.Root &&
+		a.Major == b.Major && a.Minor == b.Minor && a.Fstype == b.Fstype
+}
+
+// diffMounts compares two mount table snapshots and returns the resulting
+// mount events (removals first, then additions and changes in mount order).
+func diffMounts(prev, curr []*Info) []MountEvent {
+	events := []MountEvent{}
+
+	currMap := make(map[uint64]*Info, len(curr))
+	for _, m := range curr {
+		currMap[mountKey(m)] = m
+	}
+
+	prevMap := make(map[uint64]*Info, len(prev))
+	for _, m := range prev {
+		key := mountKey(m)
+		prevMap[key] = m
+		if c, found := currMap[key]; !found || !sameMount(m, c) {
+			events = append(events, MountEvent{Type: MountRemoved, Mount: m})
+		}
+	}
+
+	for _, m := range curr {
+		p, found := prevMap[mountKey(m)]
+		if !found || !sameMount(p, m) {
+			events = append(events, MountEvent{Type: MountAdded, Mount: m})
+		} else if mountChanged(p, m) {
+			events = append(events, MountEvent{Type: MountChanged, Mount: m, Old: p})
+		}
+	}
+
+	return events
+}
@@ -0,0 +1,322 @@
+//
+// Copyright 2026 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package overlayUtils
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nestybox/sysbox-libs/mount"
+	"golang.org/x/sys/unix"
+)
+
+// Max number of stacked overlayfs mounts allowed by the kernel
+// (FILESYSTEM_MAX_STACK_DEPTH).
+const MaxStackDepth = 2
+
+// Types of problems reported by CheckMount()
+type ProblemKind int
+
+const (
+	LayerMissing            ProblemKind = iota // layer dir does not exist (e.g., deleted under the mount)
+	LayerNotDir                                // layer path is not a directory
+	LayerStatFailed                            // layer dir could not be stat'ed
+	UpperWithoutWork                           // upperdir given without workdir (or vice-versa)
+	UpperWorkFsMismatch                        // upperdir and workdir are on different filesystems
+	WorkDirUnclean                             // workdir has unexpected entries
+	NfsExportWithoutIndex                      // nfs_export=on requires index=on
+	MetacopyWithNfsExport                      // metacopy=on conflicts with nfs_export=on
+	MetacopyWithoutRedirect                    // metacopy=on requires redirect_dir=on
+	XinoOffMultiFs                             // layers span several filesystems but xino=off
+	StackTooDeep                               // overlay nesting exceeds MaxStackDepth
+)
+
+var problemKindStr = map[ProblemKind]string{
+	LayerMissing:            "layer missing",
+	LayerNotDir:             "layer not a directory",
+	LayerStatFailed:         "layer stat failed",
+	UpperWithoutWork:        "upper/work mismatch",
+	UpperWorkFsMismatch:     "upper/work on different filesystems",
+	WorkDirUnclean:          "workdir unclean",
+	NfsExportWithoutIndex:   "nfs_export without index",
+	MetacopyWithNfsExport:   "metacopy with nfs_export",
+	MetacopyWithoutRedirect: "metacopy without redirect_dir",
+	XinoOffMultiFs:          "xino off with multiple filesystems",
+	StackTooDeep:            "stack too deep",
+}
+
+func (k ProblemKind) String() string {
+	if s, ok := problemKindStr[k]; ok {
+		return s
+	}
+	return fmt.Sprintf("unknown problem (%d)", int(k))
+}
+
+// Problem describes an issue found on an overlayfs mount.
+type Problem struct {
+	Kind ProblemKind
+	Path string // layer path associated with the problem (if any)
+	Msg  string
+}
+
+func (p Problem) String() string {
+	if p.Path != "" {
+		return fmt.Sprintf("%s: %s (%s)", p.Kind, p.Msg, p.Path)
+	}
+	return fmt.Sprintf("%s: %s", p.Kind, p.Msg)
+}
+
+// CheckResult is the outcome of CheckMount().
+type CheckResult struct {
+	Problems []Problem
+
+	// Number of stacked overlayfs mounts, starting with (and including) the
+	// checked mount (i.e., 1 means no lower or upper layer is on overlayfs).
+	StackDepth int
+}
+
+// Healthy returns true if no problems were found.
+func (r *CheckResult) Healthy() bool {
+	return len(r.Problems) == 0
+}
+
+// CheckMount verifies the health and consistency of the given overlayfs mount:
+// it checks that all layer dirs exist, that the upper and work dirs share a
+// filesystem, that the work dir is in a sane state and that the index / xino
+// related options are consistent. The given mount table is used to compute the
+// overlayfs nesting depth (i.e., overlayfs mounts whose layers are themselves
+// on overlayfs).
+func CheckMount(mi *mount.Info, mounts []*mount.Info) (*CheckResult, error) {
+
+	if mi.Fstype != "overlay" {
+		return nil, fmt.Errorf("%s is not an overlayfs mount (fstype = %s)", mi.Mountpoint, mi.Fstype)
+	}
+
+	res := &CheckResult{}
+	mntOpts := GetMountOpt(mi)
+
+	lowerLayers := []string{}
+	for _, l := range GetLowerLayers(mntOpts) {
+		// data-only lower layers are separated with "::"
+		if l != "" {
+			lowerLayers = append(lowerLayers, l)
+		}
+	}
+	upper := GetUpperLayer(mntOpts)
+	work := GetWorkLayer(mntOpts)
+
+	// Verify all layer dirs exist; collect their devices along the way.
+	devs := map[uint64]bool{}
+	layers := append([]string{}, lowerLayers...)
+	if upper != "" {
+		layers = append(layers, upper)
+	}
+	if work != "" {
+		layers = append(layers, work)
+	}
+
+	for _, layer := range layers {
+		var st unix.Stat_t
+		if err := unix.Stat(layer, &st); err != nil {
+			if err == unix.ENOENT {
+				res.addProblem(LayerMissing, layer, "layer dir does not exist")
+			} else {
+				res.addProblem(LayerStatFailed, layer, err.Error())
+			}
+			continue
+		}
+		if st.Mode&unix.S_IFMT != unix.S_IFDIR {
+			res.addProblem(LayerNotDir, layer, "layer is not a directory")
+			continue
+		}
+		if layer != work {
+			devs[st.Dev] = true
+		}
+	}
+
+	if (upper == "") != (work == "") {
+		res.addProblem(UpperWithoutWork, "", "upperdir and workdir must be given together")
+	}
+
+	if upper != "" && work != "" {
+		checkUpperWork(res, upper, work, GetVolatile(mntOpts))
+	}
+
+	checkFeatureOpts(res, mntOpts, len(devs))
+
+	depth, err := stackDepth(mi, mounts, map[int]bool{})
+	if err != nil {
+		return nil, err
+	}
+	res.StackDepth = depth
+
+	if depth > MaxStackDepth {
+		res.addProblem(StackTooDeep, "", fmt.Sprintf("overlayfs stack depth is %d (max %d)", depth, MaxStackDepth))
+	}
+
+	return res, nil
+}
+
+func (r *CheckResult) addProblem(kind ProblemKind, path, msg string) {
+	r.Problems = append(r.Problems, Problem{
+		Kind: kind,
+		Path: path,
+		Msg:  msg,
+	})
+}
+
+// checkUpperWork verifies the upper and work dirs are on the same filesystem
+// and that the work dir only has entries created by overlayfs itself.
+func checkUpperWork(res *CheckResult, upper, work string, volatile bool) {
+	var upperSt, workSt unix.Stat_t
+
+	if err := unix.Stat(upper, &upperSt); err != nil {
+		return
+	}
+	if err := unix.Stat(work, &workSt); err != nil {
+		return
+	}
+
+	if upperSt.Dev != workSt.Dev {
+		res.addProblem(UpperWorkFsMismatch, work,
+			fmt.Sprintf("upperdir (dev %d) and workdir (dev %d) are on different filesystems", upperSt.Dev, workSt.Dev))
+	}
+
+	entries, err := os.ReadDir(work)
+	if err != nil {
+		res.addProblem(WorkDirUnclean, work, fmt.Sprintf("failed to read workdir: %s", err))
+		return
+	}
+
+	// overlayfs creates "work" (temp files for copy-up / whiteouts) and
+	// "index" (when index=on) in the workdir. Volatile mounts also create
+	// "work/incompat/volatile".
+	for _, e := range entries {
+		name := e.Name()
+		if name != "work" && name != "index" {
+			res.addProblem(WorkDirUnclean, filepath.Join(work, name), "unexpected entry in workdir")
+		}
+	}
+
+	tmpEntries, err := os.ReadDir(filepath.Join(work, "work"))
+	if err != nil {
+		return
+	}
+	for _, e := range tmpEntries {
+		// temp files of in-progress copy-ups / whiteouts on the live mount
+		// (the kernel names them "#<hex>"; leftovers are cleaned up on mount)
+		if strings.HasPrefix(e.Name(), "#") {
+			continue
+		}
+		if volatile && e.Name() == "incompat" {
+			continue
+		}
+		res.addProblem(WorkDirUnclean, filepath.Join(work, "work", e.Name()), "leftover entry in workdir temp dir")
+	}
+}
+
+// checkFeatureOpts verifies the consistency of the index, nfs_export,
+// metacopy, redirect_dir and xino options.
+func checkFeatureOpts(res *CheckResult, mntOpts *MountOpts, numDevs int) {
+	index := getOptVal(mntOpts, "index")
+	nfsExport := getOptVal(mntOpts, "nfs_export")
+	metacopy := getOptVal(mntOpts, "metacopy")
+	redirect := getOptVal(mntOpts, "redirect_dir")
+	xino := getOptVal(mntOpts, "xino")
+
+	if nfsExport == "on" && index == "off" {
+		res.addProblem(NfsExportWithoutIndex, "", "nfs_export=on requires index=on")
+	}
+
+	if metacopy == "on" && nfsExport == "on" {
+		res.addProblem(MetacopyWithNfsExport, "", "metacopy=on conflicts with nfs_export=on")
+	}
+
+	if metacopy == "on" && (redirect == "off" || redirect == "nofollow") {
+		res.addProblem(MetacopyWithoutRedirect, "", fmt.Sprintf("metacopy=on requires redirect_dir=on (found %s)", redirect))
+	}
+
+	if xino == "off" && numDevs > 1 {
+		res.addProblem(XinoOffMultiFs, "", fmt.Sprintf("layers span %d filesystems but xino=off; inode numbers are not unique", numDevs))
+	}
+}
+
+// getOptVal returns the value of the overlayfs option with the given key (or
+// "" if not present).
+func getOptVal(mntOpts *MountOpts, key string) string {
+	return mount.ParseOptions(mntOpts.Opts)[key]
+}
+
+// stackDepth returns the number of stacked overlayfs mounts starting at the
+// given mount.
+func stackDepth(mi *mount.Info, mounts []*mount.Info, visited map[int]bool) (int, error) {
+
+	if visited[mi.ID] {
+		return 0, fmt.Errorf("loop detected in overlayfs stack at %s", mi.Mountpoint)
+	}
+	visited[mi.ID] = true
+	defer delete(visited, mi.ID)
+
+	mntOpts := GetMountOpt(mi)
+	layers := GetLowerLayers(mntOpts)
+	if upper := GetUpperLayer(mntOpts); upper != "" {
+		layers = append(layers, upper)
+	}
+
+	maxDepth := 0
+	for _, layer := range layers {
+		if layer == "" {
+			continue
+		}
+		lm := findBackingMount(layer, mounts)
+		if lm == nil || lm.Fstype != "overlay" || lm.ID == mi.ID {
+			continue
+		}
+		depth, err := stackDepth(lm, mounts, visited)
+		if err != nil {
+			return 0, err
+		}
+		if depth > maxDepth {
+			maxDepth = depth
+		}
+	}
+
+	return maxDepth + 1, nil
+}
+
+// findBackingMount returns the mount on which the given path resides (i.e.,
+// the last mount in the table whose mountpoint is the longest prefix of the
+// path).
+func findBackingMount(path string, mounts []*mount.Info) *mount.Info {
+	var best *mount.Info
+
+	path = filepath.Clean(path)
+
+	for _, m := range mounts {
+		mp := m.Mountpoint
+		if path != mp && mp != "/" && !strings.HasPrefix(path, mp+"/") {
+			continue
+		}
+		if best == nil || len(mp) >= len(best.Mountpoint) {
+			best = m
+		}
+	}
+
+	return best
+}
@@ -0,0 +1,195 @@
+//
+// Copyright 2026 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package overlayUtils
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nestybox/sysbox-libs/mount"
+)
+
+// creates the lower, upper and work dirs for a fake overlayfs mount
+func setupLayers(t *testing.T) (string, string, string, string) {
+	tmpDir := t.TempDir()
+
+	lower := filepath.Join(tmpDir, "lower")
+	upper := filepath.Join(tmpDir, "upper")
+	work := filepath.Join(tmpDir, "work")
+
+	for _, dir := range []string{lower, upper, filepath.Join(work, "work")} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return tmpDir, lower, upper, work
+}
+
+func hasProblem(res *CheckResult, kind ProblemKind) bool {
+	for _, p := range res.Problems {
+		if p.Kind == kind {
+			return true
+		}
+	}
+	return false
+}
+
+func TestCheckMountHealthy(t *testing.T) {
+	tmpDir, lower, upper, work := setupLayers(t)
+
+	mi := &mount.Info{
+		ID:         100,
+		Parent:     1,
+		Mountpoint: filepath.Join(tmpDir, "merged"),
+		Fstype:     "overlay",
+		VfsOpts:    fmt.Sprintf("rw,lowerdir=%s,upperdir=%s,workdir=%s", lower, upper, work),
+	}
+
+	res, err := CheckMount(mi, []*mount.Info{mi})
+	if err != nil {
+		t.Fatalf("CheckMount() failed: %v", err)
+	}
+	if !res.Healthy() {
+		t.Fatalf("CheckMount() reported problems: %v", res.Problems)
+	}
+	if res.StackDepth != 1 {
+		t.Fatalf("CheckMount() failed: want stack depth 1, got %d", res.StackDepth)
+	}
+}
+
+func TestCheckMountProblems(t *testing.T) {
+	tmpDir, lower, upper, work := setupLayers(t)
+
+	// lower layer deleted under the mount, plus garbage in the workdir
+	missing := filepath.Join(tmpDir, "deleted")
+	if err := os.WriteFile(filepath.Join(work, "garbage"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	mi := &mount.Info{
+		ID:         100,
+		Parent:     1,
+		Mountpoint: filepath.Join(tmpDir, "merged"),
+		Fstype:     "overlay",
+		VfsOpts: fmt.Sprintf("rw,lowerdir=%s:%s,upperdir=%s,workdir=%s,nfs_export=on,index=off,metacopy=on,redirect_dir=off",
+			lower, missing, upper, work),
+	}
+
+	res, err := CheckMount(mi, []*mount.Info{mi})
+	if err != nil {
+		t.Fatalf("CheckMount() failed: %v", err)
+	}
+
+	want := []ProblemKind{LayerMissing, WorkDirUnclean, NfsExportWithoutIndex, MetacopyWithNfsExport, MetacopyWithoutRedirect}
+	for _, kind := range want {
+		if !hasProblem(res, kind) {
+			t.Fatalf("CheckMount() failed: problem %q not reported (got %v)", kind, res.Problems)
+		}
+	}
+
+	// index=on without an upper layer is ignored by the kernel
+	mi.VfsOpts = fmt.Sprintf("ro,lowerdir=%s,index=on", lower)
+
+	res, err = CheckMount(mi, []*mount.Info{mi})
+	if err != nil {
+		t.Fatalf("CheckMount() failed: %v", err)
+	}
+	if !res.Healthy() {
+		t.Fatalf("CheckMount() reported problems: %v", res.Problems)
+	}
+
+	// negative testing
+	mi.Fstype = "ext4"
+	if _, err := CheckMount(mi, []*mount.Info{mi}); err == nil {
+		t.Fatalf("CheckMount() on non-overlayfs mount passed; expected failure")
+	}
+}
+
+func TestCheckMountWorkDir(t *testing.T) {
+	tmpDir, lower, upper, work := setupLayers(t)
+
+	mi := &mount.Info{
+		ID:         100,
+		Parent:     1,
+		Mountpoint: filepath.Join(tmpDir, "merged"),
+		Fstype:     "overlay",
+		VfsOpts:    fmt.Sprintf("rw,lowerdir=%s,upperdir=%s,workdir=%s", lower, upper, work),
+	}
+
+	// copy-up temp files of the live mount are expected
+	if err := os.WriteFile(filepath.Join(work, "work", "#1f"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := CheckMount(mi, []*mount.Info{mi})
+	if err != nil {
+		t.Fatalf("CheckMount() failed: %v", err)
+	}
+	if !res.Healthy() {
+		t.Fatalf("CheckMount() reported problems: %v", res.Problems)
+	}
+
+	// anything else is not
+	if err := os.WriteFile(filepath.Join(work, "work", "garbage"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err = CheckMount(mi, []*mount.Info{mi})
+	if err != nil {
+		t.Fatalf("CheckMount() failed: %v", err)
+	}
+	if !hasProblem(res, WorkDirUnclean) {
+		t.Fatalf("CheckMount() failed: problem %q not reported (got %v)", WorkDirUnclean, res.Problems)
+	}
+}
+
+func TestCheckMountStackDepth(t *testing.T) {
+	tmpDir, lower, upper, work := setupLayers(t)
+
+	// ovl1 -> ovl2 -> ovl3 (each has its lower layer on the next one)
+	mounts := []*mount.Info{}
+	for i := 3; i >= 1; i-- {
+		mp := filepath.Join(tmpDir, fmt.Sprintf("ovl%d", i))
+		lowerdir := lower
+		if i < 3 {
+			lowerdir = filepath.Join(tmpDir, fmt.Sprintf("ovl%d", i+1), "layer")
+		}
+		mounts = append(mounts, &mount.Info{
+			ID:         100 + i,
+			Parent:     1,
+			Mountpoint: mp,
+			Fstype:     "overlay",
+			VfsOpts:    fmt.Sprintf("rw,lowerdir=%s,upperdir=%s,workdir=%s", lowerdir, upper, work),
+		})
+	}
+
+	top := mounts[len(mounts)-1]
+
+	res, err := CheckMount(top, mounts)
+	if err != nil {
+		t.Fatalf("CheckMount() failed: %v", err)
+	}
+	if res.StackDepth != 3 {
+		t.Fatalf("CheckMount() failed: want stack depth 3, got %d", res.StackDepth)
+	}
+	if !hasProblem(res, StackTooDeep) {
+		t.Fatalf("CheckMount() failed: problem %q not reported (got %v)", StackTooDeep, res.Problems)
+	}
+}
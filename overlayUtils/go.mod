@@ -5,7 +5,8 @@ go 1.22
 toolchain go1.22.6
 
 require (
-	github.com/deckarep/golang-set v1.8.0
 	github.com/nestybox/sysbox-libs/mount v0.0.0-20240602025437-33cbdf5a9e98
 	golang.org/x/sys v0.26.0
 )
+
+replace github.com/nestybox/sysbox-libs/mount => ../mount
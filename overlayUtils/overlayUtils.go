@@ -19,10 +19,8 @@
 package overlayUtils
 
 import (
-	"fmt"
 	"strings"
 
-	mapset "github.com/deckarep/golang-set"
 	"github.com/nestybox/sysbox-libs/mount"
 	"golang.org/x/sys/unix"
 )
@@ -37,57 +35,26 @@ type MountOpts struct {
 // propagation flags of the overlayfs mount at the given path.
 func GetMountOpt(mi *mount.Info) *MountOpts {
 
-	currMntOpts := mapset.NewSet()
-	for _, opt := range strings.Split(mi.Opts, ",") {
-		currMntOpts.Add(opt)
-	}
-
-	currVfsOpts := mapset.NewSet()
-	for _, opt := range strings.Split(mi.VfsOpts, ",") {
-		currVfsOpts.Add(opt)
-	}
-
 	// The vfs opts reported by mountinfo are a combination of per superblock
 	// mount opts and the overlayfs-specific data; we need to separate these so
 	// we can do the mount properly.
-	properMntOpts := mapset.NewSetFromSlice([]interface{}{
-		"ro", "rw", "nodev", "noexec", "nosuid", "noatime", "nodiratime", "relatime", "strictatime", "sync",
-	})
-
-	newMntOpts := currVfsOpts.Intersect(properMntOpts)
-	newVfsOpts := currVfsOpts.Difference(properMntOpts)
-
-	// Convert the mount options to the mount flags
-	newMntOptsString := []string{}
-	for _, opt := range newMntOpts.ToSlice() {
-		newMntOptsString = append(newMntOptsString, fmt.Sprintf("%s", opt))
-	}
-	mntFlags := mount.OptionsToFlags(newMntOptsString)
-
-	// Convert the vfs option set to the mount data string
-	newVfsOptsString := ""
-	for i, opt := range newVfsOpts.ToSlice() {
-		if i != 0 {
-			newVfsOptsString += ","
-		}
-		newVfsOptsString += fmt.Sprintf("%s", opt)
-	}
+	mntFlags, _, vfsOpts := mount.SplitOptions(mi.VfsOpts)
 
 	// Get the mount propagation flags
 	propFlags := 0
 
-	if strings.Contains(mi.Optional, "shared") {
+	if mi.Shared != 0 {
 		propFlags |= unix.MS_SHARED
-	} else if strings.Contains(mi.Optional, "master") {
+	} else if mi.Master != 0 {
 		propFlags |= unix.MS_SLAVE
-	} else if strings.Contains(mi.Optional, "unbindable") {
+	} else if mi.Unbindable {
 		propFlags |= unix.MS_UNBINDABLE
 	} else {
 		propFlags |= unix.MS_PRIVATE
 	}
 
 	mntOpts := &MountOpts{
-		Opts:      newVfsOptsString,
+		Opts:      vfsOpts,
 		Flags:     mntFlags,
 		PropFlags: propFlags,
 	}
@@ -0,0 +1,231 @@
+//
+// Copyright 2026 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package pidfd
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"runtime"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const sys_clone3 = 435
+
+// flags accepted by Clone3() (CLONE_PIDFD is implied)
+const cloneAllowedFlags = unix.CLONE_NEWNS | unix.CLONE_NEWCGROUP | unix.CLONE_NEWUTS | unix.CLONE_NEWIPC |
+	unix.CLONE_NEWUSER | unix.CLONE_NEWPID | unix.CLONE_NEWNET | unix.CLONE_NEWTIME |
+	unix.CLONE_INTO_CGROUP | unix.CLONE_PIDFD
+
+// size of the kernel's sigset_t (_NSIG / 8)
+const sigsetSize = 8
+
+// CloneArgs holds the arguments of Clone3().
+type CloneArgs struct {
+	Flags      uint64         // CLONE_* flags (e.g., namespace flags); CLONE_PIDFD is implied
+	ExitSignal syscall.Signal // signal sent to the parent when the child exits (0 means none)
+	CgroupFd   int            // fd of the cgroup v2 dir to place the child in (only with CLONE_INTO_CGROUP; kernel 5.7+)
+	Pdeathsig  syscall.Signal // signal sent to the child when the calling thread exits (0 means none)
+}
+
+// struct clone_args (CLONE_ARGS_SIZE_VER2)
+type cloneArgs struct {
+	flags      uint64
+	pidfd      uint64
+	childTid   uint64
+	parentTid  uint64
+	exitSignal uint64
+	stack      uint64
+	stackSize  uint64
+	tls        uint64
+	setTid     uint64
+	setTidSize uint64
+	cgroup     uint64
+}
+
+// What the child does between clone3() and execve(); prepared by the parent,
+// since the child can't allocate.
+type childArgs struct {
+	path      *byte
+	argv      **byte
+	envv      **byte
+	pdeathsig uintptr
+	sigmask   *uint64 // restored before execve()
+	errPipe   uintptr // execve() failures are reported here
+	errno     *uint32
+}
+
+// Clone3 creates a child process with clone3() (kernel 5.3+) that executes the
+// given program, as execve(2) does (argv includes the program name). A pidfd
+// for the child is returned along with its pid, so the child can't be confused
+// with another process (even if it exits and its pid is reused before the
+// caller gets to it); the caller must close the pidfd.
+//
+// The child is a copy of the caller (there's no CLONE_VM), with a single
+// thread and the Go runtime in an unknown state, so it only sets its parent
+// death signal and its signal mask with raw syscalls before calling execve();
+// it runs no other Go code. Returns an error if the child fails to execute the
+// program (in which case it has been reaped).
+//
+// Only namespace flags (CLONE_NEW*) and CLONE_INTO_CGROUP are accepted in
+// args.Flags (others, such as CLONE_VM, would have the child run on the
+// caller's memory); fails with EINVAL otherwise.
+func Clone3(args *CloneArgs, path string, argv, envv []string) (int, PidFd, error) {
+	if args.Flags&^cloneAllowedFlags != 0 {
+		return -1, -1, syscall.EINVAL
+	}
+
+	pathp, err := syscall.BytePtrFromString(path)
+	if err != nil {
+		return -1, -1, err
+	}
+	argvp, err := syscall.SlicePtrFromStrings(argv)
+	if err != nil {
+		return -1, -1, err
+	}
+	envvp, err := syscall.SlicePtrFromStrings(envv)
+	if err != nil {
+		return -1, -1, err
+	}
+
+	// the pipe is closed on a successful execve() (O_CLOEXEC)
+	var p [2]int
+	if err := unix.Pipe2(p[:], unix.O_CLOEXEC); err != nil {
+		return -1, -1, err
+	}
+	defer unix.Close(p[0])
+
+	// the kernel stores the pidfd here; it must not live on the (movable)
+	// goroutine stack
+	fd := new(int32)
+	*fd = -1
+
+	ca := &cloneArgs{
+		flags:      args.Flags | unix.CLONE_PIDFD,
+		pidfd:      uint64(uintptr(unsafe.Pointer(fd))),
+		exitSignal: uint64(args.ExitSignal),
+	}
+	if args.Flags&unix.CLONE_INTO_CGROUP != 0 {
+		ca.cgroup = uint64(args.CgroupFd)
+	}
+
+	ch := &childArgs{
+		path:      pathp,
+		argv:      &argvp[0],
+		envv:      &envvp[0],
+		pdeathsig: uintptr(args.Pdeathsig),
+		sigmask:   new(uint64),
+		errPipe:   uintptr(p[1]),
+		errno:     new(uint32),
+	}
+
+	// Block all signals across clone3(), so that no Go signal handler runs in
+	// the child; the child restores the mask before execve().
+	allSigs := ^uint64(0)
+
+	runtime.LockOSThread()
+	syscall.RawSyscall6(unix.SYS_RT_SIGPROCMASK, unix.SIG_SETMASK, uintptr(unsafe.Pointer(&allSigs)), uintptr(unsafe.Pointer(ch.sigmask)), sigsetSize, 0, 0)
+	pid, errno := clone3Exec(ca, ch)
+	syscall.RawSyscall6(unix.SYS_RT_SIGPROCMASK, unix.SIG_SETMASK, uintptr(unsafe.Pointer(ch.sigmask)), 0, sigsetSize, 0, 0)
+	runtime.UnlockOSThread()
+
+	runtime.KeepAlive(fd)
+	runtime.KeepAlive(ca)
+	runtime.KeepAlive(ch)
+	runtime.KeepAlive(pathp)
+	runtime.KeepAlive(argvp)
+	runtime.KeepAlive(envvp)
+
+	unix.Close(p[1])
+
+	if errno != 0 {
+		return -1, -1, errno
+	}
+	pidFd := PidFd(*fd)
+
+	// wait for the child to execute the program (EOF) or to fail to
+	var buf [4]byte
+	n, err := readFull(p[0], buf[:])
+	if err != nil || n == len(buf) {
+		if err == nil {
+			err = syscall.Errno(binary.NativeEndian.Uint32(buf[:]))
+		} else {
+			pidFd.SendSignal(unix.SIGKILL, 0)
+		}
+
+		// __WALL: the child may have no exit signal (i.e., not SIGCHLD)
+		if _, werr := pidFd.Waitid(nil, unix.WEXITED|unix.WALL, nil); werr != nil {
+			err = errors.Join(err, fmt.Errorf("failed to reap pid %d: %s", pid, werr))
+		}
+		pidFd.Close()
+		return -1, -1, err
+	}
+
+	return int(pid), pidFd, nil
+}
+
+// clone3Exec calls clone3() and, in the child, execve(). The child may not
+// run anything but raw syscalls (no allocation, stack growth, or scheduling).
+//
+//go:norace
+//go:nosplit
+func clone3Exec(ca *cloneArgs, ch *childArgs) (uintptr, syscall.Errno) {
+	pid, _, errno := syscall.RawSyscall(sys_clone3, uintptr(unsafe.Pointer(ca)), unsafe.Sizeof(*ca), 0)
+	if errno != 0 || pid != 0 {
+		return pid, errno
+	}
+
+	// in the child
+	if ch.pdeathsig != 0 {
+		_, _, errno = syscall.RawSyscall6(unix.SYS_PRCTL, unix.PR_SET_PDEATHSIG, ch.pdeathsig, 0, 0, 0, 0)
+	}
+	if errno == 0 {
+		_, _, errno = syscall.RawSyscall6(unix.SYS_RT_SIGPROCMASK, unix.SIG_SETMASK, uintptr(unsafe.Pointer(ch.sigmask)), 0, sigsetSize, 0, 0)
+	}
+	if errno == 0 {
+		_, _, errno = syscall.RawSyscall(unix.SYS_EXECVE, uintptr(unsafe.Pointer(ch.path)), uintptr(unsafe.Pointer(ch.argv)), uintptr(unsafe.Pointer(ch.envv)))
+	}
+
+	*ch.errno = uint32(errno)
+	syscall.RawSyscall(unix.SYS_WRITE, ch.errPipe, uintptr(unsafe.Pointer(ch.errno)), 4)
+
+	for {
+		syscall.RawSyscall(unix.SYS_EXIT, 127, 0, 0)
+	}
+}
+
+// readFull reads into buf until it's full or EOF, retrying on EINTR.
+func readFull(fd int, buf []byte) (int, error) {
+	n := 0
+	for n < len(buf) {
+		m, err := unix.Read(fd, buf[n:])
+		if err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			return n, err
+		}
+		if m == 0 {
+			break
+		}
+		n += m
+	}
+	return n, nil
+}
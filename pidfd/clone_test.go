@@ -0,0 +1,150 @@
+//
+// Copyright 2026 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package pidfd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+// shPath returns the path of sh(1).
+func shPath(t *testing.T) string {
+	path, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skipf("sh not found: %s", err)
+	}
+	return path
+}
+
+func TestClone3(t *testing.T) {
+	sh := shPath(t)
+
+	pid, fd, err := Clone3(&CloneArgs{ExitSignal: unix.SIGCHLD}, sh, []string{"sh", "-c", "exit 3"}, nil)
+	if errors.Is(err, unix.ENOSYS) {
+		t.Skip("clone3() not supported")
+	}
+	if err != nil {
+		t.Fatalf("Clone3() failed: %s", err)
+	}
+	defer fd.Close()
+
+	if got, err := fd.Pid(); err != nil || got != pid {
+		t.Fatalf("Clone3() failed: pidfd refers to pid %d (%v), want %d", got, err, pid)
+	}
+
+	var ws syscall.WaitStatus
+	if _, err := fd.Waitid(&ws, unix.WEXITED, nil); err != nil {
+		t.Fatalf("Waitid() failed: %s", err)
+	}
+	if !ws.Exited() || ws.ExitStatus() != 3 {
+		t.Fatalf("Clone3() failed: want exit status 3, got %#x", ws)
+	}
+}
+
+func TestClone3ExecFailure(t *testing.T) {
+	// the child is reaped whatever its exit signal
+	for _, sig := range []syscall.Signal{unix.SIGCHLD, 0} {
+		_, _, err := Clone3(&CloneArgs{ExitSignal: sig}, "/nonexistent", []string{"nonexistent"}, nil)
+		if errors.Is(err, unix.ENOSYS) {
+			t.Skip("clone3() not supported")
+		}
+		if err != unix.ENOENT {
+			t.Fatalf("Clone3() (exit signal %d) failed: want %v, got %v", sig, unix.ENOENT, err)
+		}
+	}
+
+	// flags that would share the caller's memory are rejected
+	for _, flags := range []uint64{unix.CLONE_VM, unix.CLONE_VFORK, unix.CLONE_THREAD, unix.CLONE_SETTLS, unix.CLONE_PARENT_SETTID} {
+		if _, _, err := Clone3(&CloneArgs{Flags: flags}, "/nonexistent", []string{"nonexistent"}, nil); err != unix.EINVAL {
+			t.Fatalf("Clone3() with flags %#x failed: want %v, got %v", flags, unix.EINVAL, err)
+		}
+	}
+}
+
+// cgroup2Mount returns the mountpoint of the cgroup v2 hierarchy (if any).
+func cgroup2Mount() string {
+	data, err := os.ReadFile("/proc/self/mountinfo")
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		for i, f := range fields {
+			if f == "-" && i+1 < len(fields) && fields[i+1] == "cgroup2" {
+				return fields[4]
+			}
+		}
+	}
+	return ""
+}
+
+func TestClone3IntoCgroup(t *testing.T) {
+	mnt := cgroup2Mount()
+	if mnt == "" {
+		t.Skip("cgroup v2 not mounted")
+	}
+	cg, err := os.MkdirTemp(mnt, "pidfd-test-")
+	if err != nil {
+		t.Skipf("failed to create cgroup: %s", err)
+	}
+	defer os.Remove(cg)
+
+	cgFd, err := unix.Open(cg, unix.O_PATH|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unix.Close(cgFd)
+
+	args := &CloneArgs{
+		Flags:      unix.CLONE_INTO_CGROUP,
+		ExitSignal: unix.SIGCHLD,
+		CgroupFd:   cgFd,
+	}
+	pid, fd, err := Clone3(args, shPath(t), []string{"sh", "-c", "exit 0"}, nil)
+	if err != nil {
+		t.Skipf("Clone3() with CLONE_INTO_CGROUP failed: %s", err)
+	}
+	defer fd.Close()
+
+	// check the cgroup while the child is a zombie
+	var ws syscall.WaitStatus
+	if _, err := fd.Waitid(&ws, unix.WEXITED|unix.WNOWAIT, nil); err != nil {
+		t.Fatalf("Waitid() failed: %s", err)
+	}
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/cgroup", pid))
+	fd.Waitid(&ws, unix.WEXITED, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the cgroup v2 entry is "0::<path>"
+	want := "/" + filepath.Base(cg)
+	for _, line := range strings.Split(string(data), "\n") {
+		if path, found := strings.CutPrefix(line, "0::"); found && strings.HasSuffix(path, want) {
+			return
+		}
+	}
+	t.Fatalf("Clone3() failed: child not in cgroup %s: %s", cg, data)
+}
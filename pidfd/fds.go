@@ -0,0 +1,278 @@
+//
+// Copyright 2026 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package pidfd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// Types of the fds of a process
+type FdType int
+
+const (
+	FdOther     FdType = iota // unknown type
+	FdFile                    // regular file
+	FdDir                     // directory
+	FdSocket                  // socket
+	FdPipe                    // pipe or fifo
+	FdDevice                  // character or block device
+	FdAnonInode               // anon inode (e.g., eventfd, epoll, pidfd)
+)
+
+func (t FdType) String() string {
+	switch t {
+	case FdFile:
+		return "file"
+	case FdDir:
+		return "dir"
+	case FdSocket:
+		return "socket"
+	case FdPipe:
+		return "pipe"
+	case FdDevice:
+		return "device"
+	case FdAnonInode:
+		return "anon_inode"
+	}
+	return "other"
+}
+
+// FdInfo describes an fd of a process (from /proc/<pid>/fd and
+// /proc/<pid>/fdinfo).
+type FdInfo struct {
+	Fd     int
+	Target string // link target (a path, or e.g. "socket:[1234]", "anon_inode:[eventfd]")
+	Type   FdType
+	Flags  int    // file status flags (O_*)
+	Pos    int64  // file offset
+	MntId  int    // mount id of the file
+	Ino    uint64 // inode number of the file
+}
+
+// ListFds returns the fds of the process for which the given filter returns
+// true (all of them if the filter is nil), sorted by fd number. Fds closed
+// while they are being listed are skipped. Requires ptrace read access to the
+// process.
+func (fd PidFd) ListFds(filter func(FdInfo) bool) ([]FdInfo, error) {
+	pid, err := fd.Pid()
+	if err != nil {
+		return nil, err
+	}
+
+	fdDir := fmt.Sprintf("/proc/%d/fd", pid)
+
+	entries, err := os.ReadDir(fdDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %s", fdDir, err)
+	}
+
+	infos := []FdInfo{}
+	for _, entry := range entries {
+		n, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		info, err := readFdInfo(pid, n)
+		if err != nil {
+			continue
+		}
+		if filter == nil || filter(info) {
+			infos = append(infos, info)
+		}
+	}
+
+	// the pid may have been reused while reading procfs; it can't be if the
+	// process is still around.
+	if err := fd.SendSignal(0, 0); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Fd < infos[j].Fd })
+
+	return infos, nil
+}
+
+// GetFiles duplicates the given fds of the process into the caller (with
+// pidfd_getfd(); requires ptrace attach access to the process). The files are
+// named after the fds' targets; the caller must close them. On failure, no
+// files are returned.
+func (fd PidFd) GetFiles(infos []FdInfo) ([]*os.File, error) {
+	files := make([]*os.File, 0, len(infos))
+
+	for _, info := range infos {
+		newFd, err := fd.GetFd(info.Fd, 0)
+		if err != nil {
+			for _, f := range files {
+				f.Close()
+			}
+			return nil, fmt.Errorf("failed to get fd %d (%s): %s", info.Fd, info.Target, err)
+		}
+		files = append(files, os.NewFile(uintptr(newFd), info.Target))
+	}
+
+	return files, nil
+}
+
+// OpenRoot opens the root dir of the process (O_PATH), named after its path
+// as seen by the caller.
+func (fd PidFd) OpenRoot() (*os.File, error) {
+	return fd.openProcLink("root")
+}
+
+// OpenCwd opens the current working dir of the process (O_PATH), named after
+// its path as seen by the caller.
+func (fd PidFd) OpenCwd() (*os.File, error) {
+	return fd.openProcLink("cwd")
+}
+
+// openProcLink opens the dir the given /proc/<pid> magic link refers to.
+func (fd PidFd) openProcLink(name string) (*os.File, error) {
+	pid, err := fd.Pid()
+	if err != nil {
+		return nil, err
+	}
+
+	link := fmt.Sprintf("/proc/%d/%s", pid, name)
+
+	dirFd, err := unix.Open(link, unix.O_PATH|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %s", link, err)
+	}
+
+	// the pid may have been reused before the open
+	if err := fd.SendSignal(0, 0); err != nil {
+		unix.Close(dirFd)
+		return nil, err
+	}
+
+	fileName := link
+	if target, err := os.Readlink(link); err == nil {
+		fileName = target
+	}
+
+	return os.NewFile(uintptr(dirFd), fileName), nil
+}
+
+// FdByPath returns a ListFds() filter that selects the fds referring to the
+// given paths.
+func FdByPath(paths ...string) func(FdInfo) bool {
+	return func(info FdInfo) bool {
+		for _, p := range paths {
+			if info.Target == p {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// FdByType returns a ListFds() filter that selects the fds of the given
+// types.
+func FdByType(types ...FdType) func(FdInfo) bool {
+	return func(info FdInfo) bool {
+		for _, t := range types {
+			if info.Type == t {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// readFdInfo returns the info of the given fd of the given process.
+func readFdInfo(pid, n int) (FdInfo, error) {
+	info := FdInfo{Fd: n}
+
+	link := fmt.Sprintf("/proc/%d/fd/%d", pid, n)
+
+	target, err := os.Readlink(link)
+	if err != nil {
+		return info, err
+	}
+	info.Target = target
+	info.Type = fdType(link, target)
+
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/fdinfo/%d", pid, n))
+	if err != nil {
+		return info, err
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		key, val, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		val = strings.TrimSpace(val)
+
+		switch key {
+		case "pos":
+			info.Pos, _ = strconv.ParseInt(val, 10, 64)
+		case "flags":
+			flags, _ := strconv.ParseInt(val, 8, 64)
+			info.Flags = int(flags)
+		case "mnt_id":
+			info.MntId, _ = strconv.Atoi(val)
+		case "ino":
+			info.Ino, _ = strconv.ParseUint(val, 10, 64)
+		}
+	}
+
+	return info, nil
+}
+
+// fdType returns the type of the file the given /proc/<pid>/fd link refers
+// to; the link target is used if the file can't be stat'ed.
+func fdType(link, target string) FdType {
+	var st unix.Stat_t
+
+	if err := unix.Stat(link, &st); err == nil {
+		switch st.Mode & unix.S_IFMT {
+		case unix.S_IFREG:
+			if strings.HasPrefix(target, "anon_inode:") {
+				return FdAnonInode
+			}
+			return FdFile
+		case unix.S_IFDIR:
+			return FdDir
+		case unix.S_IFSOCK:
+			return FdSocket
+		case unix.S_IFIFO:
+			return FdPipe
+		case unix.S_IFCHR, unix.S_IFBLK:
+			return FdDevice
+		}
+	}
+
+	switch {
+	case strings.HasPrefix(target, "anon_inode:"):
+		return FdAnonInode
+	case strings.HasPrefix(target, "socket:"):
+		return FdSocket
+	case strings.HasPrefix(target, "pipe:"):
+		return FdPipe
+	case strings.HasPrefix(target, "/"):
+		return FdFile
+	}
+
+	return FdOther
+}
@@ -0,0 +1,156 @@
+//
+// Copyright 2026 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package pidfd
+
+import (
+	"os"
+	"os/exec"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestListAndGetFds(t *testing.T) {
+	tmp, err := os.CreateTemp("", "pidfd-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+
+	// the child gets the file as fd 3 and the pipe as fd 4
+	cmd := exec.Command("sleep", "100")
+	cmd.ExtraFiles = []*os.File{tmp, w}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}()
+
+	fd, err := Open(cmd.Process.Pid, 0)
+	if err != nil {
+		t.Fatalf("Open() failed: %s", err)
+	}
+	defer fd.Close()
+
+	all, err := fd.ListFds(nil)
+	if err != nil {
+		t.Fatalf("ListFds() failed: %s", err)
+	}
+	if len(all) < 5 || all[3].Target != tmp.Name() || all[3].Type != FdFile || all[4].Type != FdPipe {
+		t.Fatalf("ListFds() failed: want file %s at fd 3 and pipe at fd 4, got %+v", tmp.Name(), all)
+	}
+	if all[3].Flags&unix.O_ACCMODE != unix.O_RDWR {
+		t.Fatalf("ListFds() failed: want O_RDWR for fd 3, got flags %o", all[3].Flags)
+	}
+
+	infos, err := fd.ListFds(FdByPath(tmp.Name()))
+	if err != nil || len(infos) != 1 || infos[0].Fd != 3 {
+		t.Fatalf("ListFds(FdByPath()) failed: want fd 3, got %+v (%v)", infos, err)
+	}
+
+	pipes, err := fd.ListFds(FdByType(FdPipe))
+	if err != nil || len(pipes) != 1 || pipes[0].Fd != 4 {
+		t.Fatalf("ListFds(FdByType()) failed: want fd 4, got %+v (%v)", pipes, err)
+	}
+
+	files, err := fd.GetFiles(append(infos, pipes...))
+	if err != nil {
+		t.Fatalf("GetFiles() failed: %s", err)
+	}
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+
+	if files[0].Name() != tmp.Name() {
+		t.Fatalf("GetFiles() failed: want name %s, got %s", tmp.Name(), files[0].Name())
+	}
+
+	var got, want unix.Stat_t
+	unix.Fstat(int(files[0].Fd()), &got)
+	unix.Fstat(int(tmp.Fd()), &want)
+	if got.Ino != want.Ino || got.Dev != want.Dev {
+		t.Fatalf("GetFiles() failed: got a different file")
+	}
+
+	// writes to the stolen pipe fd show up in our read end
+	if _, err := files[1].Write([]byte("x")); err != nil {
+		t.Fatalf("write to stolen pipe failed: %s", err)
+	}
+	buf := make([]byte, 1)
+	if _, err := r.Read(buf); err != nil || buf[0] != 'x' {
+		t.Fatalf("read from pipe failed: %v", err)
+	}
+
+	if _, err := fd.GetFiles([]FdInfo{{Fd: 1000}}); err == nil {
+		t.Fatalf("GetFiles() failed: want error for bad fd")
+	}
+}
+
+func TestOpenRootAndCwd(t *testing.T) {
+	dir := t.TempDir()
+
+	cmd := exec.Command("sleep", "100")
+	cmd.Dir = dir
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}()
+
+	fd, err := Open(cmd.Process.Pid, 0)
+	if err != nil {
+		t.Fatalf("Open() failed: %s", err)
+	}
+	defer fd.Close()
+
+	for _, tt := range []struct {
+		open func() (*os.File, error)
+		want string
+	}{
+		{fd.OpenRoot, "/"},
+		{fd.OpenCwd, dir},
+	} {
+		f, err := tt.open()
+		if err != nil {
+			t.Fatalf("open failed: %s", err)
+		}
+
+		var got, want unix.Stat_t
+		unix.Fstat(int(f.Fd()), &got)
+		unix.Stat(tt.want, &want)
+		name := f.Name()
+		f.Close()
+
+		if name != tt.want || got.Ino != want.Ino || got.Dev != want.Dev {
+			t.Fatalf("open failed: want %s, got %s", tt.want, name)
+		}
+	}
+}
@@ -3,3 +3,5 @@ module github.com/nestybox/sysbox-libs/pidfd
 go 1.21
 
 toolchain go1.21.0
+
+require golang.org/x/sys v0.13.0
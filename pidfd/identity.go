@@ -0,0 +1,231 @@
+//
+// Copyright 2026 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package pidfd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Clock ticks per second used in /proc/<pid>/stat (USER_HZ, 100 on all Linux
+// archs).
+const userHz = 100
+
+// ProcessIdentity identifies a process in a way that's safe against pid
+// reuse: a pid alone may refer to a different process once the original one
+// is gone, but the pid along with the process' start time may not. If a pidfd
+// is held, it refers to the original process for as long as it's open.
+type ProcessIdentity struct {
+	Pid       int
+	StartTime uint64 // in clock ticks since boot (field 22 of /proc/<pid>/stat)
+	PidFd     PidFd  // -1 if none
+}
+
+// NewProcessIdentity returns the identity of the process that currently has
+// the given pid; if openPidFd is set, a pidfd for the process is opened too
+// (call Close() to release it).
+func NewProcessIdentity(pid int, openPidFd bool) (*ProcessIdentity, error) {
+	id := &ProcessIdentity{Pid: pid, PidFd: -1}
+
+	if openPidFd {
+		fd, err := Open(pid, 0)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open pidfd for pid %d: %s", pid, err)
+		}
+		id.PidFd = fd
+	}
+
+	startTime, err := ProcStartTime(pid)
+	if err != nil {
+		id.Close()
+		return nil, err
+	}
+	id.StartTime = startTime
+
+	// The pid may have been reused between opening the pidfd and reading the
+	// start time; it can't be if the process is still around.
+	if id.PidFd >= 0 {
+		if err := id.PidFd.SendSignal(0, 0); err != nil {
+			id.Close()
+			return nil, fmt.Errorf("pid %d exited: %s", pid, err)
+		}
+	}
+
+	return id, nil
+}
+
+// Alive returns true if the process is still around (i.e., it has not been
+// reaped; zombies are alive). Without a pidfd, that means a process with the
+// same pid and start time exists.
+func (id *ProcessIdentity) Alive() (bool, error) {
+	if id.PidFd >= 0 {
+		err := id.PidFd.SendSignal(0, 0)
+		if err == nil || errors.Is(err, syscall.EPERM) {
+			return true, nil
+		}
+		if errors.Is(err, syscall.ESRCH) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	startTime, err := ProcStartTime(id.Pid)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) || errors.Is(err, syscall.ESRCH) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return startTime == id.StartTime, nil
+}
+
+// Same returns true if both identities refer to the same process.
+func (id *ProcessIdentity) Same(other *ProcessIdentity) bool {
+	return id.Pid == other.Pid && id.StartTime == other.StartTime
+}
+
+// StartedAt returns the (wall clock) time at which the process started; the
+// precision is that of the boot time in /proc/stat (1 second).
+func (id *ProcessIdentity) StartedAt() (time.Time, error) {
+	btime, err := bootTime()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return btime.Add(ticksToDuration(id.StartTime)), nil
+}
+
+// ticksToDuration converts the given clock ticks to a duration (without
+// overflowing for start times of hosts with years of uptime).
+func ticksToDuration(ticks uint64) time.Duration {
+	return time.Duration(ticks/userHz)*time.Second + time.Duration(ticks%userHz)*time.Second/userHz
+}
+
+// Close releases the pidfd (if any).
+func (id *ProcessIdentity) Close() error {
+	if id.PidFd < 0 {
+		return nil
+	}
+	err := id.PidFd.Close()
+	id.PidFd = -1
+	return err
+}
+
+func (id *ProcessIdentity) String() string {
+	return fmt.Sprintf("%d@%d", id.Pid, id.StartTime)
+}
+
+// ProcStartTime returns the start time of the process with the given pid, in
+// clock ticks since boot.
+func ProcStartTime(pid int) (uint64, error) {
+	st, err := ReadProcStat(pid)
+	if err != nil {
+		return 0, err
+	}
+	return st.Uint(22)
+}
+
+// ProcStat holds the contents of /proc/<pid>/stat.
+type ProcStat struct {
+	Pid    int
+	Comm   string   // command name (without the enclosing parenthesis)
+	fields []string // the fields that follow the command (from field 3 on)
+}
+
+// ReadProcStat reads /proc/<pid>/stat for the given pid.
+func ReadProcStat(pid int) (*ProcStat, error) {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return nil, err
+	}
+
+	st, err := parseProcStat(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse /proc/%d/stat: %s", pid, err)
+	}
+	return st, nil
+}
+
+// parseProcStat parses the contents of a /proc/<pid>/stat file.
+func parseProcStat(data string) (*ProcStat, error) {
+
+	// the command may contain spaces and parenthesis, so it ends at the last
+	// closing parenthesis
+	lp := strings.IndexByte(data, '(')
+	rp := strings.LastIndexByte(data, ')')
+	if lp < 0 || rp < lp {
+		return nil, errors.New("command not found")
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(data[:lp]))
+	if err != nil {
+		return nil, fmt.Errorf("invalid pid: %s", err)
+	}
+
+	return &ProcStat{
+		Pid:    pid,
+		Comm:   data[lp+1 : rp],
+		fields: strings.Fields(data[rp+1:]),
+	}, nil
+}
+
+// Field returns the given field, numbered as in proc(5) (i.e., 3 is the state);
+// fails if it's not there (e.g., fields added in later kernel versions).
+func (st *ProcStat) Field(n int) (string, error) {
+	if n < 3 || n-3 >= len(st.fields) {
+		return "", fmt.Errorf("field %d not in /proc/%d/stat", n, st.Pid)
+	}
+	return st.fields[n-3], nil
+}
+
+// Uint returns the given (numeric) field; see Field().
+func (st *ProcStat) Uint(n int) (uint64, error) {
+	f, err := st.Field(n)
+	if err != nil {
+		return 0, err
+	}
+	val, err := strconv.ParseUint(f, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid field %d in /proc/%d/stat: %s", n, st.Pid, err)
+	}
+	return val, nil
+}
+
+// bootTime returns the system boot time (from /proc/stat).
+func bootTime() (time.Time, error) {
+	data, err := os.ReadFile("/proc/stat")
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		if val, found := strings.CutPrefix(line, "btime "); found {
+			secs, err := strconv.ParseInt(strings.TrimSpace(val), 10, 64)
+			if err != nil {
+				return time.Time{}, fmt.Errorf("failed to parse btime in /proc/stat: %s", err)
+			}
+			return time.Unix(secs, 0), nil
+		}
+	}
+
+	return time.Time{}, errors.New("btime not found in /proc/stat")
+}
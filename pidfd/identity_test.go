@@ -0,0 +1,147 @@
+//
+// Copyright 2026 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package pidfd
+
+import (
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestProcessIdentity(t *testing.T) {
+	for _, openPidFd := range []bool{false, true} {
+		cmd := exec.Command("sleep", "100")
+		if err := cmd.Start(); err != nil {
+			t.Fatal(err)
+		}
+		pid := cmd.Process.Pid
+
+		id, err := NewProcessIdentity(pid, openPidFd)
+		if err != nil {
+			t.Fatalf("NewProcessIdentity() failed: %s", err)
+		}
+		if openPidFd == (id.PidFd < 0) {
+			t.Fatalf("NewProcessIdentity() failed: want pidfd = %v, got %d", openPidFd, id.PidFd)
+		}
+
+		if alive, err := id.Alive(); err != nil || !alive {
+			t.Fatalf("Alive() failed: want true, got %v (%v)", alive, err)
+		}
+
+		other, err := NewProcessIdentity(pid, false)
+		if err != nil {
+			t.Fatalf("NewProcessIdentity() failed: %s", err)
+		}
+		if !id.Same(other) {
+			t.Fatalf("Same() failed: %s != %s", id, other)
+		}
+
+		// a different start time means a different process
+		other.StartTime++
+		if alive, _ := other.Alive(); alive || id.Same(other) {
+			t.Fatalf("identity with wrong start time matches the process")
+		}
+
+		startedAt, err := id.StartedAt()
+		if err != nil {
+			t.Fatalf("StartedAt() failed: %s", err)
+		}
+		if d := time.Since(startedAt); d < -2*time.Second || d > 10*time.Second {
+			t.Fatalf("StartedAt() failed: process started %v ago", d)
+		}
+
+		cmd.Process.Kill()
+		cmd.Wait()
+
+		if alive, err := id.Alive(); err != nil || alive {
+			t.Fatalf("Alive() failed: want false, got %v (%v)", alive, err)
+		}
+
+		if err := id.Close(); err != nil {
+			t.Fatalf("Close() failed: %s", err)
+		}
+		if _, err := NewProcessIdentity(pid, openPidFd); err == nil {
+			t.Fatalf("NewProcessIdentity() failed: want error for exited pid")
+		}
+	}
+
+	self, err := NewProcessIdentity(os.Getpid(), false)
+	if err != nil {
+		t.Fatalf("NewProcessIdentity() failed: %s", err)
+	}
+	if alive, err := self.Alive(); err != nil || !alive {
+		t.Fatalf("Alive() failed: want true, got %v (%v)", alive, err)
+	}
+}
+
+func TestTicksToDuration(t *testing.T) {
+	tests := []struct {
+		ticks uint64
+		want  time.Duration
+	}{
+		{0, 0},
+		{150, 1500 * time.Millisecond},
+		// ~3.2 years of uptime; overflows if multiplied by time.Second first
+		{10_000_000_001, 100_000_000*time.Second + 10*time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		if got := ticksToDuration(tt.ticks); got != tt.want {
+			t.Fatalf("ticksToDuration(%d) failed: want %v, got %v", tt.ticks, tt.want, got)
+		}
+	}
+}
+
+func TestParseProcStat(t *testing.T) {
+	// the command may contain spaces and parenthesis
+	data := "1234 (a (b) c) S 1 1234 1234 0 -1 4194560 100 0 0 0 1 2 0 0 20 0 1 0 5678 1000 100\n"
+
+	st, err := parseProcStat(data)
+	if err != nil {
+		t.Fatalf("parseProcStat() failed: %s", err)
+	}
+	if st.Pid != 1234 || st.Comm != "a (b) c" {
+		t.Fatalf("parseProcStat() failed: want pid 1234, comm %q; got %d, %q", "a (b) c", st.Pid, st.Comm)
+	}
+	if state, err := st.Field(3); err != nil || state != "S" {
+		t.Fatalf("Field(3) failed: want S, got %q (%v)", state, err)
+	}
+	if ppid, err := st.Uint(4); err != nil || ppid != 1 {
+		t.Fatalf("Uint(4) failed: want 1, got %d (%v)", ppid, err)
+	}
+	if start, err := st.Uint(22); err != nil || start != 5678 {
+		t.Fatalf("Uint(22) failed: want 5678, got %d (%v)", start, err)
+	}
+
+	// fields the kernel does not provide
+	if _, err := st.Field(52); err == nil {
+		t.Fatalf("Field(52) passed; expected failure")
+	}
+	if _, err := st.Field(2); err == nil {
+		t.Fatalf("Field(2) passed; expected failure")
+	}
+
+	if _, err := parseProcStat("1234 comm S 1"); err == nil {
+		t.Fatalf("parseProcStat() passed on invalid data; expected failure")
+	}
+
+	st, err = ReadProcStat(os.Getpid())
+	if err != nil || st.Pid != os.Getpid() {
+		t.Fatalf("ReadProcStat() failed: %+v (%v)", st, err)
+	}
+}
@@ -0,0 +1,74 @@
+//
+// Copyright 2026 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package pidfd
+
+import (
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// pidfs ioctls (see include/uapi/linux/pidfd.h)
+const pidfsIoctlMagic = 0xFF
+
+// Info requested from (and returned by) GetInfo() (bit-vector)
+const (
+	InfoPid      uint64 = 0x1 // Pid, Tgid and Ppid (always returned)
+	InfoCreds    uint64 = 0x2 // user and group ids (always returned)
+	InfoCgroupId uint64 = 0x4 // CgroupId
+	InfoExit     uint64 = 0x8 // ExitCode (kernel 6.15+; only once the process is reaped)
+)
+
+// Info holds the information about a process returned by GetInfo(). Mask
+// indicates which fields are valid.
+type Info struct {
+	Mask     uint64
+	CgroupId uint64
+	Pid      uint32 // pid, tgid and ppid are as seen from the caller's pid namespace
+	Tgid     uint32
+	Ppid     uint32
+	Ruid     uint32
+	Rgid     uint32
+	Euid     uint32
+	Egid     uint32
+	Suid     uint32
+	Sgid     uint32
+	Fsuid    uint32
+	Fsgid    uint32
+	ExitCode int32 // in wait status format
+}
+
+// Size of struct pidfd_info (PIDFD_INFO_SIZE_VER0), which Info matches
+const pidfdInfoSizeVer0 = 64
+
+// PIDFD_GET_INFO is _IOWR(PIDFS_IOCTL_MAGIC, 11, struct pidfd_info)
+var ioctlGetInfo = uint(3<<30 | pidfdInfoSizeVer0<<16 | pidfsIoctlMagic<<8 | 11)
+
+// GetInfo returns information about the process (kernel 6.13+; fails with
+// ENOTTY on older kernels). The mask selects the info to return, in addition
+// to that which is always returned; fails with ESRCH if the process is gone
+// (unless InfoExit is requested and the exit info is available).
+func (fd PidFd) GetInfo(mask uint64) (*Info, error) {
+	info := &Info{Mask: mask}
+
+	_, _, errno := unix.Syscall(unix.SYS_IOCTL, uintptr(fd), uintptr(ioctlGetInfo), uintptr(unsafe.Pointer(info)))
+	if errno != 0 {
+		return nil, errno
+	}
+
+	return info, nil
+}
@@ -0,0 +1,362 @@
+//
+// Copyright 2026 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package pidfd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	sys_process_madvise  = 440 // kernel 5.10+
+	sys_process_mrelease = 448 // kernel 5.15+
+)
+
+// Limits of a single process_madvise() call: the number of iovecs (UIO_MAXIOV)
+// and the total size (kept well below MAX_RW_COUNT).
+const (
+	madviseMaxIov   = 1024
+	madviseMaxBytes = 1 << 30
+)
+
+// Mapping describes a memory mapping of a process (from /proc/<pid>/smaps).
+// Sizes are in bytes.
+type Mapping struct {
+	Start     uint64
+	End       uint64
+	Perms     string // e.g., "rw-p"
+	Offset    uint64
+	Dev       string
+	Inode     uint64
+	Path      string // "" for anonymous mappings; e.g. "[heap]", "[stack]" for special ones
+	Rss       uint64
+	Pss       uint64
+	Anonymous uint64
+	Swap      uint64
+	VmFlags   []string // two-letter flags (e.g., "rd", "wr", "lo")
+}
+
+// Size returns the size of the mapping.
+func (m Mapping) Size() uint64 {
+	return m.End - m.Start
+}
+
+// Anon returns true if the mapping is anonymous (i.e., not backed by a file).
+func (m Mapping) Anon() bool {
+	return m.Inode == 0 && (m.Path == "" || m.Path == "[heap]" || strings.HasPrefix(m.Path, "[stack") || strings.HasPrefix(m.Path, "[anon:"))
+}
+
+// Advisable returns true if MADV_COLD / MADV_PAGEOUT can be applied to the
+// mapping (i.e., it's not locked, hugetlb or a pfn mapping, nor the vsyscall
+// page).
+func (m Mapping) Advisable() bool {
+	for _, f := range []string{"lo", "ht", "pf"} {
+		if slices.Contains(m.VmFlags, f) {
+			return false
+		}
+	}
+	return m.Path != "[vsyscall]"
+}
+
+// Mappings returns the memory mappings of the process for which the given
+// filter returns true (all of them if the filter is nil). Requires ptrace
+// read access to the process.
+func (fd PidFd) Mappings(filter func(Mapping) bool) ([]Mapping, error) {
+	pid, err := fd.Pid()
+	if err != nil {
+		return nil, err
+	}
+
+	path := fmt.Sprintf("/proc/%d/smaps", pid)
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	mappings, err := parseSmaps(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %s", path, err)
+	}
+
+	// the pid may have been reused while reading procfs; it can't be if the
+	// process is still around.
+	if err := fd.SendSignal(0, 0); err != nil {
+		return nil, err
+	}
+
+	if filter == nil {
+		return mappings, nil
+	}
+
+	selected := []Mapping{}
+	for _, m := range mappings {
+		if filter(m) {
+			selected = append(selected, m)
+		}
+	}
+	return selected, nil
+}
+
+// parseSmaps parses the contents of a /proc/<pid>/smaps file.
+func parseSmaps(f *os.File) ([]Mapping, error) {
+	mappings := []Mapping{}
+	var m *Mapping
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		key, isKey := strings.CutSuffix(fields[0], ":")
+
+		// mapping header: "start-end perms offset dev inode [path]"
+		if !isKey {
+			start, end, found := strings.Cut(fields[0], "-")
+			if !found || len(fields) < 5 {
+				return nil, fmt.Errorf("invalid line %q", line)
+			}
+			mappings = append(mappings, Mapping{})
+			m = &mappings[len(mappings)-1]
+
+			var err error
+			if m.Start, err = strconv.ParseUint(start, 16, 64); err != nil {
+				return nil, fmt.Errorf("invalid line %q", line)
+			}
+			if m.End, err = strconv.ParseUint(end, 16, 64); err != nil {
+				return nil, fmt.Errorf("invalid line %q", line)
+			}
+			m.Perms = fields[1]
+			m.Offset, _ = strconv.ParseUint(fields[2], 16, 64)
+			m.Dev = fields[3]
+			m.Inode, _ = strconv.ParseUint(fields[4], 10, 64)
+
+			m.Path = smapsPath(line)
+			continue
+		}
+
+		if m == nil {
+			return nil, fmt.Errorf("invalid line %q", line)
+		}
+
+		if key == "VmFlags" {
+			m.VmFlags = fields[1:]
+			continue
+		}
+
+		// sizes are in kB
+		if len(fields) < 2 {
+			continue
+		}
+		val, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		val *= 1024
+
+		switch key {
+		case "Rss":
+			m.Rss = val
+		case "Pss":
+			m.Pss = val
+		case "Anonymous":
+			m.Anonymous = val
+		case "Swap":
+			m.Swap = val
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return mappings, nil
+}
+
+// smapsPath returns the path in the given smaps mapping header (the sixth
+// field, which is padded with spaces and may contain spaces itself).
+func smapsPath(line string) string {
+	rest := line
+	for i := 0; i < 5; i++ {
+		rest = strings.TrimLeft(rest, " ")
+		idx := strings.IndexByte(rest, ' ')
+		if idx < 0 {
+			return ""
+		}
+		rest = rest[idx:]
+	}
+	return strings.TrimLeft(rest, " ")
+}
+
+// MadviseSkip describes a range that could not be advised by Madvise().
+type MadviseSkip struct {
+	Start uint64
+	Len   uint64
+	Err   error
+}
+
+// MadviseResult reports the outcome of Madvise(). Sizes are in bytes.
+type MadviseResult struct {
+	Requested uint64        // total size of the given mappings
+	Advised   uint64        // size advised successfully
+	Skipped   []MadviseSkip // ranges that could not be advised (e.g., unmapped meanwhile)
+}
+
+// struct iovec (the addresses belong to the target process, so they are
+// not held in Go pointers)
+type iovec struct {
+	base uint64
+	len  uint64
+}
+
+// Madvise gives the given advice (MADV_COLD, MADV_PAGEOUT or MADV_WILLNEED)
+// for the given mappings of the process with process_madvise() (kernel
+// 5.10+; requires CAP_SYS_NICE and ptrace read access to the process).
+//
+// The mappings are advised in batches. Ranges the kernel refuses (e.g.,
+// because they were unmapped or locked after the mappings were read) are
+// skipped and reported in the result; an error is returned (along with the
+// partial result) if the process is gone or can't be advised at all (e.g.,
+// the kernel doesn't support the advice).
+func (fd PidFd) Madvise(mappings []Mapping, advice int) (*MadviseResult, error) {
+	switch advice {
+	case unix.MADV_COLD, unix.MADV_PAGEOUT, unix.MADV_WILLNEED:
+	default:
+		return nil, fmt.Errorf("unsupported advice %d", advice)
+	}
+
+	// The kernel validates the advice before walking the ranges, so an empty
+	// vector checks if it's supported (EINVAL otherwise); EINVAL for a
+	// particular range later on only means that range can't be advised.
+	for {
+		_, _, errno := syscall.Syscall6(sys_process_madvise, uintptr(fd), 0, 0, uintptr(advice), 0, 0)
+		if errno == syscall.EINTR {
+			continue
+		}
+		if errno != 0 {
+			return nil, fmt.Errorf("process_madvise failed: %s", errno)
+		}
+		break
+	}
+
+	res := &MadviseResult{}
+
+	// split the mappings so that none exceeds the size limit of a batch
+	iovs := []iovec{}
+	for _, m := range mappings {
+		res.Requested += m.Size()
+		for start := m.Start; start < m.End; start += madviseMaxBytes {
+			iovs = append(iovs, iovec{base: start, len: min(m.End-start, madviseMaxBytes)})
+		}
+	}
+
+	for len(iovs) > 0 {
+		n, size := 0, uint64(0)
+		for n < len(iovs) && n < madviseMaxIov && size+iovs[n].len <= madviseMaxBytes {
+			size += iovs[n].len
+			n++
+		}
+
+		advised, _, errno := syscall.Syscall6(sys_process_madvise, uintptr(fd), uintptr(unsafe.Pointer(&iovs[0])),
+			uintptr(n), uintptr(advice), 0, 0)
+
+		if errno != 0 {
+			if errno == syscall.EINTR {
+				continue
+			}
+			if madviseFatal(errno) {
+				return res, fmt.Errorf("process_madvise failed: %s", errno)
+			}
+			// the first range failed; skip it
+			res.Skipped = append(res.Skipped, MadviseSkip{Start: iovs[0].base, Len: iovs[0].len, Err: errno})
+			iovs = iovs[1:]
+			continue
+		}
+
+		if advised == 0 {
+			res.Skipped = append(res.Skipped, MadviseSkip{Start: iovs[0].base, Len: iovs[0].len, Err: syscall.EINVAL})
+			iovs = iovs[1:]
+			continue
+		}
+
+		// the kernel stops at the first range that fails, after advising
+		// the previous ones; the failing range is retried (and skipped) in
+		// the next call.
+		res.Advised += uint64(advised)
+		for rem := uint64(advised); rem > 0 && len(iovs) > 0; {
+			if iovs[0].len > rem {
+				iovs[0].base += rem
+				iovs[0].len -= rem
+				break
+			}
+			rem -= iovs[0].len
+			iovs = iovs[1:]
+		}
+	}
+
+	return res, nil
+}
+
+// madviseFatal returns true if the given process_madvise() error applies to
+// the whole operation rather than to a particular range.
+func madviseFatal(errno syscall.Errno) bool {
+	switch errno {
+	case syscall.ESRCH, syscall.EPERM, syscall.EBADF, syscall.ENOSYS, syscall.EFAULT:
+		return true
+	}
+	return false
+}
+
+// Mrelease releases the memory of the process, which must be exiting (e.g.,
+// it was sent SIGKILL), without waiting for it to be reaped; fails with EINVAL
+// if the process is not exiting (process_mrelease(); kernel 5.15+).
+func (fd PidFd) Mrelease() error {
+	_, _, errno := syscall.Syscall(sys_process_mrelease, uintptr(fd), 0, 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// KillAndRelease kills the process (SIGKILL) and releases its memory right
+// away (see Mrelease()).
+func (fd PidFd) KillAndRelease() error {
+	if err := fd.SendSignal(syscall.SIGKILL, 0); err != nil {
+		return err
+	}
+
+	err := fd.Mrelease()
+
+	// the process is gone already (no memory left to release)
+	if errors.Is(err, syscall.ESRCH) {
+		return nil
+	}
+	return err
+}
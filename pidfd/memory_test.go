@@ -0,0 +1,164 @@
+//
+// Copyright 2026 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package pidfd
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestParseSmaps(t *testing.T) {
+	smaps := `55d1c0a00000-55d1c0a21000 rw-p 00000000 00:00 0                          [heap]
+Size:                132 kB
+Rss:                   8 kB
+Pss:                   8 kB
+Anonymous:             8 kB
+Swap:                  4 kB
+VmFlags: rd wr mr mw me ac
+7f0a1c000000-7f0a1c001000 r--p 00001000 08:01 1234                       /usr/lib/my lib.so
+Rss:                   4 kB
+VmFlags: rd mr mw me lo
+`
+	f, err := os.CreateTemp("", "smaps-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	f.WriteString(smaps)
+	f.Seek(0, 0)
+
+	mappings, err := parseSmaps(f)
+	if err != nil {
+		t.Fatalf("parseSmaps() failed: %s", err)
+	}
+	if len(mappings) != 2 {
+		t.Fatalf("parseSmaps() failed: want 2 mappings, got %+v", mappings)
+	}
+
+	heap := mappings[0]
+	if heap.Start != 0x55d1c0a00000 || heap.Size() != 0x21000 || heap.Path != "[heap]" ||
+		heap.Rss != 8192 || heap.Anonymous != 8192 || heap.Swap != 4096 || !heap.Anon() || !heap.Advisable() {
+		t.Fatalf("parseSmaps() failed: wrong heap mapping %+v", heap)
+	}
+
+	lib := mappings[1]
+	if lib.Path != "/usr/lib/my lib.so" || lib.Inode != 1234 || lib.Offset != 0x1000 || lib.Anon() || lib.Advisable() {
+		t.Fatalf("parseSmaps() failed: wrong lib mapping %+v", lib)
+	}
+}
+
+func TestMadvise(t *testing.T) {
+	const size = 4 << 20
+
+	mem, err := unix.Mmap(-1, 0, size, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_PRIVATE|unix.MAP_ANONYMOUS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unix.Munmap(mem)
+
+	for i := 0; i < size; i += os.Getpagesize() {
+		mem[i] = 1
+	}
+	addr := uint64(uintptr(unsafe.Pointer(&mem[0])))
+
+	fd, err := Open(os.Getpid(), 0)
+	if err != nil {
+		t.Fatalf("Open() failed: %s", err)
+	}
+	defer fd.Close()
+
+	mappings, err := fd.Mappings(func(m Mapping) bool { return m.Start <= addr && addr < m.End })
+	if err != nil || len(mappings) != 1 {
+		t.Fatalf("Mappings() failed: want the test mapping, got %+v (%v)", mappings, err)
+	}
+	m := mappings[0]
+	if !m.Anon() || !m.Advisable() || m.Rss < size {
+		t.Fatalf("Mappings() failed: wrong test mapping %+v", m)
+	}
+
+	// only advise our region (the mapping may have been merged with others)
+	m.Start, m.End = addr, addr+size
+
+	res, err := fd.Madvise([]Mapping{m}, unix.MADV_COLD)
+	if errors.Is(err, unix.ENOSYS) {
+		t.Skip("process_madvise() not supported")
+	}
+	if err != nil {
+		t.Fatalf("Madvise() failed: %s", err)
+	}
+	if res.Requested != size || res.Advised != size || len(res.Skipped) != 0 {
+		t.Fatalf("Madvise() failed: want %d bytes advised, got %+v", size, res)
+	}
+
+	// ranges the kernel refuses (locked ones) are skipped, but the others
+	// are still advised
+	page := os.Getpagesize()
+	if err := unix.Mlock(mem[size-page:]); err != nil {
+		t.Skipf("mlock() failed: %s", err)
+	}
+	defer unix.Munlock(mem[size-page:])
+
+	first := Mapping{Start: addr, End: addr + size/2}
+	locked := Mapping{Start: addr + size - uint64(page), End: addr + size}
+
+	res, err = fd.Madvise([]Mapping{first, locked, first}, unix.MADV_PAGEOUT)
+	if err != nil {
+		t.Fatalf("Madvise() failed: %s", err)
+	}
+	if res.Advised != size || len(res.Skipped) != 1 || res.Skipped[0].Start != locked.Start || res.Skipped[0].Err == nil {
+		t.Fatalf("Madvise() failed: want %d bytes advised and the locked page skipped, got %+v", size, res)
+	}
+
+	if _, err := fd.Madvise([]Mapping{m}, unix.MADV_DONTNEED); err == nil {
+		t.Fatalf("Madvise() failed: want error for unsupported advice")
+	}
+
+	// a locked first range is skipped too
+	res, err = fd.Madvise([]Mapping{locked, first}, unix.MADV_PAGEOUT)
+	if err != nil {
+		t.Fatalf("Madvise() failed: %s", err)
+	}
+	if res.Advised != size/2 || len(res.Skipped) != 1 || res.Skipped[0].Start != locked.Start {
+		t.Fatalf("Madvise() failed: want %d bytes advised and the locked page skipped, got %+v", size/2, res)
+	}
+}
+
+func TestMrelease(t *testing.T) {
+	cmd, fd := startProcess(t, "sleep", "100")
+	defer fd.Close()
+	defer cmd.Wait()
+
+	if err := fd.Mrelease(); err == nil {
+		cmd.Process.Kill()
+		t.Fatalf("Mrelease() failed: want error for a live process")
+	} else if errors.Is(err, unix.ENOSYS) {
+		cmd.Process.Kill()
+		t.Skip("process_mrelease() not supported")
+	}
+
+	if err := fd.KillAndRelease(); err != nil {
+		t.Fatalf("KillAndRelease() failed: %s", err)
+	}
+	if err := fd.Wait(5e9); err != nil {
+		t.Fatalf("Wait() failed: %s", err)
+	}
+}
@@ -0,0 +1,136 @@
+//
+// Copyright 2026 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package pidfd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// Namespace types, for OpenNamespace()
+type Namespace int
+
+const (
+	NsCgroup Namespace = iota + 1
+	NsIpc
+	NsMnt
+	NsNet
+	NsPid
+	NsPidForChildren
+	NsTime
+	NsTimeForChildren
+	NsUser
+	NsUts
+)
+
+// name of each namespace under /proc/<pid>/ns
+var nsNames = map[Namespace]string{
+	NsCgroup:          "cgroup",
+	NsIpc:             "ipc",
+	NsMnt:             "mnt",
+	NsNet:             "net",
+	NsPid:             "pid",
+	NsPidForChildren:  "pid_for_children",
+	NsTime:            "time",
+	NsTimeForChildren: "time_for_children",
+	NsUser:            "user",
+	NsUts:             "uts",
+}
+
+func (ns Namespace) String() string {
+	if name, found := nsNames[ns]; found {
+		return name
+	}
+	return fmt.Sprintf("Namespace(%d)", int(ns))
+}
+
+// OpenNamespace returns an fd for the given namespace of the process (the
+// caller must close it). It uses the pidfd nsfs ioctls (kernel 6.11+), and
+// falls back to /proc/<pid>/ns on older kernels.
+func (fd PidFd) OpenNamespace(ns Namespace) (int, error) {
+	name, found := nsNames[ns]
+	if !found {
+		return -1, fmt.Errorf("unknown namespace %d", int(ns))
+	}
+
+	// PIDFD_GET_<NS>_NAMESPACE is _IO(PIDFS_IOCTL_MAGIC, ns)
+	nsFd, err := unix.IoctlRetInt(int(fd), uint(pidfsIoctlMagic<<8|int(ns)))
+	if err == nil {
+		return nsFd, nil
+	}
+	if !errors.Is(err, unix.ENOTTY) && !errors.Is(err, unix.EINVAL) {
+		return -1, err
+	}
+
+	pid, err := fd.Pid()
+	if err != nil {
+		return -1, err
+	}
+
+	nsFd, err = unix.Open(fmt.Sprintf("/proc/%d/ns/%s", pid, name), unix.O_RDONLY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return -1, err
+	}
+
+	// the pid may have been reused before the open; it can't be if the
+	// process is still around.
+	if err := fd.SendSignal(0, 0); err != nil {
+		unix.Close(nsFd)
+		return -1, err
+	}
+
+	return nsFd, nil
+}
+
+// Setns moves the calling thread into the namespaces of the process given by
+// nstype (a mask of CLONE_NEW* flags; see setns(2)). Since it affects the
+// calling thread only, the caller should lock it with runtime.LockOSThread().
+func (fd PidFd) Setns(nstype int) error {
+	return unix.Setns(int(fd), nstype)
+}
+
+// Pid returns the pid of the process in the caller's pid namespace (from
+// /proc/self/fdinfo); returns ESRCH if the process is gone.
+func (fd PidFd) Pid() (int, error) {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/self/fdinfo/%d", int(fd)))
+	if err != nil {
+		return 0, err
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		if val, found := strings.CutPrefix(line, "Pid:"); found {
+			pid, err := strconv.Atoi(strings.TrimSpace(val))
+			if err != nil {
+				return 0, fmt.Errorf("failed to parse fdinfo of pidfd %d: %s", int(fd), err)
+			}
+			switch pid {
+			case -1:
+				return 0, unix.ESRCH
+			case 0:
+				return 0, fmt.Errorf("pid of pidfd %d is not visible in the caller's pid namespace", int(fd))
+			}
+			return pid, nil
+		}
+	}
+
+	return 0, fmt.Errorf("fd %d is not a pidfd", int(fd))
+}
@@ -14,17 +14,36 @@
 // limitations under the License.
 //
 
-// Package pidfd provides pidfd_open, pidfd_getfd, pidfd_send_signal support on linux 5.6+.
+// Package pidfd provides pidfd-based process management on linux 5.1+:
+// opening pidfds and signaling through them, waiting for and reaping
+// processes (waitid), process info (PIDFD_GET_INFO), namespace access and
+// setns, process creation with clone3 (returning a pidfd), duplicating a
+// process' fds (pidfd_getfd), memory advice and release (process_madvise,
+// process_mrelease), and pid reuse-safe process identities.
 //
-// pidfd_send_signal() --> kernel 5.1+
-// pidfd_open()        --> kernel 5.3+
-// pidfd_getfd()       --> kernel 5.6+
-//
-// Sysbox is currently only using pidfd_open().
-
+//	pidfd_send_signal() --> kernel 5.1+
+//	pidfd_open()        --> kernel 5.3+
+//	clone3(CLONE_PIDFD) --> kernel 5.3+ (CLONE_INTO_CGROUP on 5.7+)
+//	waitid(P_PIDFD)     --> kernel 5.4+
+//	pidfd_getfd()       --> kernel 5.6+
+//	setns(pidfd)        --> kernel 5.8+
+//	process_madvise()   --> kernel 5.10+
+//	process_mrelease()  --> kernel 5.15+
+//	nsfs ioctls         --> kernel 6.11+ (falls back to /proc/<pid>/ns)
+//	PIDFD_GET_INFO      --> kernel 6.13+ (exit info on 6.15+)
 package pidfd
 
-import "syscall"
+import (
+	"encoding/binary"
+	"errors"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
 
 const (
 	sys_pidfd_send_signal = 424
@@ -32,6 +51,9 @@ const (
 	sys_pidfd_getfd       = 438
 )
 
+// Returned by Wait() when the process does not exit within the timeout
+var ErrTimeout = errors.New("timed out waiting for process exit")
+
 // PidFd, a file descriptor that refers to a process.
 type PidFd int
 
@@ -72,3 +94,144 @@ func (fd PidFd) SendSignal(signal syscall.Signal, flags uint) error {
 
 	return nil
 }
+
+// Close closes the pidfd.
+func (fd PidFd) Close() error {
+	return syscall.Close(int(fd))
+}
+
+// Wait waits for the process to exit (the pidfd becomes readable when it
+// does); a negative timeout means no timeout. Returns ErrTimeout if the
+// process does not exit within the timeout. The process is not reaped (see
+// Waitid()).
+func (fd PidFd) Wait(timeout time.Duration) error {
+	var deadline time.Time
+	if timeout >= 0 {
+		deadline = time.Now().Add(timeout)
+	}
+
+	fds := []unix.PollFd{{Fd: int32(fd), Events: unix.POLLIN}}
+
+	for {
+		ms := -1
+		if timeout >= 0 {
+			// round up so that we don't spin when less than 1ms is left
+			left := time.Until(deadline)
+			if left < 0 {
+				left = 0
+			}
+			ms = int((left + time.Millisecond - 1) / time.Millisecond)
+		}
+
+		n, err := unix.Poll(fds, ms)
+		if err != nil {
+			if errors.Is(err, unix.EINTR) {
+				continue
+			}
+			return err
+		}
+		if n == 0 {
+			return ErrTimeout
+		}
+		if fds[0].Revents&(unix.POLLNVAL|unix.POLLERR) != 0 {
+			return syscall.EBADF
+		}
+		return nil
+	}
+}
+
+// Waitid waits for a state change of the process, which must be a child of
+// the caller (see waitid(2) with P_PIDFD). The options are those of waitid(2)
+// (e.g., WEXITED, WNOHANG, WNOWAIT); the status of the process is returned in
+// ws in the format used by wait4(2), and its resource usage in rusage (if not
+// nil). Returns the pid of the process, or 0 if WNOHANG is set and the process
+// has not changed state.
+func (fd PidFd) Waitid(ws *syscall.WaitStatus, options int, rusage *syscall.Rusage) (int, error) {
+	return waitid(unix.P_PIDFD, int(fd), ws, options, rusage)
+}
+
+// Waitid is like PidFd.Waitid, but for the process with the given pid (see
+// waitid(2) with P_PID); it works on kernels without pidfd support.
+func Waitid(pid int, ws *syscall.WaitStatus, options int, rusage *syscall.Rusage) (int, error) {
+	return waitid(unix.P_PID, pid, ws, options, rusage)
+}
+
+func waitid(idType int, id int, ws *syscall.WaitStatus, options int, rusage *syscall.Rusage) (int, error) {
+	var si unix.Siginfo
+
+	if err := unix.Waitid(idType, id, &si, options, (*unix.Rusage)(unsafe.Pointer(rusage))); err != nil {
+		return 0, err
+	}
+
+	chld := parseSiginfoChld(&si)
+	if ws != nil {
+		*ws = chld.waitStatus()
+	}
+
+	return int(chld.Pid), nil
+}
+
+// si_code values for SIGCHLD
+const (
+	cldExited    = 1
+	cldKilled    = 2
+	cldDumped    = 3
+	cldTrapped   = 4
+	cldStopped   = 5
+	cldContinued = 6
+)
+
+// Offsets of the siginfo_t fields for SIGCHLD (see <asm-generic/siginfo.h>).
+// si_signo, si_errno and si_code (si_code and si_errno are swapped on mips)
+// are followed by the union of the per-signal fields, which is aligned to the
+// pointer size; for SIGCHLD the union starts with si_pid, si_uid and
+// si_status.
+var (
+	siCodeOff   = siginfoCodeOff()
+	siFieldsOff = (12 + int(unsafe.Sizeof(uintptr(0))) - 1) &^ (int(unsafe.Sizeof(uintptr(0))) - 1)
+)
+
+func siginfoCodeOff() int {
+	if strings.HasPrefix(runtime.GOARCH, "mips") {
+		return 4
+	}
+	return 8
+}
+
+// siginfoChld holds the siginfo_t fields for SIGCHLD.
+type siginfoChld struct {
+	Code   int32
+	Pid    int32
+	Status int32
+}
+
+// parseSiginfoChld extracts the SIGCHLD fields from the given siginfo.
+func parseSiginfoChld(si *unix.Siginfo) siginfoChld {
+	b := (*[unsafe.Sizeof(unix.Siginfo{})]byte)(unsafe.Pointer(si))
+
+	return siginfoChld{
+		Code:   int32(binary.NativeEndian.Uint32(b[siCodeOff:])),
+		Pid:    int32(binary.NativeEndian.Uint32(b[siFieldsOff:])),
+		Status: int32(binary.NativeEndian.Uint32(b[siFieldsOff+8:])),
+	}
+}
+
+// waitStatus converts the siginfo into the wait4() status format.
+func (si *siginfoChld) waitStatus() syscall.WaitStatus {
+	status := uint32(si.Status)
+
+	switch si.Code {
+	case cldExited:
+		return syscall.WaitStatus((status & 0xff) << 8)
+	case cldKilled:
+		return syscall.WaitStatus(status & 0x7f)
+	case cldDumped:
+		return syscall.WaitStatus(status&0x7f | 0x80)
+	case cldStopped, cldTrapped:
+		return syscall.WaitStatus((status&0xff)<<8 | 0x7f)
+	case cldContinued:
+		return syscall.WaitStatus(0xffff)
+	}
+
+	return 0
+}
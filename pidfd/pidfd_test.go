@@ -0,0 +1,226 @@
+//
+// Copyright 2026 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package pidfd
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"runtime"
+	"syscall"
+	"testing"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// startProcess starts the given command and opens a pidfd for it.
+func startProcess(t *testing.T, name string, args ...string) (*exec.Cmd, PidFd) {
+	cmd := exec.Command(name, args...)
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	fd, err := Open(cmd.Process.Pid, 0)
+	if err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		t.Fatalf("Open() failed: %s", err)
+	}
+	return cmd, fd
+}
+
+func TestWait(t *testing.T) {
+	cmd, fd := startProcess(t, "sleep", "100")
+	defer fd.Close()
+
+	if err := fd.Wait(50 * time.Millisecond); err != ErrTimeout {
+		t.Fatalf("Wait() failed: want %v, got %v", ErrTimeout, err)
+	}
+
+	cmd.Process.Kill()
+
+	if err := fd.Wait(5 * time.Second); err != nil {
+		t.Fatalf("Wait() failed: %s", err)
+	}
+
+	// the process is a zombie until reaped
+	var ws syscall.WaitStatus
+	var ru syscall.Rusage
+
+	pid, err := fd.Waitid(&ws, unix.WEXITED|unix.WNOWAIT, &ru)
+	if err != nil || pid != cmd.Process.Pid {
+		t.Fatalf("Waitid() failed: want pid %d, got %d (%v)", cmd.Process.Pid, pid, err)
+	}
+	if !ws.Signaled() || ws.Signal() != syscall.SIGKILL {
+		t.Fatalf("Waitid() failed: want SIGKILL status, got %#x", ws)
+	}
+
+	pid, err = fd.Waitid(&ws, unix.WEXITED, nil)
+	if err != nil || pid != cmd.Process.Pid {
+		t.Fatalf("Waitid() failed: want pid %d, got %d (%v)", cmd.Process.Pid, pid, err)
+	}
+
+	// reaped already
+	if _, err := fd.Waitid(&ws, unix.WEXITED|unix.WNOHANG, nil); !errors.Is(err, unix.ECHILD) {
+		t.Fatalf("Waitid() failed: want ECHILD, got %v", err)
+	}
+}
+
+func TestWaitidStatus(t *testing.T) {
+	cmd, fd := startProcess(t, "sh", "-c", "exit 7")
+	defer fd.Close()
+
+	var ws syscall.WaitStatus
+
+	pid, err := fd.Waitid(&ws, unix.WEXITED, nil)
+	if err != nil || pid != cmd.Process.Pid {
+		t.Fatalf("Waitid() failed: want pid %d, got %d (%v)", cmd.Process.Pid, pid, err)
+	}
+	if !ws.Exited() || ws.ExitStatus() != 7 {
+		t.Fatalf("Waitid() failed: want exit status 7, got %#x", ws)
+	}
+}
+
+func TestWaitidPid(t *testing.T) {
+	cmd, fd := startProcess(t, "sh", "-c", "exit 7")
+	defer fd.Close()
+
+	var ws syscall.WaitStatus
+
+	if err := fd.Wait(5 * time.Second); err != nil {
+		t.Fatalf("Wait() failed: %s", err)
+	}
+
+	pid, err := Waitid(cmd.Process.Pid, &ws, unix.WEXITED|unix.WNOWAIT, nil)
+	if err != nil || pid != cmd.Process.Pid {
+		t.Fatalf("Waitid() failed: want pid %d, got %d (%v)", cmd.Process.Pid, pid, err)
+	}
+	if !ws.Exited() || ws.ExitStatus() != 7 {
+		t.Fatalf("Waitid() failed: want exit status 7, got %#x", ws)
+	}
+
+	if _, err := Waitid(cmd.Process.Pid, &ws, unix.WEXITED, nil); err != nil {
+		t.Fatalf("Waitid() failed: %s", err)
+	}
+}
+
+func TestGetInfo(t *testing.T) {
+	if size := unsafe.Sizeof(Info{}); size != pidfdInfoSizeVer0 {
+		t.Fatalf("Info size mismatch: want %d, got %d", pidfdInfoSizeVer0, size)
+	}
+
+	cmd, fd := startProcess(t, "sleep", "100")
+	defer fd.Close()
+
+	info, err := fd.GetInfo(InfoPid | InfoCreds | InfoCgroupId)
+	if errors.Is(err, unix.ENOTTY) {
+		cmd.Process.Kill()
+		cmd.Wait()
+		t.Skip("PIDFD_GET_INFO not supported")
+	}
+	if err != nil {
+		t.Fatalf("GetInfo() failed: %s", err)
+	}
+
+	if int(info.Pid) != cmd.Process.Pid || info.Tgid != info.Pid || int(info.Ppid) != os.Getpid() {
+		t.Fatalf("GetInfo() failed: want pid %d & ppid %d, got %+v", cmd.Process.Pid, os.Getpid(), info)
+	}
+	if int(info.Euid) != os.Geteuid() || int(info.Egid) != os.Getegid() {
+		t.Fatalf("GetInfo() failed: want euid %d & egid %d, got %+v", os.Geteuid(), os.Getegid(), info)
+	}
+
+	cmd.Process.Kill()
+	cmd.Wait()
+
+	info, err = fd.GetInfo(InfoExit)
+	if err != nil {
+		t.Fatalf("GetInfo() failed: %s", err)
+	}
+	if info.Mask&InfoExit != 0 {
+		ws := syscall.WaitStatus(info.ExitCode)
+		if !ws.Signaled() || ws.Signal() != syscall.SIGKILL {
+			t.Fatalf("GetInfo() failed: want SIGKILL exit code, got %#x", info.ExitCode)
+		}
+	}
+}
+
+func TestOpenNamespace(t *testing.T) {
+	fd, err := Open(os.Getpid(), 0)
+	if err != nil {
+		t.Fatalf("Open() failed: %s", err)
+	}
+	defer fd.Close()
+
+	if pid, err := fd.Pid(); err != nil || pid != os.Getpid() {
+		t.Fatalf("Pid() failed: want %d, got %d (%v)", os.Getpid(), pid, err)
+	}
+
+	for _, ns := range []Namespace{NsNet, NsMnt, NsUts, NsUser} {
+		nsFd, err := fd.OpenNamespace(ns)
+		if err != nil {
+			t.Fatalf("OpenNamespace(%s) failed: %s", ns, err)
+		}
+
+		var got, want unix.Stat_t
+		unix.Fstat(nsFd, &got)
+		unix.Close(nsFd)
+
+		if err := unix.Stat("/proc/self/ns/"+ns.String(), &want); err != nil {
+			t.Fatal(err)
+		}
+		if got.Ino != want.Ino || got.Dev != want.Dev {
+			t.Fatalf("OpenNamespace(%s) failed: wrong namespace", ns)
+		}
+	}
+
+	if _, err := fd.OpenNamespace(Namespace(100)); err == nil {
+		t.Fatalf("OpenNamespace() failed: want error for unknown namespace")
+	}
+}
+
+func TestSetns(t *testing.T) {
+	fd, err := Open(os.Getpid(), 0)
+	if err != nil {
+		t.Fatalf("Open() failed: %s", err)
+	}
+	defer fd.Close()
+
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	// joining our own namespaces is a no-op, but requires CAP_SYS_ADMIN
+	if err := fd.Setns(unix.CLONE_NEWUTS | unix.CLONE_NEWNET); err != nil {
+		if errors.Is(err, unix.EPERM) {
+			t.Skip("setns() not permitted")
+		}
+		t.Fatalf("Setns() failed: %s", err)
+	}
+}
+
+func TestClose(t *testing.T) {
+	fd, err := Open(os.Getpid(), 0)
+	if err != nil {
+		t.Fatalf("Open() failed: %s", err)
+	}
+	if err := fd.Close(); err != nil {
+		t.Fatalf("Close() failed: %s", err)
+	}
+	if err := fd.SendSignal(0, 0); !errors.Is(err, unix.EBADF) {
+		t.Fatalf("Close() failed: pidfd still usable (%v)", err)
+	}
+}
@@ -0,0 +1,400 @@
+//
+// Copyright 2026 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package pidmonitor
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// The cgroup monitor reports when a cgroup v2 becomes empty (i.e., all the
+// processes in it and in its descendant cgroups are gone), or when it's
+// removed. This complements the pid monitor for containers, whose init process
+// may exit while other processes in the container remain.
+//
+// The "populated" key of the cgroup's cgroup.events file is watched with
+// inotify (the kernel generates a modify event when it changes); cgroups that
+// can't be watched are polled.
+
+// Cgroup event types (bit-vector)
+const (
+	CgroupEmpty   int = 0x1 // Cgroup has no processes left (in it or its descendants)
+	CgroupRemoved int = 0x2 // Cgroup was removed
+)
+
+// Represents an event on the given cgroup
+type CgroupEvent struct {
+	Path  string // cgroup dir (as passed to Add())
+	Event int
+	Err   error // set when an error is detected
+}
+
+// Represents a cgroup monitor instance
+type CgroupMon struct {
+	mu        sync.Mutex
+	cfg       *Cfg
+	cgroups   map[string]*cgroupInfo // monitored cgroups (by path)
+	wdPaths   map[int32]string       // maps each inotify watch to its cgroup
+	pending   map[string]bool        // cgroups to check on the next iteration of the monitor thread
+	inotifyFd int                    // -1 if inotify can't be used (all cgroups are polled)
+	wakeFd    int                    // eventfd used to wake up the monitor thread
+	eventCh   chan []CgroupEvent
+	stopCh    chan struct{}
+	wg        sync.WaitGroup
+	closed    bool
+	closeOnce sync.Once
+}
+
+type cgroupInfo struct {
+	wd     int32 // inotify watch on cgroup.events (-1 if polled)
+	polled bool
+}
+
+// set by tests to force polling
+var disableCgroupInotify = false
+
+// Creates a cgroup monitor instance.
+func NewCgroupMon(cfg *Cfg) (*CgroupMon, error) {
+
+	if err := validateCfg(cfg); err != nil {
+		return nil, err
+	}
+
+	wakeFd, err := unix.Eventfd(0, unix.EFD_CLOEXEC|unix.EFD_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create eventfd: %s", err)
+	}
+
+	cm := &CgroupMon{
+		cfg:       cfg,
+		cgroups:   make(map[string]*cgroupInfo),
+		wdPaths:   make(map[int32]string),
+		pending:   make(map[string]bool),
+		inotifyFd: -1,
+		wakeFd:    wakeFd,
+		eventCh:   make(chan []CgroupEvent, 100),
+		stopCh:    make(chan struct{}),
+	}
+
+	if !disableCgroupInotify {
+		if fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK); err == nil {
+			cm.inotifyFd = fd
+		}
+	}
+
+	cm.wg.Add(1)
+	go func() {
+		defer cm.wg.Done()
+		cgroupMonitor(cm)
+	}()
+
+	return cm, nil
+}
+
+// Adds the given cgroup v2 dir to the monitored cgroups. A CgroupEmpty event
+// is reported once it has no processes (right away if it has none already, so
+// add it once the processes are in it), and CgroupRemoved if it's removed
+// before that. Either way, the cgroup is no longer monitored after the event.
+func (cm *CgroupMon) Add(path string) error {
+	path = filepath.Clean(path)
+	eventsFile := filepath.Join(path, "cgroup.events")
+
+	if _, err := os.Stat(eventsFile); err != nil {
+		return fmt.Errorf("%s is not a cgroup v2 dir: %s", path, err)
+	}
+
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	if cm.closed {
+		return ErrClosed
+	}
+	if _, found := cm.cgroups[path]; found {
+		return nil
+	}
+
+	ci := &cgroupInfo{wd: -1, polled: true}
+	if cm.inotifyFd >= 0 {
+		wd, err := unix.InotifyAddWatch(cm.inotifyFd, eventsFile, unix.IN_MODIFY)
+		if err == nil {
+			ci.wd = int32(wd)
+			ci.polled = false
+			cm.wdPaths[ci.wd] = path
+		}
+	}
+	cm.cgroups[path] = ci
+
+	// the cgroup may be empty already; check it once watched
+	cm.pending[path] = true
+	cm.wake()
+
+	return nil
+}
+
+// Removes the given cgroup from the monitored cgroups.
+func (cm *CgroupMon) Remove(path string) {
+	cm.mu.Lock()
+	cm.remove(filepath.Clean(path))
+	cm.mu.Unlock()
+}
+
+// remove stops monitoring the given cgroup; must be called with cm.mu held.
+func (cm *CgroupMon) remove(path string) {
+	ci, found := cm.cgroups[path]
+	if !found {
+		return
+	}
+	if ci.wd >= 0 {
+		// fails harmlessly if the watch is gone already (i.e., cgroup removed)
+		unix.InotifyRmWatch(cm.inotifyFd, uint32(ci.wd))
+		delete(cm.wdPaths, ci.wd)
+	}
+	delete(cm.cgroups, path)
+	delete(cm.pending, path)
+}
+
+// wake wakes up the monitor thread; must be called with cm.mu held.
+func (cm *CgroupMon) wake() {
+	one := []byte{1, 0, 0, 0, 0, 0, 0, 0}
+	unix.Write(cm.wakeFd, one)
+}
+
+// Events returns the channel on which cgroup events are delivered (in
+// batches); it's closed when the cgroup monitor is closed.
+func (cm *CgroupMon) Events() <-chan []CgroupEvent {
+	return cm.eventCh
+}
+
+// Blocks the calling process until the given cgroup monitor detects an event
+// in one or more of the cgroups it's monitoring, or until the given context is
+// done. Returns ErrClosed if the cgroup monitor is closed, or the context's
+// error.
+func (cm *CgroupMon) WaitEvent(ctx context.Context) ([]CgroupEvent, error) {
+	select {
+	case eventList, ok := <-cm.eventCh:
+		if !ok {
+			return nil, ErrClosed
+		}
+		return eventList, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Stops the given cgroup monitor and waits for its thread to exit; it's safe
+// to call it multiple times.
+func (cm *CgroupMon) Close() {
+	cm.closeOnce.Do(func() {
+		cm.mu.Lock()
+		cm.closed = true
+		close(cm.stopCh)
+		cm.wake()
+		cm.mu.Unlock()
+
+		cm.wg.Wait()
+
+		cm.mu.Lock()
+		for path := range cm.cgroups {
+			cm.remove(path)
+		}
+		if cm.inotifyFd >= 0 {
+			unix.Close(cm.inotifyFd)
+			cm.inotifyFd = -1
+		}
+		unix.Close(cm.wakeFd)
+		cm.wakeFd = -1
+		cm.mu.Unlock()
+
+		close(cm.eventCh)
+	})
+}
+
+// hasPolledCgroups returns true if any of the monitored cgroups is polled;
+// must be called with cm.mu held.
+func (cm *CgroupMon) hasPolledCgroups() bool {
+	for _, ci := range cm.cgroups {
+		if ci.polled {
+			return true
+		}
+	}
+	return false
+}
+
+// Monitors the cgroups associated with the given CgroupMon instance
+func cgroupMonitor(cm *CgroupMon) {
+	cm.mu.Lock()
+	fds := []unix.PollFd{
+		{Fd: int32(cm.inotifyFd), Events: unix.POLLIN}, // ignored by poll() if -1
+		{Fd: int32(cm.wakeFd), Events: unix.POLLIN},
+	}
+	cm.mu.Unlock()
+
+	lastPoll := time.Now()
+	pollPeriod := cm.cfg.Poll * time.Millisecond
+
+	for {
+		cm.mu.Lock()
+
+		// checked under the lock (see Close()) so that the stop wake up is
+		// not lost if it's consumed while handling a previous one
+		if cm.closed {
+			cm.mu.Unlock()
+			return
+		}
+
+		timeout := -1
+		if cm.hasPolledCgroups() {
+			timeout = int((pollPeriod - time.Since(lastPoll)).Milliseconds())
+			if timeout < 0 {
+				timeout = 0
+			}
+		}
+		cm.mu.Unlock()
+
+		unix.Poll(fds, timeout)
+
+		select {
+		case <-cm.stopCh:
+			return
+		default:
+		}
+
+		if fds[1].Revents&unix.POLLIN != 0 {
+			buf := make([]byte, 8)
+			unix.Read(int(fds[1].Fd), buf)
+		}
+
+		wds := map[int32]bool{}
+		overflow := false
+		if fds[0].Revents&unix.POLLIN != 0 {
+			wds, overflow = readCgroupInotify(int(fds[0].Fd))
+		}
+
+		cm.mu.Lock()
+
+		toCheck := cm.pending
+		cm.pending = make(map[string]bool)
+
+		for wd := range wds {
+			if path, found := cm.wdPaths[wd]; found {
+				toCheck[path] = true
+			}
+		}
+
+		poll := time.Since(lastPoll) >= pollPeriod
+		for path, ci := range cm.cgroups {
+			if overflow || (poll && ci.polled) {
+				toCheck[path] = true
+			}
+		}
+		if poll {
+			lastPoll = time.Now()
+		}
+
+		eventList := []CgroupEvent{}
+		for path := range toCheck {
+			if _, found := cm.cgroups[path]; !found {
+				continue
+			}
+			if e := checkCgroup(path); e != nil {
+				eventList = append(eventList, *e)
+				cm.remove(path)
+			}
+		}
+
+		cm.mu.Unlock()
+
+		if len(eventList) > 0 {
+			select {
+			case cm.eventCh <- eventList:
+			case <-cm.stopCh:
+			}
+		}
+	}
+}
+
+// readCgroupInotify reads the pending inotify events; returns the watches
+// that hit, and whether events were lost.
+func readCgroupInotify(fd int) (map[int32]bool, bool) {
+	buf := make([]byte, 4096)
+	wds := map[int32]bool{}
+	overflow := false
+
+	for {
+		n, err := unix.Read(fd, buf)
+		if err != nil || n <= 0 {
+			break
+		}
+		for off := 0; off+unix.SizeofInotifyEvent <= n; {
+			ev := (*unix.InotifyEvent)(unsafe.Pointer(&buf[off]))
+			if ev.Mask&unix.IN_Q_OVERFLOW != 0 {
+				overflow = true
+			} else {
+				// includes IN_IGNORED, generated when the cgroup is removed
+				wds[ev.Wd] = true
+			}
+			off += unix.SizeofInotifyEvent + int(ev.Len)
+		}
+	}
+
+	return wds, overflow
+}
+
+// checkCgroup returns the event for the given cgroup if it's empty or was
+// removed; returns nil otherwise.
+func checkCgroup(path string) *CgroupEvent {
+	populated, err := cgroupPopulated(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) || errors.Is(err, unix.ENODEV) {
+			return &CgroupEvent{Path: path, Event: CgroupRemoved}
+		}
+		return &CgroupEvent{Path: path, Event: CgroupEmpty, Err: err}
+	}
+	if !populated {
+		return &CgroupEvent{Path: path, Event: CgroupEmpty}
+	}
+	return nil
+}
+
+// cgroupPopulated returns the value of the "populated" key in the cgroup.events
+// file of the given cgroup.
+func cgroupPopulated(path string) (bool, error) {
+	data, err := os.ReadFile(filepath.Join(path, "cgroup.events"))
+	if err != nil {
+		return false, err
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		var val int
+		if n, _ := fmt.Sscanf(scanner.Text(), "populated %d", &val); n == 1 {
+			return val != 0, nil
+		}
+	}
+
+	return false, fmt.Errorf("populated key not found in %s/cgroup.events", path)
+}
@@ -0,0 +1,497 @@
+//
+// Copyright 2026 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package pidmonitor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"syscall"
+
+	"github.com/nestybox/sysbox-libs/pidfd"
+	"golang.org/x/sys/unix"
+)
+
+// The process lifecycle events (Fork, Exec, Uid, Gid, Comm, and the Exit of
+// descendants) come from the kernel's netlink proc connector, which reports
+// these events for all processes in the system; requires CAP_NET_ADMIN (and,
+// on older kernels, the initial network namespace).
+
+// proc connector ids and ops (see linux/connector.h and linux/cn_proc.h)
+const (
+	cnIdxProc = 1
+	cnValProc = 1
+
+	procCnMcastListen = 1
+	procCnMcastIgnore = 2
+
+	procEventFork = 0x00000001
+	procEventExec = 0x00000002
+	procEventUid  = 0x00000004
+	procEventGid  = 0x00000040
+	procEventComm = 0x00000200
+	procEventExit = 0x80000000
+)
+
+const (
+	cnMsgLen        = 20 // struct cn_msg (without data)
+	procEventHdrLen = 16 // struct proc_event, up to event_data
+	commLen         = 16 // TASK_COMM_LEN
+	connRcvBufSize  = 1 << 20
+)
+
+// A proc connector event (fields are set according to the event type).
+type procEvent struct {
+	what       uint32
+	pid        uint32 // thread (task) that caused the event
+	tgid       uint32 // process of that thread
+	parentPid  uint32 // fork: parent; exit: parent
+	parentTgid uint32
+	exitCode   uint32 // in wait status format
+	ruid       uint32 // real uid / gid (uid and gid events)
+	euid       uint32 // effective uid / gid (uid and gid events)
+	comm       string
+}
+
+// The proc connector of a pid monitor
+type connector struct {
+	fd      int
+	wakeFd  int               // eventfd used to wake up the connector thread
+	tracked map[uint32]uint32 // descendants of monitored pids (maps each to its monitored ancestor)
+}
+
+// startConnector subscribes to the proc connector (if not done yet) and starts
+// the thread that receives its events; must be called with pm.mu held.
+func (pm *PidMon) startConnector() error {
+	if pm.conn != nil {
+		return nil
+	}
+
+	fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, unix.NETLINK_CONNECTOR)
+	if err != nil {
+		return fmt.Errorf("failed to open proc connector socket: %s", err)
+	}
+
+	addr := &unix.SockaddrNetlink{Family: unix.AF_NETLINK, Groups: cnIdxProc}
+	if err := unix.Bind(fd, addr); err != nil {
+		unix.Close(fd)
+		return fmt.Errorf("failed to bind proc connector socket: %s", err)
+	}
+
+	// a larger buffer makes it less likely to lose events on bursts of forks
+	unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_RCVBUF, connRcvBufSize)
+
+	if err := connSendOp(fd, procCnMcastListen); err != nil {
+		unix.Close(fd)
+		return fmt.Errorf("failed to subscribe to proc connector: %s", err)
+	}
+
+	wakeFd, err := unix.Eventfd(0, unix.EFD_CLOEXEC|unix.EFD_NONBLOCK)
+	if err != nil {
+		unix.Close(fd)
+		return err
+	}
+
+	pm.conn = &connector{
+		fd:      fd,
+		wakeFd:  wakeFd,
+		tracked: make(map[uint32]uint32),
+	}
+
+	c := pm.conn
+	pm.wg.Add(1)
+	go func() {
+		defer pm.wg.Done()
+		connMonitor(pm, c)
+	}()
+
+	return nil
+}
+
+// connSendOp sends the given op (listen / ignore) to the proc connector.
+func connSendOp(fd int, op uint32) error {
+	buf := make([]byte, unix.NLMSG_HDRLEN+cnMsgLen+4)
+	ne := binary.NativeEndian
+
+	// nlmsghdr
+	ne.PutUint32(buf[0:], uint32(len(buf)))
+	ne.PutUint16(buf[4:], unix.NLMSG_DONE)
+
+	// cn_msg
+	msg := buf[unix.NLMSG_HDRLEN:]
+	ne.PutUint32(msg[0:], cnIdxProc)
+	ne.PutUint32(msg[4:], cnValProc)
+	ne.PutUint16(msg[16:], 4)
+
+	// op
+	ne.PutUint32(msg[cnMsgLen:], op)
+
+	return unix.Sendto(fd, buf, 0, &unix.SockaddrNetlink{Family: unix.AF_NETLINK})
+}
+
+// wake wakes up the connector thread (e.g., so that it notices the pid
+// monitor is stopping); must be called with pm.mu held.
+func (c *connector) wake() {
+	one := []byte{1, 0, 0, 0, 0, 0, 0, 0}
+	unix.Write(c.wakeFd, one)
+}
+
+// close unsubscribes from the proc connector and releases its resources; must
+// be called with pm.mu held.
+func (c *connector) close() {
+	connSendOp(c.fd, procCnMcastIgnore)
+	unix.Close(c.fd)
+	unix.Close(c.wakeFd)
+	c.fd = -1
+	c.wakeFd = -1
+}
+
+// trackDescendants adds the current descendants of the given (monitored) pid
+// to the tracked processes; later descendants are tracked as they are forked.
+// Must be called with pm.mu held.
+func (c *connector) trackDescendants(pid uint32) {
+	c.trackFrom(procChildren(), pid)
+}
+
+// trackFrom adds the descendants of the given pid in the given process tree
+// (see procChildren()) to the tracked processes; must be called with pm.mu
+// held.
+func (c *connector) trackFrom(children map[uint32][]uint32, pid uint32) {
+	queue := children[pid]
+	for len(queue) > 0 {
+		child := queue[0]
+		queue = queue[1:]
+		c.tracked[child] = pid
+		queue = append(queue, children[child]...)
+	}
+}
+
+// untrackDescendants stops tracking the descendants of the given pid; must be
+// called with pm.mu held.
+func (c *connector) untrackDescendants(pid uint32) {
+	for desc, root := range c.tracked {
+		if root == pid {
+			delete(c.tracked, desc)
+		}
+	}
+}
+
+// procChildren returns the children of each process in the system.
+func procChildren() map[uint32][]uint32 {
+	children := make(map[uint32][]uint32)
+
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return children
+	}
+
+	for _, entry := range entries {
+		pid, err := strconv.ParseUint(entry.Name(), 10, 32)
+		if err != nil {
+			continue
+		}
+		// the process may be gone already
+		st, err := pidfd.ReadProcStat(int(pid))
+		if err != nil {
+			continue
+		}
+		ppid, err := st.Uint(4)
+		if err != nil {
+			continue
+		}
+		children[uint32(ppid)] = append(children[uint32(ppid)], uint32(pid))
+	}
+
+	return children
+}
+
+// Receives the proc connector events for the given PidMon instance
+func connMonitor(pm *PidMon, c *connector) {
+	fds := []unix.PollFd{
+		{Fd: int32(c.fd), Events: unix.POLLIN},
+		{Fd: int32(c.wakeFd), Events: unix.POLLIN},
+	}
+	buf := make([]byte, os.Getpagesize()*4)
+
+	for {
+		_, err := unix.Poll(fds, -1)
+
+		select {
+		case <-pm.stopCh:
+			pm.mu.Lock()
+			c.close()
+			pm.mu.Unlock()
+			return
+		default:
+		}
+
+		if err != nil {
+			if errors.Is(err, unix.EINTR) {
+				continue
+			}
+			pm.mu.Lock()
+			d := pm.dispatch(pm.connFail(c, fmt.Errorf("proc connector poll failed: %s", err)))
+			pm.mu.Unlock()
+
+			pm.deliver(d)
+			return
+		}
+
+		eventList := []PidEvent{}
+
+		for {
+			n, _, err := unix.Recvfrom(c.fd, buf, unix.MSG_DONTWAIT)
+			if err != nil {
+				// ENOBUFS means events were lost (the socket buffer
+				// overflowed); there's no way to recover them, so resync
+				// and let the receivers know.
+				if errors.Is(err, unix.ENOBUFS) {
+					pm.mu.Lock()
+					eventList = append(eventList, pm.connResync(c)...)
+					pm.mu.Unlock()
+					continue
+				}
+				if errors.Is(err, unix.EINTR) {
+					continue
+				}
+				break
+			}
+
+			msgs, err := syscall.ParseNetlinkMessage(buf[:n])
+			if err != nil {
+				continue
+			}
+
+			pm.mu.Lock()
+			for _, msg := range msgs {
+				if ev, ok := parseProcEvent(msg.Data); ok {
+					eventList = append(eventList, pm.connHandle(c, ev)...)
+				}
+			}
+			pm.mu.Unlock()
+		}
+
+		pm.mu.Lock()
+		d := pm.dispatch(eventList)
+		pm.mu.Unlock()
+
+		pm.deliver(d)
+	}
+}
+
+// connResync rebuilds the tracked descendants of the monitored pids from procfs
+// after proc connector events were lost; returns an ErrEventsLost event for
+// each pid monitored for proc connector events. Must be called with pm.mu
+// held.
+func (pm *PidMon) connResync(c *connector) []PidEvent {
+	children := procChildren()
+	eventList := []PidEvent{}
+
+	c.tracked = make(map[uint32]uint32)
+
+	for pid, evect := range pm.eventTable {
+		if evect&Descendants != 0 {
+			c.trackFrom(children, pid)
+		}
+		if evect&connEvents != 0 {
+			eventList = append(eventList, PidEvent{Pid: pid, Err: ErrEventsLost})
+		}
+	}
+
+	return eventList
+}
+
+// connFail releases the given connector after an unrecoverable error, so that
+// it's restarted the next time proc connector events are added; returns an
+// event with the given error for each pid monitored for proc connector events
+// (these are no longer reported unless added again). Must be called with pm.mu
+// held.
+func (pm *PidMon) connFail(c *connector, err error) []PidEvent {
+	eventList := []PidEvent{}
+
+	c.close()
+	if pm.conn == c {
+		pm.conn = nil
+	}
+
+	for pid, evect := range pm.eventTable {
+		if evect&connEvents != 0 {
+			eventList = append(eventList, PidEvent{Pid: pid, Err: err})
+		}
+	}
+
+	return eventList
+}
+
+// parseProcEvent parses the given proc connector message (a cn_msg holding a
+// proc_event).
+func parseProcEvent(data []byte) (procEvent, bool) {
+	ne := binary.NativeEndian
+
+	if len(data) < cnMsgLen+procEventHdrLen+8 {
+		return procEvent{}, false
+	}
+	if ne.Uint32(data[0:]) != cnIdxProc || ne.Uint32(data[4:]) != cnValProc {
+		return procEvent{}, false
+	}
+
+	data = data[cnMsgLen:]
+	ev := procEvent{what: ne.Uint32(data[0:])}
+	d := data[procEventHdrLen:]
+
+	need := 0
+	switch ev.what {
+	case procEventFork, procEventUid, procEventGid:
+		need = 16
+	case procEventExec:
+		need = 8
+	case procEventComm:
+		need = 8 + commLen
+	case procEventExit:
+		need = 24
+	default:
+		return procEvent{}, false
+	}
+	if len(d) < need {
+		return procEvent{}, false
+	}
+
+	switch ev.what {
+	case procEventFork:
+		ev.parentPid = ne.Uint32(d[0:])
+		ev.parentTgid = ne.Uint32(d[4:])
+		ev.pid = ne.Uint32(d[8:])
+		ev.tgid = ne.Uint32(d[12:])
+	case procEventExec:
+		ev.pid = ne.Uint32(d[0:])
+		ev.tgid = ne.Uint32(d[4:])
+	case procEventUid, procEventGid:
+		ev.pid = ne.Uint32(d[0:])
+		ev.tgid = ne.Uint32(d[4:])
+		ev.ruid = ne.Uint32(d[8:])
+		ev.euid = ne.Uint32(d[12:])
+	case procEventComm:
+		ev.pid = ne.Uint32(d[0:])
+		ev.tgid = ne.Uint32(d[4:])
+		comm := d[8 : 8+commLen]
+		if i := bytes.IndexByte(comm, 0); i >= 0 {
+			comm = comm[:i]
+		}
+		ev.comm = string(comm)
+	case procEventExit:
+		ev.pid = ne.Uint32(d[0:])
+		ev.tgid = ne.Uint32(d[4:])
+		ev.exitCode = ne.Uint32(d[8:])
+		ev.parentPid = ne.Uint32(d[16:])
+		ev.parentTgid = ne.Uint32(d[20:])
+	}
+
+	return ev, true
+}
+
+// connMatch returns the monitored pid whose events apply to the given process
+// (the process itself or its monitored ancestor), along with its event vector;
+// must be called with pm.mu held.
+func (pm *PidMon) connMatch(c *connector, tgid uint32) (uint32, int, bool) {
+	if evect, found := pm.eventTable[tgid]; found && evect&connEvents != 0 {
+		return tgid, evect, true
+	}
+	if root, found := c.tracked[tgid]; found {
+		if evect := pm.eventTable[root]; evect&Descendants != 0 {
+			return root, evect, true
+		}
+	}
+	return 0, 0, false
+}
+
+// connHandle returns the pid events for the given proc connector event, and
+// tracks the descendants of monitored pids; must be called with pm.mu held.
+func (pm *PidMon) connHandle(c *connector, ev procEvent) []PidEvent {
+
+	// events are reported per process, not per thread
+	if ev.pid != ev.tgid {
+		return nil
+	}
+
+	if ev.what == procEventFork {
+		root, evect, ok := pm.connMatch(c, ev.parentTgid)
+		if !ok {
+			return nil
+		}
+		if evect&Descendants != 0 {
+			c.tracked[ev.tgid] = root
+		}
+		if evect&Fork == 0 {
+			return nil
+		}
+		return []PidEvent{{
+			Pid:   ev.tgid,
+			Event: Fork,
+			Proc:  ProcInfo{Root: root, Parent: ev.parentTgid},
+		}}
+	}
+
+	if ev.what == procEventExit {
+		// the exit of monitored pids is detected by the monitor thread
+		root, found := c.tracked[ev.tgid]
+		if !found {
+			return nil
+		}
+		delete(c.tracked, ev.tgid)
+		evect := pm.eventTable[root]
+		if evect&Descendants == 0 || evect&Exit == 0 {
+			return nil
+		}
+		return []PidEvent{{
+			Pid:      ev.tgid,
+			Event:    Exit,
+			ExitInfo: waitStatusExitInfo(syscall.WaitStatus(ev.exitCode)),
+			Proc:     ProcInfo{Root: root, Parent: ev.parentTgid},
+		}}
+	}
+
+	root, evect, ok := pm.connMatch(c, ev.tgid)
+	if !ok {
+		return nil
+	}
+
+	e := PidEvent{Pid: ev.tgid, Proc: ProcInfo{Root: root}}
+
+	switch ev.what {
+	case procEventExec:
+		e.Event = Exec
+	case procEventUid:
+		e.Event = Uid
+		e.Proc.Ruid = ev.ruid
+		e.Proc.Euid = ev.euid
+	case procEventGid:
+		e.Event = Gid
+		e.Proc.Rgid = ev.ruid
+		e.Proc.Egid = ev.euid
+	case procEventComm:
+		e.Event = Comm
+		e.Proc.Comm = ev.comm
+	}
+
+	if evect&e.Event == 0 {
+		return nil
+	}
+	return []PidEvent{e}
+}
@@ -0,0 +1,263 @@
+//
+// Copyright 2026 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package pidmonitor
+
+import (
+	"errors"
+	"os"
+	"time"
+
+	"github.com/nestybox/sysbox-libs/pidfd"
+	"golang.org/x/sys/unix"
+)
+
+// The pidfd backend opens a pidfd for each monitored pid and waits on them
+// with epoll; a pidfd becomes readable when its process exits, so exit events
+// are delivered immediately. Since the pidfd refers to the process (rather
+// than its pid), it's not fooled by pid reuse. Pids for which a pidfd can't be
+// opened (e.g., the process is a thread, or the fd limit was hit) are polled.
+
+// set by tests to force the polling backend
+var disablePidfd = false
+
+// pidfdSupported returns true if the kernel supports pidfd_open() (Linux 5.3+).
+func pidfdSupported() bool {
+	if disablePidfd {
+		return false
+	}
+	fd, err := pidfd.Open(os.Getpid(), 0)
+	if err != nil {
+		return false
+	}
+	unix.Close(int(fd))
+	return true
+}
+
+// epollInit sets up the epoll instance (and the eventfd used to wake up the
+// monitor thread).
+func (pm *PidMon) epollInit() error {
+	epollFd, err := unix.EpollCreate1(unix.EPOLL_CLOEXEC)
+	if err != nil {
+		return err
+	}
+
+	wakeFd, err := unix.Eventfd(0, unix.EFD_CLOEXEC|unix.EFD_NONBLOCK)
+	if err != nil {
+		unix.Close(epollFd)
+		return err
+	}
+
+	ev := unix.EpollEvent{Events: unix.EPOLLIN, Fd: int32(wakeFd)}
+	if err := unix.EpollCtl(epollFd, unix.EPOLL_CTL_ADD, wakeFd, &ev); err != nil {
+		unix.Close(wakeFd)
+		unix.Close(epollFd)
+		return err
+	}
+
+	pm.epollFd = epollFd
+	pm.wakeFd = wakeFd
+	pm.pidfds = make(map[uint32]pidfd.PidFd)
+	pm.fdPids = make(map[int32]uint32)
+	pm.exited = make(map[uint32]bool)
+	return nil
+}
+
+// epollClose releases the epoll instance and the pidfds; must be called with
+// pm.mu held.
+func (pm *PidMon) epollClose() {
+	for pid := range pm.pidfds {
+		pm.unwatchPid(pid)
+	}
+	if pm.wakeFd >= 0 {
+		unix.Close(pm.wakeFd)
+		pm.wakeFd = -1
+	}
+	if pm.epollFd >= 0 {
+		unix.Close(pm.epollFd)
+		pm.epollFd = -1
+	}
+	pm.usePidfd = false
+}
+
+// wake wakes up the monitor thread; must be called with pm.mu held.
+func (pm *PidMon) wake() {
+	if pm.wakeFd >= 0 {
+		one := []byte{1, 0, 0, 0, 0, 0, 0, 0}
+		unix.Write(pm.wakeFd, one)
+	}
+}
+
+// watchPid opens a pidfd for the given pid and adds it to the epoll instance.
+// If the process is already gone, its exit is reported on the next iteration
+// of the monitor thread; if the pidfd can't be set up, the pid is polled. Must
+// be called with pm.mu held.
+func (pm *PidMon) watchPid(pid uint32) {
+	if _, found := pm.pidfds[pid]; found || pm.exited[pid] {
+		return
+	}
+
+	fd, err := pidfd.Open(int(pid), 0)
+	if err != nil {
+		if errors.Is(err, unix.ESRCH) {
+			pm.exited[pid] = true
+		}
+		return
+	}
+
+	ev := unix.EpollEvent{Events: unix.EPOLLIN, Fd: int32(fd)}
+	if err := unix.EpollCtl(pm.epollFd, unix.EPOLL_CTL_ADD, int(fd), &ev); err != nil {
+		unix.Close(int(fd))
+		return
+	}
+
+	pm.pidfds[pid] = fd
+	pm.fdPids[int32(fd)] = pid
+}
+
+// unwatchPid releases the pidfd of the given pid; must be called with pm.mu
+// held.
+func (pm *PidMon) unwatchPid(pid uint32) {
+	delete(pm.exited, pid)
+
+	fd, found := pm.pidfds[pid]
+	if !found {
+		return
+	}
+	unix.EpollCtl(pm.epollFd, unix.EPOLL_CTL_DEL, int(fd), nil)
+	unix.Close(int(fd))
+	delete(pm.pidfds, pid)
+	delete(pm.fdPids, int32(fd))
+}
+
+// hasPolledPids returns true if any of the pids monitored for exit has no
+// pidfd; must be called with pm.mu held.
+func (pm *PidMon) hasPolledPids() bool {
+	for pid, evect := range pm.eventTable {
+		if !eventIsSet(evect, Exit) {
+			continue
+		}
+		if _, found := pm.pidfds[pid]; !found && !pm.exited[pid] {
+			return true
+		}
+	}
+	return false
+}
+
+// Monitors events associated with the given PidMon instance (pidfd backend)
+func pidfdMonitor(pm *PidMon) {
+	events := make([]unix.EpollEvent, 64)
+	lastPoll := time.Now()
+	pollPeriod := pm.cfg.Poll * time.Millisecond
+
+	for {
+		pm.mu.Lock()
+
+		// Close() sets closed (under the lock) before waking us up; checking
+		// it here ensures the wake up is not lost if it's consumed while
+		// handling a previous one.
+		if pm.closed {
+			pm.epollClose()
+			pm.mu.Unlock()
+			return
+		}
+
+		timeout := -1
+		if pm.hasPolledPids() {
+			timeout = int((pollPeriod - time.Since(lastPoll)).Milliseconds())
+			if timeout < 0 {
+				timeout = 0
+			}
+		}
+		epollFd := pm.epollFd
+		pm.mu.Unlock()
+
+		n, err := unix.EpollWait(epollFd, events, timeout)
+		if err != nil {
+			if !errors.Is(err, unix.EINTR) {
+				// fall back to polling
+				pm.mu.Lock()
+				pm.epollClose()
+				pm.mu.Unlock()
+				pidMonitor(pm)
+				return
+			}
+			n = 0
+		}
+
+		// check for stop first
+		select {
+		case <-pm.stopCh:
+			pm.mu.Lock()
+			pm.epollClose()
+			pm.mu.Unlock()
+			return
+		default:
+		}
+
+		eventList := []PidEvent{}
+
+		pm.mu.Lock()
+
+		for i := 0; i < n; i++ {
+			fd := events[i].Fd
+			if int(fd) == pm.wakeFd {
+				buf := make([]byte, 8)
+				unix.Read(pm.wakeFd, buf)
+				continue
+			}
+			if pid, found := pm.fdPids[fd]; found {
+				pm.exited[pid] = true
+			}
+		}
+
+		for pid := range pm.exited {
+			if !eventIsSet(pm.eventTable[pid], Exit) {
+				pm.unwatchPid(pid)
+				continue
+			}
+			// no exit info for processes that were gone when added
+			info := ExitInfo{}
+			if fd, found := pm.pidfds[pid]; found {
+				info = pidfdExitInfo(pid, fd)
+			}
+			eventList = append(eventList, PidEvent{Pid: pid, Event: Exit, ExitInfo: info})
+		}
+
+		if time.Since(lastPoll) >= pollPeriod {
+			for pid, evect := range pm.eventTable {
+				if !eventIsSet(evect, Exit) || pm.exited[pid] {
+					continue
+				}
+				if _, found := pm.pidfds[pid]; found {
+					continue
+				}
+				exited, info, err := pm.checkExit(pid)
+				if err != nil || exited {
+					eventList = append(eventList, PidEvent{Pid: pid, Event: Exit, Err: err, ExitInfo: info})
+				}
+			}
+			lastPoll = time.Now()
+		}
+
+		// release the lock so that we don't hold it while delivering the
+		// events (in case a receiver is blocked).
+		d := pm.dispatch(eventList)
+		pm.mu.Unlock()
+
+		pm.deliver(d)
+	}
+}
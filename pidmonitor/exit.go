@@ -0,0 +1,189 @@
+//
+// Copyright 2026 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package pidmonitor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+
+	"github.com/nestybox/sysbox-libs/pidfd"
+	"golang.org/x/sys/unix"
+)
+
+// ExitInfo describes how a process exited. The exit status can only be
+// obtained while the process is a zombie (i.e., before it's reaped by its
+// parent); if it could not be obtained, Valid is false and the other fields
+// are zero.
+type ExitInfo struct {
+	Valid     bool           // the exit status was obtained
+	Code      int            // exit code (when the process exited normally)
+	Signal    syscall.Signal // signal that terminated the process (0 if it exited normally)
+	CoreDump  bool           // the process dumped core
+	HasRusage bool           // Rusage is valid (only when we are the process' parent)
+	Rusage    unix.Rusage    // resource usage of the process (and its waited-for children)
+}
+
+// pidfdExitInfo returns the exit info of the (exited) process referred to by
+// the given pidfd. The process is not reaped. waitid() only works if we are
+// the process' parent; otherwise the exit status is read from procfs.
+func pidfdExitInfo(pid uint32, fd pidfd.PidFd) ExitInfo {
+	var ws syscall.WaitStatus
+	var ru unix.Rusage
+
+	wpid, err := fd.Waitid(&ws, unix.WEXITED|unix.WNOHANG|unix.WNOWAIT, (*syscall.Rusage)(unsafe.Pointer(&ru)))
+	if err == nil {
+		// with WNOHANG, waitid() returns pid 0 if there's no zombie
+		if wpid == 0 {
+			return ExitInfo{}
+		}
+		return waitidExitInfo(ws, ru)
+	}
+
+	info, err := procExitInfo(pid)
+	if err != nil {
+		return ExitInfo{}
+	}
+
+	// make sure the pid was not reaped (and reused) while reading procfs;
+	// signal 0 fails with ESRCH once the process is reaped.
+	if fd.SendSignal(0, 0) != nil {
+		return ExitInfo{}
+	}
+
+	return info
+}
+
+// waitidExitInfo converts the wait status and resource usage returned by
+// waitid() into an ExitInfo.
+func waitidExitInfo(ws syscall.WaitStatus, ru unix.Rusage) ExitInfo {
+	info := waitStatusExitInfo(ws)
+	if info.Valid {
+		info.HasRusage = true
+		info.Rusage = ru
+	}
+	return info
+}
+
+// waitStatusExitInfo converts a wait status (as returned by wait4()) into an
+// ExitInfo.
+func waitStatusExitInfo(ws syscall.WaitStatus) ExitInfo {
+	switch {
+	case ws.Exited():
+		return ExitInfo{Valid: true, Code: ws.ExitStatus()}
+	case ws.Signaled():
+		return ExitInfo{Valid: true, Signal: ws.Signal(), CoreDump: ws.CoreDump()}
+	}
+	return ExitInfo{}
+}
+
+// procExitInfo returns the exit info of the given zombie process from
+// /proc/<pid>/stat. Returns an error if the process is not a zombie, or if the
+// exit status can't be read.
+func procExitInfo(pid uint32) (ExitInfo, error) {
+	state, exitCode, err := procStat(pid)
+	if err != nil {
+		return ExitInfo{}, err
+	}
+	if state != "Z" {
+		return ExitInfo{}, fmt.Errorf("pid %d is not a zombie (state %s)", pid, state)
+	}
+
+	// The exit code reads as 0 without ptrace read access to the process;
+	// assume we have it if we are root or own the process.
+	if euid := os.Geteuid(); euid != 0 {
+		var st unix.Stat_t
+		if err := unix.Stat(fmt.Sprintf("/proc/%d", pid), &st); err != nil {
+			return ExitInfo{}, err
+		}
+		if st.Uid != uint32(euid) {
+			return ExitInfo{}, fmt.Errorf("no access to the exit status of pid %d", pid)
+		}
+	}
+
+	return waitStatusExitInfo(syscall.WaitStatus(exitCode)), nil
+}
+
+// checkExit checks if the process monitored for exit with the given pid has
+// exited; if the pid now belongs to a different process (i.e., it was reused),
+// the original process has exited. Must be called with pm.mu held.
+func (pm *PidMon) checkExit(pid uint32) (bool, ExitInfo, error) {
+	if id, found := pm.idents[pid]; found {
+		if alive, err := id.Alive(); err == nil && !alive {
+			return true, ExitInfo{}, nil
+		}
+	}
+	return pidExited(pid)
+}
+
+// pidExited checks if the process with the given pid has exited (i.e., it's
+// gone or it's a zombie); if it's a zombie, its exit info is returned too.
+// Used by the polling backend.
+func pidExited(pid uint32) (bool, ExitInfo, error) {
+	state, _, err := procStat(pid)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) || errors.Is(err, unix.ESRCH) {
+			return true, ExitInfo{}, nil
+		}
+		return false, ExitInfo{}, err
+	}
+	if state != "Z" {
+		return false, ExitInfo{}, nil
+	}
+
+	// if we are the parent, waitid() also gives us the resource usage
+	var ws syscall.WaitStatus
+	var ru unix.Rusage
+
+	wpid, err := pidfd.Waitid(int(pid), &ws, unix.WEXITED|unix.WNOHANG|unix.WNOWAIT, (*syscall.Rusage)(unsafe.Pointer(&ru)))
+	if err == nil && wpid != 0 {
+		if info := waitidExitInfo(ws, ru); info.Valid {
+			return true, info, nil
+		}
+	}
+
+	info, err := procExitInfo(pid)
+	if err != nil {
+		return true, ExitInfo{}, nil
+	}
+	return true, info, nil
+}
+
+// procStat returns the state and the exit code (in wait status format) of the
+// given process from /proc/<pid>/stat.
+func procStat(pid uint32) (string, int, error) {
+	st, err := pidfd.ReadProcStat(int(pid))
+	if err != nil {
+		return "", 0, err
+	}
+
+	state, err := st.Field(3)
+	if err != nil {
+		return "", 0, err
+	}
+
+	// the exit code is field 52 (Linux 3.5+), and it's 0 unless we have
+	// ptrace read access.
+	exitCode, err := st.Uint(52)
+	if err != nil {
+		return "", 0, err
+	}
+
+	return state, int(exitCode), nil
+}
@@ -4,6 +4,10 @@ go 1.21
 
 toolchain go1.21.0
 
-require github.com/sirupsen/logrus v1.9.4
+require (
+	github.com/nestybox/sysbox-libs/pidfd v0.0.0-00010101000000-000000000000
+	github.com/sirupsen/logrus v1.9.4
+	golang.org/x/sys v0.13.0
+)
 
-require golang.org/x/sys v0.13.0 // indirect
+replace github.com/nestybox/sysbox-libs/pidfd => ../pidfd
@@ -20,9 +20,13 @@
 package pidmonitor
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
+
+	"github.com/nestybox/sysbox-libs/pidfd"
 )
 
 // pidMon configuration info
@@ -38,23 +42,77 @@ const (
 
 // Pid event types (bit-vector)
 const (
-	Exit int = 0x1 // Process exited
+	Exit int = 0x1  // Process exited
+	Fork int = 0x2  // Process forked a child (reported for the child)
+	Exec int = 0x4  // Process called exec()
+	Uid  int = 0x8  // Process changed its user ids
+	Gid  int = 0x10 // Process changed its group ids
+	Comm int = 0x20 // Process changed its command name
+
+	// Modifier: the events are also monitored for all descendants of the
+	// process (including those forked later).
+	Descendants int = 0x100
+)
+
+const (
+	allEvents = Exit | Fork | Exec | Uid | Gid | Comm | Descendants
+
+	// events that require the proc connector (see connector.go)
+	connEvents = Fork | Exec | Uid | Gid | Comm | Descendants
 )
 
 // Represents an event on the given process
 type PidEvent struct {
-	Pid   uint32
-	Event int   // bit vector of events
-	Err   error // set by WaitEvent() when an error is detected
+	Pid      uint32
+	Event    int      // bit vector of events
+	Err      error    // set by WaitEvent() when an error is detected
+	ExitInfo ExitInfo // exit status (Exit events only; see ExitInfo.Valid)
+	Proc     ProcInfo // details of proc connector events
+}
+
+// Details of the events reported by the proc connector; fields not related to
+// the event are zero.
+type ProcInfo struct {
+	Root       uint32 // monitored pid the event was reported for (the process itself, or its ancestor)
+	Parent     uint32 // parent of the process (Fork and descendant Exit events)
+	Ruid, Euid uint32 // new user ids (Uid events)
+	Rgid, Egid uint32 // new group ids (Gid events)
+	Comm       string // new command name (Comm events)
 }
 
+// Returned by WaitEvent() and Subscribe() once the pid monitor is closed
+var ErrClosed = errors.New("pid monitor closed")
+
+// Set in the Err field of an event (with no event type) for the monitored pids
+// whose proc connector events (see connector.go) may have been lost, e.g., on
+// a burst of forks that overflows the connector's socket buffer. Descendants
+// forked meanwhile are still tracked, but their events may be missing.
+var ErrEventsLost = errors.New("proc connector events lost")
+
 // Represents a pid monitor instance
 type PidMon struct {
 	mu         sync.Mutex
 	cfg        *Cfg
-	eventTable map[uint32]int  // maps each pid to it's event vector
-	cmdCh      chan cmd        // sends commands to monitor thread
-	EventCh    chan []PidEvent // receives events from monitor thread
+	eventTable map[uint32]int             // maps each pid to it's event vector (AddEvent() and subscriptions combined)
+	added      map[uint32]int             // events added with AddEvent()
+	subs       map[uint32][]*Subscription // subscriptions of each pid
+	eventCh    chan []PidEvent            // receives events from monitor thread
+	stopCh     chan struct{}              // closed to stop the monitor (and connector) threads
+	wg         sync.WaitGroup             // tracks the monitor and connector threads
+	closed     bool
+	closeOnce  sync.Once
+
+	// pidfd backend (see epoll.go)
+	usePidfd bool
+	epollFd  int
+	wakeFd   int                    // eventfd used to wake up the monitor thread
+	pidfds   map[uint32]pidfd.PidFd // pidfd of each pid monitored for exit
+	fdPids   map[int32]uint32       // maps each pidfd to its pid
+	exited   map[uint32]bool        // pids found to have exited, pending report
+
+	idents map[uint32]*pidfd.ProcessIdentity // identity of the processes monitored for exit
+
+	conn *connector // proc connector (started on demand)
 }
 
 // Creates a instance of the pid monitor; returns the pidMon ID.
@@ -67,16 +125,40 @@ func New(cfg *Cfg) (*PidMon, error) {
 	pm := &PidMon{
 		cfg:        cfg,
 		eventTable: make(map[uint32]int),
-		cmdCh:      make(chan cmd),
-		EventCh:    make(chan []PidEvent, 100), // buffered to prevent monitor thread from blocking when pushing events
+		added:      make(map[uint32]int),
+		subs:       make(map[uint32][]*Subscription),
+		idents:     make(map[uint32]*pidfd.ProcessIdentity),
+		eventCh:    make(chan []PidEvent, 100), // buffered to prevent monitor thread from blocking when pushing events
+		stopCh:     make(chan struct{}),
+		epollFd:    -1,
+		wakeFd:     -1,
 	}
 
-	go pidMonitor(pm)
+	// Use pidfds if the kernel supports them; otherwise fall back to polling.
+	monitor := pidMonitor
+	if pidfdSupported() && pm.epollInit() == nil {
+		pm.usePidfd = true
+		monitor = pidfdMonitor
+	}
+
+	pm.wg.Add(1)
+	go func() {
+		defer pm.wg.Done()
+		monitor(pm)
+	}()
 
 	return pm, nil
 }
 
-// Adds one or more events to the list of events monitored by the given pidMon
+// Adds one or more events to the list of events monitored by the given pidMon.
+// Events other than Exit (and the Exit of descendants) are detected via the
+// kernel's proc connector; an error is returned if it can't be used (e.g., the
+// caller lacks CAP_NET_ADMIN).
+//
+// The Exit event is reported once the process terminates, i.e., when it
+// becomes a zombie rather than once it's reaped (so that its exit status can
+// be reported). If the pid is gone already, its Exit event is reported right
+// away (asynchronously, like any other event).
 func (pm *PidMon) AddEvent(events []PidEvent) error {
 
 	for _, e := range events {
@@ -84,7 +166,12 @@ func (pm *PidMon) AddEvent(events []PidEvent) error {
 			return fmt.Errorf("Unknown event %v", e.Event)
 		}
 		pm.mu.Lock()
-		eventTableAdd(pm.eventTable, e)
+		added := eventSet(pm.added[e.Pid], e.Event)
+		if err := pm.setEvents(e.Pid, added|pm.subEvents(e.Pid)); err != nil {
+			pm.mu.Unlock()
+			return err
+		}
+		pm.added[e.Pid] = added
 		pm.mu.Unlock()
 	}
 
@@ -99,22 +186,126 @@ func (pm *PidMon) RemoveEvent(events []PidEvent) error {
 			return fmt.Errorf("Unknown event %v", e.Event)
 		}
 		pm.mu.Lock()
-		eventTableRm(pm.eventTable, e)
+		eventTableRm(pm.added, e)
+		pm.setEvents(e.Pid, pm.added[e.Pid]|pm.subEvents(e.Pid))
 		pm.mu.Unlock()
 	}
 
 	return nil
 }
 
-// Blocks the calling process until the given pidMon detects an event in one or more of
-// the processes it's monitoring. Returns the list of events.
-func (pm *PidMon) WaitEvent() []PidEvent {
-	eventList := <-pm.EventCh
-	return eventList
+// setEvents sets the events monitored for the given pid (those added with
+// AddEvent() plus those of its subscriptions), and sets up (or releases) what's
+// needed to monitor them. Must be called with pm.mu held.
+func (pm *PidMon) setEvents(pid uint32, evect int) error {
+	if pm.closed {
+		return ErrClosed
+	}
+
+	prev := pm.eventTable[pid]
+
+	if evect&connEvents != 0 {
+		if err := pm.startConnector(); err != nil {
+			return err
+		}
+	}
+	if evect&Descendants != 0 && prev&Descendants == 0 {
+		pm.conn.trackDescendants(pid)
+	}
+	if eventIsSet(evect, Exit) && !eventIsSet(prev, Exit) {
+		// remember which process has the pid now, so that its exit is
+		// detected even if the pid is reused (the process may be gone
+		// already).
+		if id, err := pidfd.NewProcessIdentity(int(pid), false); err == nil {
+			pm.idents[pid] = id
+		}
+	}
+
+	if evect == 0 {
+		delete(pm.eventTable, pid)
+	} else {
+		pm.eventTable[pid] = evect
+	}
+
+	if eventIsSet(evect, Exit) {
+		if pm.usePidfd && !eventIsSet(prev, Exit) {
+			pm.watchPid(pid)
+			pm.wake()
+		}
+	} else {
+		delete(pm.idents, pid)
+		if pm.usePidfd {
+			pm.unwatchPid(pid)
+		}
+	}
+
+	if pm.conn != nil && evect&Descendants == 0 {
+		pm.conn.untrackDescendants(pid)
+	}
+
+	return nil
+}
+
+// clearExit stops monitoring the exit of the given pid, once it has been
+// detected; must be called with pm.mu held.
+func (pm *PidMon) clearExit(pid uint32) {
+	e := PidEvent{Pid: pid, Event: Exit}
+	eventTableRm(pm.eventTable, e)
+	eventTableRm(pm.added, e)
+	delete(pm.idents, pid)
+	if pm.usePidfd {
+		pm.unwatchPid(pid)
+	}
+}
+
+// Events returns the channel on which the events added with AddEvent() are
+// delivered (in batches); it's closed when the pid monitor is closed.
+func (pm *PidMon) Events() <-chan []PidEvent {
+	return pm.eventCh
 }
 
-// Stops the given pidMon. Causes WaitEvent() to return immediately (likely
-// with an empty pid list).
+// Blocks the calling process until the given pidMon detects an event in one or
+// more of the processes it's monitoring (for events added with AddEvent()), or
+// until the given context is done. Returns the list of events; returns
+// ErrClosed if the pidMon is closed, or the context's error.
+func (pm *PidMon) WaitEvent(ctx context.Context) ([]PidEvent, error) {
+	select {
+	case eventList, ok := <-pm.eventCh:
+		if !ok {
+			return nil, ErrClosed
+		}
+		return eventList, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Stops the given pidMon and waits for its threads to exit. Causes
+// WaitEvent() to return ErrClosed, and closes the Events() channel and those
+// of all subscriptions. It's safe to call it multiple times.
 func (pm *PidMon) Close() {
-	pm.cmdCh <- stop
+	pm.closeOnce.Do(func() {
+		pm.mu.Lock()
+		pm.closed = true
+		close(pm.stopCh)
+		pm.wake()
+		if pm.conn != nil {
+			pm.conn.wake()
+		}
+		pm.mu.Unlock()
+
+		pm.wg.Wait()
+
+		pm.mu.Lock()
+		subs := pm.subs
+		pm.subs = make(map[uint32][]*Subscription)
+		pm.mu.Unlock()
+
+		for _, pidSubs := range subs {
+			for _, s := range pidSubs {
+				s.close()
+			}
+		}
+		close(pm.eventCh)
+	})
 }
@@ -17,15 +17,24 @@
 package pidmonitor
 
 import (
+	"context"
+	"encoding/binary"
+	"errors"
 	"fmt"
 	"math/rand"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"slices"
 	"sort"
+	"strconv"
+	"strings"
+	"syscall"
 	"testing"
 	"time"
 
 	log "github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
 )
 
 func init() {
@@ -62,8 +71,10 @@ func eventListEqual(a, b []PidEvent) bool {
 	eventListSort(a)
 	eventListSort(b)
 
+	// the exit info depends on whether the exit was seen before the process
+	// was reaped, so it's not compared
 	for i, event := range a {
-		if b[i] != event {
+		if b[i].Pid != event.Pid || b[i].Event != event.Event || b[i].Err != event.Err {
 			return false
 		}
 	}
@@ -158,7 +169,11 @@ func waitAndCheckEvent(t *testing.T, numProc int, pidMon *PidMon, want []PidEven
 
 	eventList := []PidEvent{}
 	for {
-		pidEvents := pidMon.WaitEvent()
+		pidEvents, err := pidMon.WaitEvent(context.Background())
+		if err != nil {
+			resultCh <- fmt.Errorf("pidMon.WaitEvent() failed: %s", err)
+			return
+		}
 		eventList = append(eventList, pidEvents...)
 		if len(eventList) >= numProc {
 			break
@@ -174,6 +189,17 @@ func waitAndCheckEvent(t *testing.T, numProc int, pidMon *PidMon, want []PidEven
 }
 
 func TestEventExit(t *testing.T) {
+	testEventExit(t)
+}
+
+func TestEventExitPollFallback(t *testing.T) {
+	disablePidfd = true
+	defer func() { disablePidfd = false }()
+
+	testEventExit(t)
+}
+
+func testEventExit(t *testing.T) {
 
 	numProc := 10
 
@@ -187,6 +213,10 @@ func TestEventExit(t *testing.T) {
 	}
 	defer pidMon.Close()
 
+	if pidMon.usePidfd == disablePidfd {
+		t.Fatalf("New() failed: want pidfd backend = %v, got %v", !disablePidfd, pidMon.usePidfd)
+	}
+
 	pidList, err := spawnDummyProcesses(numProc)
 	if err != nil {
 		t.Fatalf("spawnDummyProcesses() failed: %s\n", err)
@@ -195,7 +225,7 @@ func TestEventExit(t *testing.T) {
 	// create the event monitor list
 	eventList := []PidEvent{}
 	for _, pid := range pidList {
-		eventList = append(eventList, PidEvent{uint32(pid), Exit, nil})
+		eventList = append(eventList, PidEvent{Pid: uint32(pid), Event: Exit})
 	}
 
 	resultCh := make(chan error)
@@ -227,7 +257,7 @@ func TestEventExit(t *testing.T) {
 //
 
 // Spawns up to numProc processes at random intervals
-func spawner(t *testing.T, numProc int, startCh chan bool, spawnedCh chan []int) {
+func spawner(numProc int, startCh chan bool, spawnedCh chan []int, errCh chan error) {
 	src := rand.NewSource(time.Now().UnixNano())
 	random := rand.New(src)
 
@@ -238,7 +268,8 @@ func spawner(t *testing.T, numProc int, startCh chan bool, spawnedCh chan []int)
 	for i := 0; i < numProc; i++ {
 		pidList, err := spawnDummyProcesses(1)
 		if err != nil {
-			t.Fatalf("spawnDummyProcesses() failed: %s\n", err)
+			errCh <- fmt.Errorf("spawnDummyProcesses() failed: %s\n", err)
+			return
 		}
 
 		spawnedCh <- pidList
@@ -251,7 +282,7 @@ func spawner(t *testing.T, numProc int, startCh chan bool, spawnedCh chan []int)
 }
 
 // Kills spawned processes at random intervals
-func killer(t *testing.T, numProc int, pidMon *PidMon, spawnedCh, killedCh chan []int) {
+func killer(numProc int, pidMon *PidMon, spawnedCh, killedCh chan []int, errCh chan error) {
 	src := rand.NewSource(time.Now().UnixNano())
 	random := rand.New(src)
 
@@ -264,16 +295,18 @@ func killer(t *testing.T, numProc int, pidMon *PidMon, spawnedCh, killedCh chan
 		// Tell pidMon to watch for exit event on the spawned processes
 		eventList := []PidEvent{}
 		for _, pid := range spawnedList {
-			eventList = append(eventList, PidEvent{uint32(pid), Exit, nil})
+			eventList = append(eventList, PidEvent{Pid: uint32(pid), Event: Exit})
 		}
 		if err := pidMon.AddEvent(eventList); err != nil {
-			t.Fatalf("AddEvent() failed: %s\n", err)
+			errCh <- fmt.Errorf("AddEvent() failed: %s\n", err)
+			return
 		}
 
 		// Kill the processes
 		for _, pid := range spawnedList {
 			if err := killDummyProcesses([]int{pid}); err != nil {
-				t.Fatalf("KillDummyProcesss() failed: %s\n", err)
+				errCh <- fmt.Errorf("KillDummyProcesss() failed: %s\n", err)
+				return
 			}
 			delay := random.Intn(10)
 			time.Sleep(time.Duration(delay) * time.Millisecond)
@@ -292,20 +325,25 @@ func killer(t *testing.T, numProc int, pidMon *PidMon, spawnedCh, killedCh chan
 }
 
 // Waits for the pid monitor events
-func waiter(t *testing.T, numProc int, pidMon *PidMon, eventCh chan []int) {
+func waiter(numProc int, pidMon *PidMon, eventCh chan []int, errCh chan error) {
 	src := rand.NewSource(time.Now().UnixNano())
 	random := rand.New(src)
 
 	eventList := []int{}
 
 	for {
-		pidEvents := pidMon.WaitEvent()
+		pidEvents, err := pidMon.WaitEvent(context.Background())
+		if err != nil {
+			errCh <- fmt.Errorf("pidMon.WaitEvent() failed: %s", err)
+			return
+		}
 
 		log.Debugf("waiter: events %v\n", pidEvents)
 
 		for _, e := range pidEvents {
 			if e.Event != Exit {
-				t.Fatalf("pidMon reported non-exit event: pid = %d, event = %x\n", e.Pid, e.Event)
+				errCh <- fmt.Errorf("pidMon reported non-exit event: pid = %d, event = %x\n", e.Pid, e.Event)
+				return
 			}
 			eventList = append(eventList, int(e.Pid))
 		}
@@ -340,19 +378,769 @@ func TestEventExitConcurrent(t *testing.T) {
 	spawnedCh := make(chan []int, 100)
 	killedCh := make(chan []int, 100)
 	eventCh := make(chan []int, 100)
+	errCh := make(chan error, 3)
 
-	go spawner(t, numProc, startCh, spawnedCh)
-	go killer(t, numProc, pidMon, spawnedCh, killedCh)
-	go waiter(t, numProc, pidMon, eventCh)
+	go spawner(numProc, startCh, spawnedCh, errCh)
+	go killer(numProc, pidMon, spawnedCh, killedCh, errCh)
+	go waiter(numProc, pidMon, eventCh, errCh)
 
 	// start spawning
 	startCh <- true
 
 	// wait for killer and checker to finish
-	killedList := <-killedCh
-	eventList := <-eventCh
+	var killedList, eventList []int
+	for killedList == nil || eventList == nil {
+		select {
+		case killedList = <-killedCh:
+		case eventList = <-eventCh:
+		case err := <-errCh:
+			t.Fatal(err)
+		}
+	}
 
 	if !pidListEqual(eventList, killedList) {
 		t.Fatalf("event list does not match kill list: events: %+v; killed: %+v\n", eventList, killedList)
 	}
 }
+
+func TestEventExitPidfd(t *testing.T) {
+
+	// use the max poll time, so that events can only come from the pidfds
+	pidMonCfg := &Cfg{
+		Poll: PollMax,
+	}
+
+	pidMon, err := New(pidMonCfg)
+	if err != nil {
+		t.Fatalf("New() failed: %s", err)
+	}
+	defer pidMon.Close()
+
+	if !pidMon.usePidfd {
+		t.Skip("pidfd not supported")
+	}
+
+	pidList, err := spawnDummyProcesses(2)
+	if err != nil {
+		t.Fatalf("spawnDummyProcesses() failed: %s\n", err)
+	}
+
+	// the exit of a process that's already gone is reported right away
+	if err := killDummyProcesses(pidList[:1]); err != nil {
+		t.Fatalf("KillDummyProcesss() failed: %s\n", err)
+	}
+
+	for i, pid := range pidList {
+		start := time.Now()
+
+		if err := pidMon.AddEvent([]PidEvent{{Pid: uint32(pid), Event: Exit}}); err != nil {
+			t.Fatalf("AddEvent() failed: %s\n", err)
+		}
+		if i > 0 {
+			if err := killDummyProcesses([]int{pid}); err != nil {
+				t.Fatalf("KillDummyProcesss() failed: %s\n", err)
+			}
+		}
+
+		want := []PidEvent{{Pid: uint32(pid), Event: Exit}}
+		got, err := pidMon.WaitEvent(context.Background())
+		if err != nil {
+			t.Fatalf("pidMon.WaitEvent() failed: %s", err)
+		}
+
+		if !eventListEqual(want, got) {
+			t.Fatalf("pidMon.WaitEvent() failed: want %+v, got %+v\n", want, got)
+		}
+		if d := time.Since(start); d >= PollMax*time.Millisecond {
+			t.Fatalf("pidMon.WaitEvent() took too long: %v", d)
+		}
+	}
+
+	pidMon.mu.Lock()
+	numFds := len(pidMon.pidfds)
+	pidMon.mu.Unlock()
+
+	if numFds != 0 {
+		t.Fatalf("pidfds not released: %d left", numFds)
+	}
+}
+
+func TestExitInfo(t *testing.T) {
+	for _, usePidfd := range []bool{true, false} {
+		disablePidfd = !usePidfd
+
+		pidMon, err := New(&Cfg{Poll: 10})
+		if err != nil {
+			t.Fatalf("New() failed: %s", err)
+		}
+
+		tests := []struct {
+			cmd    *exec.Cmd
+			signal syscall.Signal // sent to the process
+			want   ExitInfo
+		}{
+			{exec.Command("sh", "-c", "exit 3"), 0, ExitInfo{Valid: true, Code: 3}},
+			{exec.Command("sleep", "100"), syscall.SIGTERM, ExitInfo{Valid: true, Signal: syscall.SIGTERM}},
+		}
+
+		for _, tt := range tests {
+			if err := tt.cmd.Start(); err != nil {
+				t.Fatalf("failed to start %v: %s", tt.cmd.Args, err)
+			}
+			pid := tt.cmd.Process.Pid
+
+			if err := pidMon.AddEvent([]PidEvent{{Pid: uint32(pid), Event: Exit}}); err != nil {
+				t.Fatalf("AddEvent() failed: %s\n", err)
+			}
+			if tt.signal != 0 {
+				tt.cmd.Process.Signal(tt.signal)
+			}
+
+			// the process is not reaped until the event is received
+			events, err := pidMon.WaitEvent(context.Background())
+			tt.cmd.Wait()
+			if err != nil {
+				t.Fatalf("WaitEvent() failed: %s", err)
+			}
+
+			if len(events) != 1 || events[0].Pid != uint32(pid) || events[0].Err != nil {
+				t.Fatalf("WaitEvent() failed: want exit of pid %d, got %+v", pid, events)
+			}
+
+			got := events[0].ExitInfo
+			if !got.HasRusage {
+				t.Fatalf("ExitInfo failed (pidfd = %v): no rusage for child process", usePidfd)
+			}
+			got.HasRusage = false
+			got.Rusage = unix.Rusage{}
+
+			if got != tt.want {
+				t.Fatalf("ExitInfo failed (pidfd = %v): want %+v, got %+v", usePidfd, tt.want, got)
+			}
+		}
+
+		pidMon.Close()
+	}
+	disablePidfd = false
+}
+
+func TestProcExitInfo(t *testing.T) {
+	cmd := exec.Command("sh", "-c", "kill -TERM $$")
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer cmd.Wait()
+
+	pid := uint32(cmd.Process.Pid)
+
+	// wait for the child to become a zombie
+	for i := 0; ; i++ {
+		state, _, err := procStat(pid)
+		if err != nil {
+			t.Fatalf("procStat() failed: %s", err)
+		}
+		if state == "Z" {
+			break
+		}
+		if i > 100 {
+			t.Fatalf("process did not exit")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	want := ExitInfo{Valid: true, Signal: syscall.SIGTERM}
+	got, err := procExitInfo(pid)
+	if err != nil {
+		t.Fatalf("procExitInfo() failed: %s", err)
+	}
+	if got != want {
+		t.Fatalf("procExitInfo() failed: want %+v, got %+v", want, got)
+	}
+
+	if _, err := procExitInfo(uint32(os.Getpid())); err == nil {
+		t.Fatalf("procExitInfo() failed: want error for live process, got nil")
+	}
+}
+
+func TestProcConnector(t *testing.T) {
+
+	pidMon, err := New(&Cfg{Poll: 100})
+	if err != nil {
+		t.Fatalf("New() failed: %s", err)
+	}
+	defer pidMon.Close()
+
+	// the shell waits for input before forking a child that exits with 5, and
+	// then execs sleep
+	cmd := exec.Command("sh", "-c", "read x; sh -c 'exit 5'; exec sleep 100")
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer cmd.Wait()
+	defer cmd.Process.Kill()
+
+	root := uint32(cmd.Process.Pid)
+	mask := Fork | Exec | Exit | Descendants
+
+	if err := pidMon.AddEvent([]PidEvent{{Pid: root, Event: mask}}); err != nil {
+		t.Skipf("proc connector not available: %s", err)
+	}
+
+	stdin.Write([]byte("go\n"))
+
+	// collect events until the root execs sleep
+	got := []PidEvent{}
+	timeout := time.After(5 * time.Second)
+	for done := false; !done; {
+		select {
+		case events := <-pidMon.Events():
+			for _, e := range events {
+				got = append(got, e)
+				if e.Pid == root && e.Event == Exec {
+					done = true
+				}
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for events; got %+v", got)
+		}
+	}
+
+	// find the child
+	child := uint32(0)
+	for _, e := range got {
+		if e.Event == Fork {
+			if e.Proc.Root != root || e.Proc.Parent != root {
+				t.Fatalf("Fork event failed: want root & parent %d, got %+v", root, e)
+			}
+			child = e.Pid
+		}
+	}
+	if child == 0 {
+		t.Fatalf("no Fork event; got %+v", got)
+	}
+
+	want := []PidEvent{
+		{Pid: child, Event: Fork, Proc: ProcInfo{Root: root, Parent: root}},
+		{Pid: child, Event: Exec, Proc: ProcInfo{Root: root}},
+		{Pid: child, Event: Exit, ExitInfo: ExitInfo{Valid: true, Code: 5}, Proc: ProcInfo{Root: root, Parent: root}},
+		{Pid: root, Event: Exec, Proc: ProcInfo{Root: root}},
+	}
+	for _, w := range want {
+		if !slices.Contains(got, w) {
+			t.Fatalf("missing event %+v; got %+v", w, got)
+		}
+	}
+
+	// the root's exit comes from the monitor thread
+	cmd.Process.Kill()
+
+	events, err := pidMon.WaitEvent(context.Background())
+	if err != nil {
+		t.Fatalf("WaitEvent() failed: %s", err)
+	}
+	if len(events) != 1 || events[0].Pid != root || events[0].Event != Exit {
+		t.Fatalf("WaitEvent() failed: want exit of pid %d, got %+v", root, events)
+	}
+}
+
+func TestParseProcEvent(t *testing.T) {
+	ne := binary.NativeEndian
+
+	// cn_msg + proc_event (uid change)
+	data := make([]byte, cnMsgLen+procEventHdrLen+16)
+	ne.PutUint32(data[0:], cnIdxProc)
+	ne.PutUint32(data[4:], cnValProc)
+
+	ev := data[cnMsgLen:]
+	ne.PutUint32(ev[0:], procEventUid)
+	ne.PutUint32(ev[16:], 100)
+	ne.PutUint32(ev[20:], 100)
+	ne.PutUint32(ev[24:], 1000)
+	ne.PutUint32(ev[28:], 0)
+
+	got, ok := parseProcEvent(data)
+	want := procEvent{what: procEventUid, pid: 100, tgid: 100, ruid: 1000, euid: 0}
+	if !ok || got != want {
+		t.Fatalf("parseProcEvent() failed: want %+v, got %+v (ok = %v)", want, got, ok)
+	}
+
+	// truncated
+	if _, ok := parseProcEvent(data[:cnMsgLen+procEventHdrLen+8]); ok {
+		t.Fatalf("parseProcEvent() failed: want error on truncated event")
+	}
+
+	// not a proc connector message
+	ne.PutUint32(data[0:], cnIdxProc+1)
+	if _, ok := parseProcEvent(data); ok {
+		t.Fatalf("parseProcEvent() failed: want error on non proc connector message")
+	}
+}
+
+func TestConnHandle(t *testing.T) {
+	pm := &PidMon{
+		eventTable: map[uint32]int{100: Comm | Uid | Descendants},
+	}
+	c := &connector{tracked: map[uint32]uint32{}}
+
+	tests := []struct {
+		ev   procEvent
+		want []PidEvent
+	}{
+		// fork of a descendant (not reported, but tracked)
+		{procEvent{what: procEventFork, pid: 101, tgid: 101, parentPid: 100, parentTgid: 100}, nil},
+		// thread of a descendant (not reported)
+		{procEvent{what: procEventComm, pid: 102, tgid: 101, comm: "thread"}, nil},
+		{procEvent{what: procEventComm, pid: 101, tgid: 101, comm: "child"},
+			[]PidEvent{{Pid: 101, Event: Comm, Proc: ProcInfo{Root: 100, Comm: "child"}}}},
+		{procEvent{what: procEventUid, pid: 100, tgid: 100, ruid: 1, euid: 2},
+			[]PidEvent{{Pid: 100, Event: Uid, Proc: ProcInfo{Root: 100, Ruid: 1, Euid: 2}}}},
+		// not monitored
+		{procEvent{what: procEventGid, pid: 100, tgid: 100, ruid: 1, euid: 2}, nil},
+		{procEvent{what: procEventComm, pid: 200, tgid: 200, comm: "other"}, nil},
+		// exit of a descendant (not reported, as Exit is not monitored)
+		{procEvent{what: procEventExit, pid: 101, tgid: 101, parentPid: 100, parentTgid: 100}, nil},
+		{procEvent{what: procEventComm, pid: 101, tgid: 101, comm: "child"}, nil},
+	}
+
+	for i, tt := range tests {
+		got := pm.connHandle(c, tt.ev)
+		if !slices.Equal(got, tt.want) {
+			t.Fatalf("connHandle() failed (test %d): want %+v, got %+v", i, tt.want, got)
+		}
+	}
+}
+
+func TestConnResync(t *testing.T) {
+	// the shell's child (sleep) is a descendant to be re-discovered
+	cmd := exec.Command("sh", "-c", "sleep 100 & wait")
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer cmd.Wait()
+	defer syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+
+	root := uint32(cmd.Process.Pid)
+
+	var child uint32
+	for i := 0; i < 100 && child == 0; i++ {
+		if children := procChildren()[root]; len(children) > 0 {
+			child = children[0]
+		} else {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	if child == 0 {
+		t.Fatalf("child of pid %d not found", root)
+	}
+
+	pm := &PidMon{
+		eventTable: map[uint32]int{root: Fork | Descendants, 1: Exit},
+	}
+	c := &connector{tracked: map[uint32]uint32{999999: root}}
+
+	events := pm.connResync(c)
+
+	if len(c.tracked) != 1 || c.tracked[child] != root {
+		t.Fatalf("connResync() failed: want %d tracked for %d, got %v", child, root, c.tracked)
+	}
+
+	want := []PidEvent{{Pid: root, Err: ErrEventsLost}}
+	if !slices.Equal(events, want) {
+		t.Fatalf("connResync() failed: want %+v, got %+v", want, events)
+	}
+
+	// delivered to receivers of proc connector events only
+	if !eventMatch(Fork, events[0]) || eventMatch(Exit, events[0]) {
+		t.Fatalf("eventMatch() failed for %+v", events[0])
+	}
+}
+
+func TestConnFail(t *testing.T) {
+	c := &connector{fd: -1, wakeFd: -1, tracked: map[uint32]uint32{}}
+	pm := &PidMon{
+		eventTable: map[uint32]int{10: Exec, 1: Exit},
+		conn:       c,
+	}
+	failErr := errors.New("poll failed")
+
+	events := pm.connFail(c, failErr)
+
+	want := []PidEvent{{Pid: 10, Err: failErr}}
+	if !slices.Equal(events, want) {
+		t.Fatalf("connFail() failed: want %+v, got %+v", want, events)
+	}
+
+	// the connector is restarted when proc connector events are added again
+	if pm.conn != nil {
+		t.Fatalf("connFail() failed: connector not released")
+	}
+}
+
+func TestValidateEvent(t *testing.T) {
+	tests := []struct {
+		event int
+		want  bool
+	}{
+		{Exit, true},
+		{Fork | Exec | Descendants, true},
+		{Descendants, false},
+		{0, false},
+		{0x1000, false},
+	}
+
+	for _, tt := range tests {
+		if got := validateEvent(tt.event); got != tt.want {
+			t.Fatalf("validateEvent(%#x) failed: want %v, got %v", tt.event, tt.want, got)
+		}
+	}
+}
+
+func TestPidReuse(t *testing.T) {
+	disablePidfd = true
+	defer func() { disablePidfd = false }()
+
+	pidMon, err := New(&Cfg{Poll: 10})
+	if err != nil {
+		t.Fatalf("New() failed: %s", err)
+	}
+	defer pidMon.Close()
+
+	pidList, err := spawnDummyProcesses(1)
+	if err != nil {
+		t.Fatalf("spawnDummyProcesses() failed: %s\n", err)
+	}
+	defer killDummyProcesses(pidList)
+
+	pid := uint32(pidList[0])
+
+	// make the monitor believe the pid was reused by another process
+	if err := pidMon.AddEvent([]PidEvent{{Pid: pid, Event: Exit}}); err != nil {
+		t.Fatalf("AddEvent() failed: %s\n", err)
+	}
+	pidMon.mu.Lock()
+	pidMon.idents[pid].StartTime++
+	pidMon.mu.Unlock()
+
+	want := []PidEvent{{Pid: pid, Event: Exit}}
+	got, err := pidMon.WaitEvent(context.Background())
+	if err != nil {
+		t.Fatalf("pidMon.WaitEvent() failed: %s", err)
+	}
+
+	if !eventListEqual(want, got) {
+		t.Fatalf("pidMon.WaitEvent() failed: want %+v, got %+v\n", want, got)
+	}
+}
+
+func TestWaitEventTimeout(t *testing.T) {
+	pidMon, err := New(&Cfg{Poll: 10})
+	if err != nil {
+		t.Fatalf("New() failed: %s", err)
+	}
+	defer pidMon.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	events, err := pidMon.WaitEvent(ctx)
+	if err != context.DeadlineExceeded {
+		t.Fatalf("WaitEvent() failed: want %v, got %v (events %+v)", context.DeadlineExceeded, err, events)
+	}
+}
+
+func TestCloseIdempotent(t *testing.T) {
+	for _, usePidfd := range []bool{true, false} {
+		disablePidfd = !usePidfd
+
+		pidMon, err := New(&Cfg{Poll: 10})
+		if err != nil {
+			t.Fatalf("New() failed: %s", err)
+		}
+
+		pidList, err := spawnDummyProcesses(1)
+		if err != nil {
+			t.Fatalf("spawnDummyProcesses() failed: %s\n", err)
+		}
+		pid := uint32(pidList[0])
+
+		if err := pidMon.AddEvent([]PidEvent{{Pid: pid, Event: Exit}}); err != nil {
+			t.Fatalf("AddEvent() failed: %s\n", err)
+		}
+		sub, err := pidMon.Subscribe(pid, Exit)
+		if err != nil {
+			t.Fatalf("Subscribe() failed: %s", err)
+		}
+
+		pidMon.Close()
+		pidMon.Close()
+
+		if _, err := pidMon.WaitEvent(context.Background()); err != ErrClosed {
+			t.Fatalf("WaitEvent() failed (pidfd = %v): want %v, got %v", usePidfd, ErrClosed, err)
+		}
+		if _, ok := <-sub.Events(); ok {
+			t.Fatalf("Subscribe() failed (pidfd = %v): channel not closed on Close()", usePidfd)
+		}
+		if err := pidMon.AddEvent([]PidEvent{{Pid: pid, Event: Exit}}); err != ErrClosed {
+			t.Fatalf("AddEvent() failed (pidfd = %v): want %v, got %v", usePidfd, ErrClosed, err)
+		}
+		if _, err := pidMon.Subscribe(pid, Exit); err != ErrClosed {
+			t.Fatalf("Subscribe() failed (pidfd = %v): want %v, got %v", usePidfd, ErrClosed, err)
+		}
+		sub.Cancel()
+
+		killDummyProcesses(pidList)
+	}
+	disablePidfd = false
+}
+
+func TestSubscribe(t *testing.T) {
+	for _, usePidfd := range []bool{true, false} {
+		disablePidfd = !usePidfd
+
+		pidMon, err := New(&Cfg{Poll: 10})
+		if err != nil {
+			t.Fatalf("New() failed: %s", err)
+		}
+
+		pidList, err := spawnDummyProcesses(2)
+		if err != nil {
+			t.Fatalf("spawnDummyProcesses() failed: %s\n", err)
+		}
+		pid := uint32(pidList[0])
+		other := uint32(pidList[1])
+
+		sub, err := pidMon.Subscribe(pid, Exit)
+		if err != nil {
+			t.Fatalf("Subscribe() failed: %s", err)
+		}
+		if err := pidMon.AddEvent([]PidEvent{{Pid: other, Event: Exit}}); err != nil {
+			t.Fatalf("AddEvent() failed: %s\n", err)
+		}
+
+		killDummyProcesses(pidList)
+
+		// the subscriber only gets the exit of its pid
+		select {
+		case e, ok := <-sub.Events():
+			if !ok || e.Pid != pid || e.Event != Exit {
+				t.Fatalf("Subscribe() failed (pidfd = %v): want exit of pid %d, got %+v", usePidfd, pid, e)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Subscribe() failed (pidfd = %v): timed out waiting for exit of pid %d", usePidfd, pid)
+		}
+		if _, ok := <-sub.Events(); ok {
+			t.Fatalf("Subscribe() failed (pidfd = %v): channel not closed after exit", usePidfd)
+		}
+
+		// and WaitEvent() only the exit of the pid added with AddEvent()
+		want := []PidEvent{{Pid: other, Event: Exit}}
+		got, err := pidMon.WaitEvent(context.Background())
+		if err != nil {
+			t.Fatalf("WaitEvent() failed: %s", err)
+		}
+		if !eventListEqual(want, got) {
+			t.Fatalf("WaitEvent() failed (pidfd = %v): want %+v, got %+v", usePidfd, want, got)
+		}
+
+		pidMon.mu.Lock()
+		numSubs := len(pidMon.subs)
+		numPids := len(pidMon.eventTable)
+		pidMon.mu.Unlock()
+
+		if numSubs != 0 || numPids != 0 {
+			t.Fatalf("Subscribe() failed (pidfd = %v): %d subscriptions and %d pids left", usePidfd, numSubs, numPids)
+		}
+
+		pidMon.Close()
+	}
+	disablePidfd = false
+}
+
+func TestSubscriptionCancel(t *testing.T) {
+	pidMon, err := New(&Cfg{Poll: 10})
+	if err != nil {
+		t.Fatalf("New() failed: %s", err)
+	}
+	defer pidMon.Close()
+
+	pidList, err := spawnDummyProcesses(1)
+	if err != nil {
+		t.Fatalf("spawnDummyProcesses() failed: %s\n", err)
+	}
+	defer killDummyProcesses(pidList)
+	pid := uint32(pidList[0])
+
+	sub, err := pidMon.Subscribe(pid, Exit)
+	if err != nil {
+		t.Fatalf("Subscribe() failed: %s", err)
+	}
+
+	sub.Cancel()
+	sub.Cancel()
+
+	if _, ok := <-sub.Events(); ok {
+		t.Fatalf("Cancel() failed: channel not closed")
+	}
+
+	pidMon.mu.Lock()
+	_, found := pidMon.eventTable[pid]
+	pidMon.mu.Unlock()
+
+	if found {
+		t.Fatalf("Cancel() failed: pid %d still monitored", pid)
+	}
+}
+
+// cgroup2Mount returns the mountpoint of the cgroup v2 hierarchy (if any).
+func cgroup2Mount() string {
+	data, err := os.ReadFile("/proc/self/mountinfo")
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		// the filesystem type follows the "-" separator
+		fields := strings.Fields(line)
+		for i, f := range fields {
+			if f == "-" && i+1 < len(fields) && fields[i+1] == "cgroup2" {
+				return fields[4]
+			}
+		}
+	}
+	return ""
+}
+
+// testCgroup creates a cgroup v2 for the test; skips the test if that's not
+// possible.
+func testCgroup(t *testing.T) string {
+	mnt := cgroup2Mount()
+	if mnt == "" {
+		t.Skip("cgroup v2 not mounted")
+	}
+	cg, err := os.MkdirTemp(mnt, "pidmon-test-")
+	if err != nil {
+		t.Skipf("failed to create cgroup: %s", err)
+	}
+	return cg
+}
+
+func TestCgroupMon(t *testing.T) {
+	for _, useInotify := range []bool{true, false} {
+		disableCgroupInotify = !useInotify
+
+		cg := testCgroup(t)
+		defer os.Remove(cg)
+
+		cgMon, err := NewCgroupMon(&Cfg{Poll: 10})
+		if err != nil {
+			t.Fatalf("NewCgroupMon() failed: %s", err)
+		}
+
+		pidList, err := spawnDummyProcesses(2)
+		if err != nil {
+			t.Fatalf("spawnDummyProcesses() failed: %s\n", err)
+		}
+		for _, pid := range pidList {
+			if err := os.WriteFile(filepath.Join(cg, "cgroup.procs"), []byte(strconv.Itoa(pid)), 0); err != nil {
+				killDummyProcesses(pidList)
+				t.Skipf("failed to move pid %d to cgroup: %s", pid, err)
+			}
+		}
+
+		if err := cgMon.Add(cg); err != nil {
+			t.Fatalf("Add() failed: %s", err)
+		}
+
+		// the cgroup is not empty until all its processes are gone
+		killDummyProcesses(pidList[:1])
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		events, err := cgMon.WaitEvent(ctx)
+		cancel()
+		if err != context.DeadlineExceeded {
+			t.Fatalf("WaitEvent() failed (inotify = %v): want no events, got %+v (%v)", useInotify, events, err)
+		}
+
+		killDummyProcesses(pidList[1:])
+
+		ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+		events, err = cgMon.WaitEvent(ctx)
+		cancel()
+		if err != nil {
+			t.Fatalf("WaitEvent() failed (inotify = %v): %s", useInotify, err)
+		}
+
+		want := []CgroupEvent{{Path: cg, Event: CgroupEmpty}}
+		if !slices.Equal(want, events) {
+			t.Fatalf("WaitEvent() failed (inotify = %v): want %+v, got %+v", useInotify, want, events)
+		}
+
+		cgMon.mu.Lock()
+		numCgroups := len(cgMon.cgroups)
+		cgMon.mu.Unlock()
+
+		if numCgroups != 0 {
+			t.Fatalf("cgroup monitor failed (inotify = %v): %d cgroups left", useInotify, numCgroups)
+		}
+
+		cgMon.Close()
+		cgMon.Close()
+
+		if _, err := cgMon.WaitEvent(context.Background()); err != ErrClosed {
+			t.Fatalf("WaitEvent() failed: want %v, got %v", ErrClosed, err)
+		}
+	}
+	disableCgroupInotify = false
+}
+
+func TestCgroupMonAddEmpty(t *testing.T) {
+	cg := testCgroup(t)
+	defer os.Remove(cg)
+
+	cgMon, err := NewCgroupMon(&Cfg{Poll: 10})
+	if err != nil {
+		t.Fatalf("NewCgroupMon() failed: %s", err)
+	}
+	defer cgMon.Close()
+
+	if err := cgMon.Add(filepath.Join(cg, "nonexistent")); err == nil {
+		t.Fatalf("Add() failed: want error for non-cgroup dir")
+	}
+
+	// an empty cgroup is reported right away
+	if err := cgMon.Add(cg); err != nil {
+		t.Fatalf("Add() failed: %s", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	events, err := cgMon.WaitEvent(ctx)
+	if err != nil {
+		t.Fatalf("WaitEvent() failed: %s", err)
+	}
+	want := []CgroupEvent{{Path: cg, Event: CgroupEmpty}}
+	if !slices.Equal(want, events) {
+		t.Fatalf("WaitEvent() failed: want %+v, got %+v", want, events)
+	}
+}
+
+func TestCheckCgroup(t *testing.T) {
+	cg := testCgroup(t)
+
+	if e := checkCgroup(cg); e == nil || *e != (CgroupEvent{Path: cg, Event: CgroupEmpty}) {
+		t.Fatalf("checkCgroup() failed: want empty event, got %+v", e)
+	}
+
+	if err := os.Remove(cg); err != nil {
+		t.Fatalf("failed to remove cgroup: %s", err)
+	}
+
+	if e := checkCgroup(cg); e == nil || *e != (CgroupEvent{Path: cg, Event: CgroupRemoved}) {
+		t.Fatalf("checkCgroup() failed: want removed event, got %+v", e)
+	}
+}
@@ -0,0 +1,243 @@
+//
+// Copyright 2026 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package pidmonitor
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Size of the event channel of each subscription
+const subChanSize = 16
+
+// Subscription delivers the events of a single pid (and optionally its
+// descendants) on its own channel, independently of WaitEvent(). The channel
+// is closed once the pid exits (unless descendants are monitored too), when
+// the subscription is cancelled, or when the pid monitor is closed.
+type Subscription struct {
+	pm     *PidMon
+	pid    uint32
+	events int
+
+	mu     sync.RWMutex // held for writing to close ch; for reading to send on it
+	ch     chan PidEvent
+	done   chan struct{}
+	closed bool
+	once   sync.Once
+}
+
+// Subscribe returns a subscription to the given events of the given pid; e.g.,
+// Subscribe(pid, Exit) notifies when the pid exits. It does not affect the
+// events added with AddEvent().
+func (pm *PidMon) Subscribe(pid uint32, events int) (*Subscription, error) {
+	if !validateEvent(events) {
+		return nil, fmt.Errorf("Unknown event %v", events)
+	}
+
+	s := &Subscription{
+		pm:     pm,
+		pid:    pid,
+		events: events,
+		ch:     make(chan PidEvent, subChanSize),
+		done:   make(chan struct{}),
+	}
+
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	pm.subs[pid] = append(pm.subs[pid], s)
+
+	if err := pm.setEvents(pid, pm.added[pid]|pm.subEvents(pid)); err != nil {
+		pm.removeSub(s)
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Events returns the channel on which the subscription's events are delivered.
+func (s *Subscription) Events() <-chan PidEvent {
+	return s.ch
+}
+
+// Cancel stops the subscription and closes its channel; it's safe to call it
+// multiple times.
+func (s *Subscription) Cancel() {
+	pm := s.pm
+
+	pm.mu.Lock()
+	if pm.removeSub(s) {
+		pm.setEvents(s.pid, pm.added[s.pid]|pm.subEvents(s.pid))
+	}
+	pm.mu.Unlock()
+
+	s.close()
+}
+
+// send delivers the given event to the subscriber; gives up if the
+// subscription is cancelled or the pid monitor is closed while waiting.
+func (s *Subscription) send(e PidEvent) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.closed {
+		return
+	}
+
+	select {
+	case s.ch <- e:
+	case <-s.done:
+	case <-s.pm.stopCh:
+	}
+}
+
+// close closes the subscription's channel (once).
+func (s *Subscription) close() {
+	s.once.Do(func() {
+		// unblock senders before taking the lock
+		close(s.done)
+		s.mu.Lock()
+		s.closed = true
+		close(s.ch)
+		s.mu.Unlock()
+	})
+}
+
+// removeSub removes the given subscription from the pid monitor; returns false
+// if it was not found. Must be called with pm.mu held.
+func (pm *PidMon) removeSub(s *Subscription) bool {
+	subs := pm.subs[s.pid]
+	for i, sub := range subs {
+		if sub == s {
+			subs = append(subs[:i:i], subs[i+1:]...)
+			if len(subs) == 0 {
+				delete(pm.subs, s.pid)
+			} else {
+				pm.subs[s.pid] = subs
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// subEvents returns the events the subscriptions of the given pid are
+// interested in; must be called with pm.mu held.
+func (pm *PidMon) subEvents(pid uint32) int {
+	evect := 0
+	for _, s := range pm.subs[pid] {
+		evect |= s.events
+	}
+	return evect
+}
+
+// eventMatch returns true if the given event is of interest for the given
+// event vector of the monitored pid it was reported for.
+func eventMatch(evect int, e PidEvent) bool {
+	// lost proc connector events (see ErrEventsLost) or a failed connector
+	if e.Event == 0 && e.Err != nil {
+		return evect&connEvents != 0
+	}
+
+	if evect&e.Event == 0 {
+		return false
+	}
+
+	owner := e.Pid
+	if e.Proc.Root != 0 {
+		owner = e.Proc.Root
+	}
+
+	// events of descendants (other than the fork of a child) are only of
+	// interest if descendants are monitored
+	direct := e.Pid == owner || (e.Event == Fork && e.Proc.Parent == owner)
+	return direct || evect&Descendants != 0
+}
+
+// An event to be delivered to a subscription
+type subEvent struct {
+	s *Subscription
+	e PidEvent
+}
+
+// The events to be delivered by deliver()
+type delivery struct {
+	events    []PidEvent      // for WaitEvent()
+	subEvents []subEvent      // for subscriptions
+	finished  []*Subscription // subscriptions to close once their events are delivered
+}
+
+// dispatch works out who the given events are to be delivered to, and stops
+// monitoring the exit of the pids that exited; must be called with pm.mu held.
+func (pm *PidMon) dispatch(events []PidEvent) *delivery {
+	d := &delivery{}
+
+	for _, e := range events {
+		owner := e.Pid
+		if e.Proc.Root != 0 {
+			owner = e.Proc.Root
+		}
+
+		if eventMatch(pm.added[owner], e) {
+			d.events = append(d.events, e)
+		}
+		for _, s := range pm.subs[owner] {
+			if eventMatch(s.events, e) {
+				d.subEvents = append(d.subEvents, subEvent{s, e})
+			}
+		}
+
+		if e.Event != Exit || e.Pid != owner {
+			continue
+		}
+
+		// pid exit implies event won't hit again; remove it. Subscriptions of
+		// the pid are done (unless they monitor descendants).
+		pm.clearExit(e.Pid)
+
+		for _, s := range pm.subs[e.Pid] {
+			if s.events&Descendants == 0 {
+				d.finished = append(d.finished, s)
+			}
+		}
+		for _, s := range d.finished {
+			pm.removeSub(s)
+		}
+		pm.setEvents(e.Pid, (pm.added[e.Pid]|pm.subEvents(e.Pid))&^Exit)
+	}
+
+	return d
+}
+
+// deliver delivers the given events; must be called without pm.mu held since
+// receivers may block. Gives up if the pid monitor is closed.
+func (pm *PidMon) deliver(d *delivery) {
+	if len(d.events) > 0 {
+		select {
+		case pm.eventCh <- d.events:
+		case <-pm.stopCh:
+		}
+	}
+
+	for _, se := range d.subEvents {
+		se.s.send(se.e)
+	}
+
+	for _, s := range d.finished {
+		s.close()
+	}
+}
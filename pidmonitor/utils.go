@@ -26,7 +26,8 @@ func validateCfg(cfg *Cfg) error {
 }
 
 func validateEvent(event int) bool {
-	return event == Exit
+	// Descendants is a modifier, not an event
+	return event&^allEvents == 0 && event&^Descendants != 0
 }
 
 func eventSet(evect int, etype int) int {
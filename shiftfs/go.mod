@@ -13,6 +13,7 @@ require (
 )
 
 require (
+	github.com/nestybox/sysbox-libs/pidfd v0.0.0-00010101000000-000000000000 // indirect
 	github.com/spf13/afero v1.4.1 // indirect
 	golang.org/x/text v0.3.8 // indirect
 )
@@ -20,5 +21,6 @@ require (
 replace (
 	github.com/nestybox/sysbox-libs/linuxUtils => ../linuxUtils
 	github.com/nestybox/sysbox-libs/mount => ../mount
+	github.com/nestybox/sysbox-libs/pidfd => ../pidfd
 	github.com/nestybox/sysbox-libs/utils => ../utils
 )
@@ -3,7 +3,10 @@ module github.com/nestybox/sysbox-libs/utils
 go 1.21
 
 require (
+	github.com/nestybox/sysbox-libs/pidfd v0.0.0-00010101000000-000000000000
 	github.com/opencontainers/runtime-spec v1.0.2
 	github.com/sirupsen/logrus v1.9.4
 	golang.org/x/sys v0.19.0
 )
+
+replace github.com/nestybox/sysbox-libs/pidfd => ../pidfd
@@ -22,7 +22,9 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/nestybox/sysbox-libs/pidfd"
 	"github.com/sirupsen/logrus"
 )
 
@@ -34,7 +36,7 @@ func CheckPidFile(program string, pidFile string) error {
 	}
 
 	if err == nil {
-		if isProgramRunning(program, pid) {
+		if isProgramRunning(program, pid) && isPidFileOwner(pid, pidFile) {
 			return fmt.Errorf("%s program is running as pid %d", program, pid)
 		}
 	}
@@ -88,3 +90,33 @@ func isProgramRunning(program string, pid int) bool {
 
 	return true
 }
+
+// isPidFileOwner checks if the process with the given pid may have written the
+// given pid file, i.e., it started before the file was written. Otherwise the
+// pid was reused by another process after the one that wrote the file exited.
+func isPidFileOwner(pid int, pidFile string) bool {
+
+	fi, err := os.Stat(pidFile)
+	if err != nil {
+		return false
+	}
+
+	id, err := pidfd.NewProcessIdentity(pid, false)
+	if err != nil {
+		return false
+	}
+
+	// if the start time can't be determined, rely on the program name only
+	startedAt, err := id.StartedAt()
+	if err != nil {
+		return true
+	}
+
+	// the start time has a 1 second precision
+	if startedAt.After(fi.ModTime().Add(time.Second)) {
+		logrus.Infof("pid %d (%s) started after pid file %s was written", pid, id, pidFile)
+		return false
+	}
+
+	return true
+}
@@ -20,6 +20,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 )
 
 func TestSysboxPidFile(t *testing.T) {
@@ -61,3 +62,32 @@ func TestSysboxPidFile(t *testing.T) {
 		os.RemoveAll(pidFile)
 	}
 }
+
+func TestPidFileReuse(t *testing.T) {
+
+	pidFile := filepath.Join(t.TempDir(), "test.pid")
+
+	exe, err := os.Readlink("/proc/self/exe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	program := filepath.Base(exe)
+
+	// a pid file written by this process
+	if err := CreatePidFile(program, pidFile); err != nil {
+		t.Fatalf("CreatePidFile() failed: %s", err)
+	}
+	if err := CheckPidFile(program, pidFile); err == nil {
+		t.Fatalf("CheckPidFile() failed: want error (program running), got nil")
+	}
+
+	// a pid file written before this process started (i.e., by a previous
+	// process with the same pid)
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(pidFile, old, old); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckPidFile(program, pidFile); err != nil {
+		t.Fatalf("CheckPidFile() failed: want nil (pid reused), got %s", err)
+	}
+}